@@ -0,0 +1,312 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Stage is a step of an Aggregate pipeline: Match, GroupBy, or one of the
+// accumulators Count, Sum, Avg, Min and Max
+type Stage interface {
+	apply(p *pipeline) error
+}
+
+type pipeline struct {
+	conds        []Condition
+	groupBy      []string
+	accumulators []Accumulator
+}
+
+type matchStage Query
+
+// Match keeps only the records matching query, as Find selects them. Several
+// Match stages must all match.
+func Match(query Query) Stage {
+	return matchStage(query)
+}
+
+func (s matchStage) apply(p *pipeline) error {
+	p.conds = append(p.conds, s.Conditions...)
+	return nil
+}
+
+type groupStage []string
+
+// GroupBy groups the records by the values at the dotted field paths, one
+// result per distinct combination; records missing a field group under
+// null. Without it, every matching record falls in a single group.
+func GroupBy(fields ...string) Stage {
+	return groupStage(fields)
+}
+
+func (s groupStage) apply(p *pipeline) error {
+	if p.groupBy != nil {
+		return fmt.Errorf("unable to aggregate - more than one GroupBy")
+	}
+	if len(s) == 0 {
+		return fmt.Errorf("unable to aggregate - GroupBy needs a field")
+	}
+	for _, f := range s {
+		if f == "" {
+			return fmt.Errorf("unable to aggregate - GroupBy field must not be empty")
+		}
+	}
+	p.groupBy = s
+	return nil
+}
+
+type accumulatorKind string
+
+const (
+	countAccumulator accumulatorKind = "count"
+	sumAccumulator   accumulatorKind = "sum"
+	avgAccumulator   accumulatorKind = "avg"
+	minAccumulator   accumulatorKind = "min"
+	maxAccumulator   accumulatorKind = "max"
+)
+
+// Accumulator computes a value over the records of each group, stored in
+// the group's result under its name: "count" for Count and e.g. "avg(Age)"
+// for Avg("Age"), unless renamed with As
+type Accumulator struct {
+	kind  accumulatorKind
+	field string
+	name  string
+}
+
+// Count counts the records of each group
+func Count() Accumulator {
+	return Accumulator{kind: countAccumulator, name: string(countAccumulator)}
+}
+
+// Sum adds up the numbers at a dotted field path; other values are skipped
+func Sum(field string) Accumulator { return newAccumulator(sumAccumulator, field) }
+
+// Avg averages the numbers at a dotted field path, and is null for groups
+// without any
+func Avg(field string) Accumulator { return newAccumulator(avgAccumulator, field) }
+
+// Min keeps the smallest value at a dotted field path, comparing numbers
+// numerically and strings lexically; values of other types are skipped, and
+// a number and a string are never compared, so the first kind seen wins
+func Min(field string) Accumulator { return newAccumulator(minAccumulator, field) }
+
+// Max keeps the largest value at a dotted field path, as Min keeps the
+// smallest
+func Max(field string) Accumulator { return newAccumulator(maxAccumulator, field) }
+
+func newAccumulator(kind accumulatorKind, field string) Accumulator {
+	return Accumulator{kind: kind, field: field, name: fmt.Sprintf("%s(%s)", kind, field)}
+}
+
+// As returns a with its result stored under name
+func (a Accumulator) As(name string) Accumulator {
+	a.name = name
+	return a
+}
+
+func (a Accumulator) apply(p *pipeline) error {
+	if a.kind != countAccumulator && a.field == "" {
+		return fmt.Errorf("unable to aggregate - %s needs a field", a.kind)
+	}
+	if a.name == "" {
+		return fmt.Errorf("unable to aggregate - %s result must have a name", a.kind)
+	}
+	p.accumulators = append(p.accumulators, a)
+	return nil
+}
+
+// group is the running state of the accumulators of one group
+type group struct {
+	key    []interface{}
+	count  int
+	sums   []float64
+	counts []int
+	bests  []interface{}
+}
+
+// Aggregate runs the records of a collection through a pipeline of stages,
+// holding only the running totals of each group in memory, and returns one
+// result per group: the group fields at their paths, as GroupBy("a.b")
+// gives {"a": {"b": ...}}, and the value of each accumulator under its name.
+// Results are in the order their groups were first seen, listing order;
+// without GroupBy there is always exactly one. The conditions of Match use
+// the indexes as Find does. It requires the json Format.
+//
+//	db.Aggregate("users", GroupBy("Address.Country"), Count(), Avg("Age").As("AvgAge"))
+func (d *Driver) Aggregate(collection string, stages ...Stage) (results []map[string]interface{}, err error) {
+	defer d.done(OpAggregate, collection, "", time.Now(), &err)
+	return d.aggregate(collection, stages)
+}
+
+// AggregateInto is Aggregate decoding the results into v, a pointer to a
+// slice of maps or structs. Struct fields are matched to the result names
+// as by encoding/json, so an accumulator's name goes in the field's json tag
+// or As sets it to the field name.
+func (d *Driver) AggregateInto(collection string, v interface{}, stages ...Stage) (err error) {
+	defer d.done(OpAggregateInto, collection, "", time.Now(), &err)
+
+	results, err := d.aggregate(collection, stages)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (d *Driver) aggregate(collection string, stages []Stage) ([]map[string]interface{}, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to aggregate records", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := d.requireJSON("Aggregate"); err != nil {
+		return nil, err
+	}
+
+	p := &pipeline{}
+	for _, s := range stages {
+		if s == nil {
+			return nil, fmt.Errorf("unable to aggregate - nil stage")
+		}
+		if err := s.apply(p); err != nil {
+			return nil, err
+		}
+	}
+	conds, err := normalizeConditions(p.conds)
+	if err != nil {
+		return nil, err
+	}
+
+	names, indexed, err := d.indexedCandidates(collection, conds)
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		if names, err = d.resourceNames(collection); err != nil {
+			return nil, err
+		}
+	}
+
+	var groups []*group
+	byKey := make(map[string]*group)
+	for _, name := range names {
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue // deleted since the listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %v/%v: %w", collection, name, err)
+		}
+		if !matchConditions(doc, conds) {
+			continue
+		}
+
+		key := make([]interface{}, len(p.groupBy))
+		for i, field := range p.groupBy {
+			key[i], _ = lookupPath(doc, field)
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		g, ok := byKey[string(k)]
+		if !ok {
+			g = newGroup(key, len(p.accumulators))
+			byKey[string(k)] = g
+			groups = append(groups, g)
+		}
+		g.add(doc, p.accumulators)
+	}
+
+	if len(groups) == 0 && p.groupBy == nil {
+		// the single group exists even with no records in it
+		groups = append(groups, newGroup(nil, len(p.accumulators)))
+	}
+
+	var results []map[string]interface{}
+	for _, g := range groups {
+		results = append(results, g.result(p))
+	}
+	return results, nil
+}
+
+func newGroup(key []interface{}, accumulators int) *group {
+	return &group{
+		key:    key,
+		sums:   make([]float64, accumulators),
+		counts: make([]int, accumulators),
+		bests:  make([]interface{}, accumulators),
+	}
+}
+
+func (g *group) add(doc interface{}, accumulators []Accumulator) {
+	g.count++
+	for i, a := range accumulators {
+		if a.kind == countAccumulator {
+			continue
+		}
+		v, ok := lookupPath(doc, a.field)
+		if !ok {
+			continue
+		}
+		switch a.kind {
+		case sumAccumulator, avgAccumulator:
+			n, ok := v.(json.Number)
+			if !ok {
+				continue
+			}
+			f, err := n.Float64()
+			if err != nil {
+				continue
+			}
+			g.sums[i] += f
+			g.counts[i]++
+		case minAccumulator, maxAccumulator:
+			if g.bests[i] == nil {
+				if _, ordered := compareValues(v, v); ordered {
+					g.bests[i] = v
+				}
+				continue
+			}
+			cmp, ordered := compareValues(v, g.bests[i])
+			if ordered && (a.kind == minAccumulator && cmp < 0 || a.kind == maxAccumulator && cmp > 0) {
+				g.bests[i] = v
+			}
+		}
+	}
+}
+
+func (g *group) result(p *pipeline) map[string]interface{} {
+	out := make(map[string]interface{})
+	for i, field := range p.groupBy {
+		setPath(out, field, g.key[i])
+	}
+	for i, a := range p.accumulators {
+		switch a.kind {
+		case countAccumulator:
+			out[a.name] = g.count
+		case sumAccumulator:
+			out[a.name] = g.sums[i]
+		case avgAccumulator:
+			if g.counts[i] == 0 {
+				out[a.name] = nil
+			} else {
+				out[a.name] = g.sums[i] / float64(g.counts[i])
+			}
+		case minAccumulator, maxAccumulator:
+			out[a.name] = g.bests[i]
+		}
+	}
+	return out
+}
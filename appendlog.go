@@ -0,0 +1,366 @@
+package jsondb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// StorageFiles keeps one file per record, <dir>/<collection>/<resource>.json
+	StorageFiles = "files"
+
+	// StorageAppendLog keeps every record of a collection in a single
+	// <dir>/<collection>.log file. Each Write or Delete appends an entry
+	// framed as {length:uint32 big endian}{json}\n, so writes never create
+	// files, while Read has to scan the log for the latest entry of a
+	// resource. CompactLog drops overwritten and deleted entries.
+	StorageAppendLog = "appendlog"
+)
+
+// logEntry is the JSON framed in an append-log entry. A deletion is recorded
+// as a tombstone entry without a document.
+type logEntry struct {
+	Key     string          `json:"key"`
+	Doc     json.RawMessage `json:"doc,omitempty"`
+	Deleted bool            `json:"deleted,omitempty"`
+}
+
+func (d *Driver) logPath(collection string) string {
+	return filepath.Join(d.dir, collection+".log")
+}
+
+// requireFiles fails features that work on individual record files when the
+// driver uses the append-log storage
+func (d *Driver) requireFiles(feature string) error {
+	if d.storage != StorageFiles {
+		return fmt.Errorf("%s requires the %s storage, driver uses %s", feature, StorageFiles, d.storage)
+	}
+	return nil
+}
+
+// writeLog appends a record to the collection log
+func (d *Driver) writeLog(collection, resource string, v interface{}) error {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return d.writeLogDoc(collection, resource, doc)
+}
+
+// writeLogDoc appends an encoded record to the collection log. The caller
+// must hold the collection mutex.
+func (d *Driver) writeLogDoc(collection, resource string, doc []byte) error {
+	if d.writeDelay > 0 {
+		time.Sleep(d.writeDelay)
+	}
+
+	if err := d.checkSchema(collection, resource, doc); err != nil {
+		return err
+	}
+	doc, err := d.stampMeta(collection, resource, doc)
+	if err != nil {
+		return err
+	}
+	existed := d.recordExists(collection, resource)
+	if err := d.appendLog(collection, logEntry{Key: resource, Doc: doc}); err != nil {
+		return err
+	}
+
+	d.blooms.added(collection, resource)
+	d.schemas.observe(d.log, collection, resource, doc)
+	d.written(collection, resource, existed, doc)
+	return nil
+}
+
+// deleteLog appends a tombstone for resource, or removes the whole log when
+// resource is empty
+func (d *Driver) deleteLog(collection, resource string) error {
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if resource == "" {
+		d.blooms.dropped(collection)
+		if err := d.backend.Remove(d.logPath(collection)); err != nil {
+			return notFound(collection, "", err)
+		}
+		d.changed(Deleted, collection, "", nil)
+		return d.dropLogIndex(collection)
+	}
+
+	if _, _, err := d.findLog(collection, resource); err != nil {
+		return notFound(collection, resource, err)
+	}
+
+	if err := d.appendLog(collection, logEntry{Key: resource, Deleted: true}); err != nil {
+		return err
+	}
+
+	d.blooms.removed(collection, resource)
+	d.changed(Deleted, collection, resource, nil)
+	return nil
+}
+
+// appendLog frames and appends one entry. The caller must hold the collection
+// mutex.
+func (d *Driver) appendLog(collection string, e logEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	path := d.logPath(collection)
+	if err := d.backend.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := d.backend.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Write(frameLogEntry(b)); err != nil {
+		f.Close()
+		return err
+	}
+	if d.durability != DurabilityNone {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	offset := fi.Size()
+	if e.Deleted {
+		offset = -1
+	}
+	d.indexLogEntry(collection, e.Key, offset)
+	return nil
+}
+
+func frameLogEntry(b []byte) []byte {
+	framed := make([]byte, 4, 4+len(b)+1)
+	binary.BigEndian.PutUint32(framed, uint32(len(b)))
+	framed = append(framed, b...)
+	return append(framed, '\n')
+}
+
+// scanLog calls fn with the offset and contents of every entry of the
+// collection log, in append order. A torn entry at the end of the log, left
+// by an append still in flight or interrupted by a crash, is ignored.
+func (d *Driver) scanLog(collection string, fn func(offset int64, e logEntry) error) error {
+	f, err := d.openFile(d.logPath(collection))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		e, n, err := readLogEntry(r, fi.Size()-offset)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("corrupt log %v at offset %d: %w", d.logPath(collection), offset, err)
+		}
+
+		if err := fn(offset, e); err != nil {
+			return err
+		}
+		offset += n
+	}
+}
+
+// readLogEntry reads one framed entry from r, which holds remaining bytes,
+// and returns it with its size on disk. A length overrunning remaining, be
+// it a torn append or a corrupt header, fails with an error wrapping
+// io.ErrUnexpectedEOF before anything is allocated for it.
+func readLogEntry(r io.Reader, remaining int64) (logEntry, int64, error) {
+	var e logEntry
+
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return e, 0, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if left := remaining - 4; int64(n)+1 > left {
+		return e, 0, fmt.Errorf("corrupt entry of %d bytes with %d bytes left in the log: %w", n, max(left, 0), io.ErrUnexpectedEOF)
+	}
+	b := make([]byte, int(n)+1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return e, 0, err
+	}
+	if b[n] != '\n' {
+		return e, 0, fmt.Errorf("entry is not newline terminated")
+	}
+
+	if err := json.Unmarshal(b[:n], &e); err != nil {
+		return e, 0, err
+	}
+
+	return e, int64(4 + len(b)), nil
+}
+
+// findLog returns the latest live document of resource and its offset
+func (d *Driver) findLog(collection, resource string) (json.RawMessage, int64, error) {
+	var doc json.RawMessage
+	offset := int64(-1)
+
+	err := d.scanLog(collection, func(off int64, e logEntry) error {
+		if e.Key != resource {
+			return nil
+		}
+		if e.Deleted {
+			doc, offset = nil, -1
+		} else {
+			doc, offset = e.Doc, off
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if doc == nil {
+		return nil, 0, &fs.PathError{Op: "read", Path: filepath.Join(d.dir, collection, resource), Err: fs.ErrNotExist}
+	}
+
+	return doc, offset, nil
+}
+
+// liveLog returns the live documents of the collection log ordered by the
+// offset of their latest write, along with their keys
+func (d *Driver) liveLog(collection string) ([]string, []json.RawMessage, error) {
+	type live struct {
+		offset int64
+		doc    json.RawMessage
+	}
+	latest := make(map[string]live)
+	var order []string
+
+	err := d.scanLog(collection, func(off int64, e logEntry) error {
+		if _, ok := latest[e.Key]; !ok {
+			order = append(order, e.Key)
+		}
+		if e.Deleted {
+			latest[e.Key] = live{offset: -1}
+		} else {
+			latest[e.Key] = live{off, e.Doc}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := order[:0]
+	for _, k := range order {
+		if latest[k].offset >= 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return latest[keys[i]].offset < latest[keys[j]].offset })
+
+	docs := make([]json.RawMessage, len(keys))
+	for i, k := range keys {
+		docs[i] = latest[k].doc
+	}
+	return keys, docs, nil
+}
+
+func (d *Driver) readAllLog(collection string) ([]string, error) {
+	_, docs, err := d.liveLog(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]string, len(docs))
+	for i, doc := range docs {
+		records[i] = string(doc)
+	}
+	return records, nil
+}
+
+// CompactLog rewrites an append-log collection keeping only the latest entry
+// of every live record, in append order
+func (d *Driver) CompactLog(collection string) (err error) {
+	defer d.done(OpCompactLog, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to compact log", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if d.storage != StorageAppendLog {
+		return fmt.Errorf("CompactLog requires the %s storage, driver uses %s", StorageAppendLog, d.storage)
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return d.compactLog(collection)
+}
+
+// compactLog is CompactLog for a caller holding the collection mutex
+func (d *Driver) compactLog(collection string) error {
+	keys, docs, err := d.liveLog(collection)
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	for i, k := range keys {
+		e, err := json.Marshal(logEntry{Key: k, Doc: docs[i]})
+		if err != nil {
+			return err
+		}
+		b = append(b, frameLogEntry(e)...)
+	}
+
+	path := d.logPath(collection)
+	if err := d.writeFile(path+d.tmpSuffix, path, b); err != nil {
+		return err
+	}
+
+	// offsets all moved; the index is rebuilt on the next seek
+	return d.dropLogIndex(collection)
+}
@@ -0,0 +1,79 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTornLogEntry appends what a crash mid-append, or a corrupt header,
+// leaves at the end of a log
+func TestTornLogEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{"torn header", []byte{0, 0}},
+		{"torn entry", frameLogEntry([]byte(`{"key":"bob","doc":{"Name":"Bob"}}`))[:20]},
+		{"huge length", []byte{0xff, 0xff, 0xff, 0xff, '{'}},
+		{"length past the end", binary.BigEndian.AppendUint32(nil, 64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, dir := newTestDriver(t, &Options{Storage: StorageAppendLog})
+			if err := d.Write("users", "ada", testUser{"Ada", 36}); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.OpenFile(filepath.Join(dir, "users.log"), os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write(tt.tail); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			records, err := d.ReadAll("users")
+			if err != nil || len(records) != 1 {
+				t.Fatalf("ReadAll() with a torn tail = %q, %v, want ada", records, err)
+			}
+			if _, _, err := readLogEntry(bytes.NewReader(tt.tail), int64(len(tt.tail))); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("readLogEntry() of the torn entry = %v, want io.ErrUnexpectedEOF", err)
+			}
+		})
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	d, _ := newTestDriver(t, &Options{Storage: StorageAppendLog})
+	for _, u := range []testUser{{"Ada", 36}, {"Bob", 41}} {
+		if err := d.Write("users", u.Name, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale, err := d.SeekRecord("users", "Ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Write("users", "Ada", testUser{"Ada", 37}); err != nil {
+		t.Fatal(err)
+	}
+	offset, err := d.SeekRecord("users", "Ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var u testUser
+	if err := d.ReadAt("users", offset, &u); err != nil || u != (testUser{"Ada", 37}) {
+		t.Fatalf("ReadAt(%d) = %+v, %v", offset, u, err)
+	}
+	for _, off := range []int64{stale, offset + 1, -1, 1 << 40} {
+		if err := d.ReadAt("users", off, &testUser{}); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("ReadAt(%d) = %v, want os.ErrNotExist", off, err)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package jsondb
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupPrefix names the hidden dirs Backup and Restore stage files in under
+// the database dir; like every dot dir they are skipped by the walks.
+const backupPrefix = ".backup-"
+
+// RestoreMode selects what Restore does with the records already stored
+type RestoreMode int
+
+const (
+	// RestoreOverwrite replaces the whole database with the backup: records
+	// and collections missing from it are removed
+	RestoreOverwrite RestoreMode = iota
+
+	// RestoreMerge adds the backup to the database: records in the backup
+	// replace those of the same name, every other record is kept
+	RestoreMerge
+)
+
+// RestoreOptions are the settings of Restore
+type RestoreOptions struct {
+	Mode RestoreMode
+}
+
+// Backup writes a snapshot of the whole database to w as a tar.gz archive of
+// its files, stored as they are on disk (still encrypted with
+// Options.Encryption). Every collection is locked only while its files are
+// hard linked into a staging dir, or copied where hard links aren't
+// supported, so the snapshot is consistent across collections; the archive
+// is then streamed from the staging dir without holding any lock.
+// Collections created while the snapshot is taken may be left out.
+func (d *Driver) Backup(w io.Writer) (err error) {
+	defer d.done(OpBackup, "", "", time.Now(), &err)
+
+	staging := filepath.Join(d.dir, backupPrefix+strconv.FormatInt(time.Now().UnixNano(), 10))
+	defer d.backend.RemoveAll(staging)
+
+	files, err := d.snapshot(staging)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range files {
+		if err := d.addToArchive(tw, filepath.Join(staging, filepath.FromSlash(name)), name); err != nil {
+			return fmt.Errorf("unable to back up %v: %w", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// snapshot links every file of the database into staging under all the
+// collection locks and returns their slash separated paths, sorted
+func (d *Driver) snapshot(staging string) ([]string, error) {
+	collections, err := d.Collections()
+	if err != nil {
+		return nil, err
+	}
+
+	// in the order Transaction and trashRecord take them
+	d.tx.Lock()
+	defer d.tx.Unlock()
+	for _, c := range collections {
+		unlock, err := d.lockCollection(c)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	d.trash.Lock()
+	defer d.trash.Unlock()
+
+	var files []string
+	err = d.walkDir(d.dir, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == d.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		rel, err := filepath.Rel(d.dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if e.IsDir() {
+			if rel == txDir || strings.HasPrefix(e.Name(), backupPrefix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !e.Type().IsRegular() || strings.HasSuffix(rel, ".lock") || strings.HasSuffix(rel, d.tmpSuffix) {
+			return nil
+		}
+
+		dst := filepath.Join(staging, rel)
+		if err := d.backend.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		// padded records are overwritten in place, which a link would see
+		if d.recordPadding > 0 || d.link(p, dst) != nil {
+			if err := d.copyFile(p, dst); err != nil {
+				return err
+			}
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+func (d *Driver) copyFile(src, dst string) error {
+	in, err := d.openFile(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := d.createFile(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (d *Driver) addToArchive(tw *tar.Writer, path, name string) error {
+	f, err := d.openFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
+
+// Restore reads a tar.gz archive written by Backup into the database, as
+// opts.Mode says. With RestoreMerge the indexes of merged collections are
+// rebuilt, and appendlog collections in the backup replace the stored ones
+// whole. The archive is extracted into a staging dir first, so a
+// corrupt archive leaves the database untouched; the files are then moved
+// into place with every collection involved locked. Backups are restored at
+// the file level: they must come from a database of the same Format, Codec,
+// Storage and encryption keys. Watchers don't see the restored changes.
+func (d *Driver) Restore(r io.Reader, opts RestoreOptions) (err error) {
+	defer d.done(OpRestore, "", "", time.Now(), &err)
+
+	if opts.Mode != RestoreOverwrite && opts.Mode != RestoreMerge {
+		return fmt.Errorf("invalid restore mode %d", opts.Mode)
+	}
+
+	if err := d.backend.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	staging := filepath.Join(d.dir, backupPrefix+strconv.FormatInt(time.Now().UnixNano(), 10))
+	defer d.backend.RemoveAll(staging)
+
+	files, err := d.extractArchive(r, staging)
+	if err != nil {
+		return fmt.Errorf("unable to restore backup: %w", err)
+	}
+
+	existing, err := d.Collections()
+	if err != nil {
+		return err
+	}
+	involved := append([]string(nil), existing...)
+	for _, name := range files {
+		if c, ok := d.fileCollection(name); ok {
+			involved = append(involved, c)
+		}
+	}
+	sort.Strings(involved)
+
+	d.tx.Lock()
+	defer d.tx.Unlock()
+	for i, c := range involved {
+		if i > 0 && c == involved[i-1] {
+			continue
+		}
+		unlock, err := d.lockCollection(c)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	d.trash.Lock()
+	defer d.trash.Unlock()
+	defer d.resetCaches()
+
+	if opts.Mode == RestoreOverwrite {
+		entries, err := d.backend.ReadDir(d.dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if strings.HasPrefix(name, backupPrefix) || name == txDir || strings.HasSuffix(name, ".lock") {
+				continue
+			}
+			if err := d.backend.RemoveAll(filepath.Join(d.dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range files {
+		src, dst := filepath.Join(staging, filepath.FromSlash(name)), filepath.Join(d.dir, filepath.FromSlash(name))
+		if err := d.backend.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		base := path.Base(name)
+		switch {
+		case opts.Mode == RestoreMerge && base == migrationsFile:
+			continue // dropped below
+		case opts.Mode == RestoreMerge && base == expiryFile:
+			err = d.appendFile(src, dst)
+		case opts.Mode == RestoreMerge && (base == seqFile || strings.HasSuffix(base, ".seq")):
+			err = d.mergeSequence(src, dst)
+		default:
+			err = d.backend.Rename(src, dst)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Mode == RestoreMerge {
+		// merged records may be behind the versions MigrateAll recorded
+		for _, c := range involved {
+			if err := d.forgetMigrated(c); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.Mode == RestoreOverwrite || d.format != FormatJSON || d.storage != StorageFiles {
+		return nil
+	}
+
+	// the merged collections hold records the restored indexes don't cover
+	d.resetCaches()
+	for i, c := range involved {
+		if i > 0 && c == involved[i-1] {
+			continue
+		}
+		if err := d.reindex(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileCollection returns the collection a file of an archive belongs to, if
+// it is a record or log file
+func (d *Driver) fileCollection(name string) (string, bool) {
+	if d.storage == StorageAppendLog {
+		return strings.CutSuffix(name, ".log")
+	}
+	if path.Ext(name) != d.ext || path.Dir(name) == "." {
+		return "", false
+	}
+	dir := path.Dir(name)
+	for _, seg := range strings.Split(dir, "/") {
+		if strings.HasPrefix(seg, ".") || seg == historyDir {
+			return "", false
+		}
+	}
+	top, _, _ := strings.Cut(dir, "/")
+	return dir, top != trashDir && top != metaDir
+}
+
+// appendFile appends the contents of src to dst, for the append-only
+// sidecar files whose last line wins
+func (d *Driver) appendFile(src, dst string) error {
+	b, err := d.backend.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	f, err := d.backend.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mergeSequence keeps the larger of two Sequential counters, so ids handed
+// out since the backup are never handed out again
+func (d *Driver) mergeSequence(src, dst string) error {
+	read := func(p string) uint64 {
+		b, _ := d.backend.ReadFile(p)
+		n, _ := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		return n
+	}
+	if read(src) <= read(dst) {
+		return nil
+	}
+	return d.backend.Rename(src, dst)
+}
+
+// extractArchive writes the regular files of a Backup archive under dir and
+// returns their slash separated names
+func (d *Driver) extractArchive(r io.Reader, dir string) ([]string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var files []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || strings.Contains(name, `\`) {
+			return nil, fmt.Errorf("invalid file name %q in archive", hdr.Name)
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := d.backend.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		f, err := d.createFile(dst)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+		files = append(files, name)
+	}
+}
+
+// resetCaches forgets everything cached from the files, after Restore has
+// replaced them underneath
+func (d *Driver) resetCaches() {
+	d.cache.reset()
+
+	if d.blooms != nil {
+		d.blooms.mutex.Lock()
+		d.blooms.filters = make(map[string]*bloomFilter)
+		d.blooms.mutex.Unlock()
+	}
+
+	d.indexes.mutex.Lock()
+	d.indexes.collections = make(map[string]map[string]*fieldIndex)
+	d.indexes.mutex.Unlock()
+
+	d.searches.mutex.Lock()
+	d.searches.collections = make(map[string]*searchIndex)
+	d.searches.mutex.Unlock()
+
+	d.logIndexes.mutex.Lock()
+	d.logIndexes.indexes = make(map[string]map[string]int64)
+	d.logIndexes.mutex.Unlock()
+
+	d.expiries.mutex.Lock()
+	d.expiries.collections = make(map[string]map[string]time.Time)
+	d.expiries.mutex.Unlock()
+
+	d.migrations.mutex.Lock()
+	d.migrations.applied = make(map[string]int)
+	d.migrations.mutex.Unlock()
+
+	d.jsonSchemas.mutex.Lock()
+	d.jsonSchemas.collections = make(map[string]*jsonSchema)
+	d.jsonSchemas.mutex.Unlock()
+}
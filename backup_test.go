@@ -0,0 +1,152 @@
+package jsondb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		mode RestoreMode
+		want map[string]testUser // users after the restore, by resource
+	}{
+		{RestoreOverwrite, map[string]testUser{"ada": {"Ada", 36}, "bob": {"Bob", 41}}},
+		{RestoreMerge, map[string]testUser{"ada": {"Ada", 36}, "bob": {"Bob", 41}, "cy": {"Cy", 30}}},
+	}
+	for _, tt := range tests {
+		name := map[RestoreMode]string{RestoreOverwrite: "overwrite", RestoreMerge: "merge"}[tt.mode]
+		t.Run(name, func(t *testing.T) {
+			d, _ := newTestDriver(t, nil)
+			if err := d.CreateIndex("users", "Age"); err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range []testUser{{"Ada", 36}, {"Bob", 41}} {
+				if err := d.Write("users", strings.ToLower(u.Name), u); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var backup bytes.Buffer
+			if err := d.Backup(&backup); err != nil {
+				t.Fatal(err)
+			}
+
+			// changed after the backup: ada edited, bob deleted, cy and a
+			// whole collection added
+			if err := d.Write("users", "ada", testUser{"Ada", 99}); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Delete("users", "bob"); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Write("users", "cy", testUser{"Cy", 30}); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Write("teams", "red", testUser{"Red", 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.Restore(&backup, RestoreOptions{Mode: tt.mode}); err != nil {
+				t.Fatal(err)
+			}
+			records, err := d.ReadAll("users")
+			if err != nil || len(records) != len(tt.want) {
+				t.Fatalf("ReadAll() after restore = %q, %v, want %v records", records, err, len(tt.want))
+			}
+			for r, want := range tt.want {
+				var u testUser
+				if err := d.Read("users", r, &u); err != nil || u != want {
+					t.Errorf("Read(%v) after restore = %+v, %v, want %+v", r, u, err, want)
+				}
+			}
+			err = d.Read("teams", "red", &testUser{})
+			if tt.mode == RestoreOverwrite && !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read() of a collection missing from the backup = %v, want ErrNotFound", err)
+			}
+			if tt.mode == RestoreMerge && err != nil {
+				t.Errorf("Read() of a collection kept by the merge = %v", err)
+			}
+
+			// the index sees the restored records, and not the replaced ones
+			for age, want := range map[int]int{36: 1, 99: 0, 30: len(tt.want) - 2} {
+				found, err := d.Find("users", Where("Age", Eq, age))
+				if err != nil || len(found) != want {
+					t.Errorf("Find(Age == %d) after restore = %q, %v, want %d records", age, found, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	archive := func(name string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, n := range []string{"users/ada.json", name} {
+			doc := []byte(`{"Name":"Eve","Age":1}`)
+			if err := tw.WriteHeader(&tar.Header{Name: n, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(doc))}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(doc); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+		gz.Close()
+		return &buf
+	}
+
+	for _, name := range []string{"../evil.json", "users/../../evil.json", "/evil.json", `users\..\..\evil.json`} {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "db")
+			d, err := New(dir, &Options{Slog: quietSlog})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			if err := d.Write("users", "ada", testUser{"Ada", 36}); err != nil {
+				t.Fatal(err)
+			}
+
+			err = d.Restore(archive(name), RestoreOptions{Mode: RestoreOverwrite})
+			if err == nil || !strings.Contains(err.Error(), "invalid file name") {
+				t.Fatalf("Restore() of an archive holding %q = %v, want an invalid file name error", name, err)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "evil.json")); !os.IsNotExist(err) {
+				t.Errorf("file written outside the database dir: %v", err)
+			}
+			var u testUser
+			if err := d.Read("users", "ada", &u); err != nil || u != (testUser{"Ada", 36}) {
+				t.Errorf("record after a rejected restore = %+v, %v, want it unchanged", u, err)
+			}
+		})
+	}
+
+	t.Run("corrupt archive", func(t *testing.T) {
+		d, _ := newTestDriver(t, nil)
+		if err := d.Write("users", "ada", testUser{"Ada", 36}); err != nil {
+			t.Fatal(err)
+		}
+		b := archive("users/bob.json").Bytes()
+		if err := d.Restore(bytes.NewReader(b[:len(b)/2]), RestoreOptions{Mode: RestoreOverwrite}); err == nil {
+			t.Fatal("Restore() of a truncated archive succeeded")
+		}
+		if err := d.Read("users", "ada", &testUser{}); err != nil {
+			t.Errorf("record after a failed restore = %v, want it kept", err)
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		d, _ := newTestDriver(t, nil)
+		if err := d.Restore(archive("users/bob.json"), RestoreOptions{Mode: 7}); err == nil {
+			t.Error("Restore() with an invalid mode succeeded")
+		}
+	})
+}
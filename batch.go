@@ -0,0 +1,67 @@
+package jsondb
+
+import (
+	"fmt"
+	"time"
+)
+
+// WriteBatch stores every record of docs, keyed by resource, in collection
+// all or nothing: the records are staged and committed together as in a
+// Transaction, under a single hold of the collection lock, so an error or a
+// crash leaves either none of them written or, once New has replayed the
+// journal, all of them. It requires the files storage.
+func (d *Driver) WriteBatch(collection string, docs map[string]interface{}) (err error) {
+	defer d.done(OpWriteBatch, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - no place to save records", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.requireFiles("WriteBatch"); err != nil {
+		return err
+	}
+
+	tx := &Tx{d: d, staged: make(map[[2]string]int)}
+	for _, resource := range sortedKeys(docs) {
+		if err := tx.Write(collection, resource, docs[resource]); err != nil {
+			return err
+		}
+	}
+	return d.commitBatch(tx)
+}
+
+// DeleteBatch removes every record of resources from collection all or
+// nothing, as WriteBatch writes them. It fails without deleting anything if
+// one of the records doesn't exist.
+func (d *Driver) DeleteBatch(collection string, resources []string) (err error) {
+	defer d.done(OpDeleteBatch, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to delete", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.requireFiles("DeleteBatch"); err != nil {
+		return err
+	}
+
+	tx := &Tx{d: d, staged: make(map[[2]string]int)}
+	for _, resource := range resources {
+		if err := tx.Delete(collection, resource); err != nil {
+			return err
+		}
+	}
+	return d.commitBatch(tx)
+}
+
+// commitBatch commits the changes staged on tx by a batch
+func (d *Driver) commitBatch(tx *Tx) error {
+	d.tx.Lock()
+	defer d.tx.Unlock()
+
+	tx.done = true
+	return d.commit(tx)
+}
@@ -0,0 +1,85 @@
+package jsondb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteBatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(d *Driver) error
+		docs  map[string]interface{}
+		want  error // nil when the batch must be written
+	}{
+		{"written", nil, map[string]interface{}{"ada": testUser{"Ada", 36}, "cy": testUser{"Cy", 30}}, nil},
+		{"value held by a stored record", func(d *Driver) error { return d.AddUniqueConstraint("users", "Name") },
+			map[string]interface{}{"ada": testUser{"Ada", 36}, "cy": testUser{"Bob", 30}}, ErrDuplicate},
+		{"value held twice in the batch", func(d *Driver) error { return d.AddUniqueConstraint("users", "Name") },
+			map[string]interface{}{"ada": testUser{"Ann", 36}, "cy": testUser{"Ann", 30}}, ErrDuplicate},
+		{"schema violation", func(d *Driver) error {
+			return d.SetSchema("users", []byte(`{"properties": {"Age": {"maximum": 100}}}`))
+		}, map[string]interface{}{"ada": testUser{"Ada", 36}, "cy": testUser{"Cy", 300}}, ErrSchemaViolation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, dir := newTestDriver(t, nil)
+			if err := d.Write("users", "bob", testUser{"Bob", 41}); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Write("users", "ada", testUser{"Ada", 1}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				if err := tt.setup(d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := d.WriteBatch("users", tt.docs)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("WriteBatch() = %v, want %v", err, tt.want)
+			}
+			var ada testUser
+			if err := d.Read("users", "ada", &ada); err != nil {
+				t.Fatal(err)
+			}
+			err = d.Read("users", "cy", &testUser{})
+			if tt.want == nil && (ada.Age != 36 || err != nil) {
+				t.Errorf("records after the batch = %+v, %v, want both written", ada, err)
+			}
+			if tt.want != nil && (ada.Age != 1 || !errors.Is(err, ErrNotFound)) {
+				t.Errorf("records after a failed batch = %+v, %v, want none written", ada, err)
+			}
+			if entries, err := os.ReadDir(filepath.Join(dir, txDir)); err != nil && !os.IsNotExist(err) || len(entries) != 0 {
+				t.Errorf("staging dirs left after the batch: %v, %v", entries, err)
+			}
+		})
+	}
+}
+
+func TestDeleteBatch(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	for _, r := range []string{"ada", "bob", "cy"} {
+		if err := d.Write("users", r, testUser{Name: r}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.DeleteBatch("users", []string{"ada", "nobody"}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("DeleteBatch() with a missing record = %v, want os.ErrNotExist", err)
+	}
+	if err := d.Read("users", "ada", &testUser{}); err != nil {
+		t.Fatalf("record after a failed batch = %v, want it kept", err)
+	}
+
+	if err := d.DeleteBatch("users", []string{"ada", "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := d.ReadAll("users")
+	if err != nil || len(records) != 1 {
+		t.Errorf("records after DeleteBatch() = %q, %v, want only cy", records, err)
+	}
+}
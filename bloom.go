@@ -0,0 +1,154 @@
+package jsondb
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// bloomHashes is the number of bit positions set per resource
+const bloomHashes = 4
+
+// bloomFilter answers "definitely absent" or "maybe present" for resources of
+// one collection. In counting mode each position is a counter, so deletes can
+// be taken back out.
+type bloomFilter struct {
+	bits     []uint64 // plain mode
+	counters []uint8  // counting mode
+	size     uint64
+}
+
+func newBloomFilter(size uint, counting bool) *bloomFilter {
+	f := &bloomFilter{size: uint64(size)}
+	if counting {
+		f.counters = make([]uint8, size)
+	} else {
+		f.bits = make([]uint64, (size+63)/64)
+	}
+	return f
+}
+
+// positions derives the filter positions of a resource by double hashing
+func (f *bloomFilter) positions(resource string) [bloomHashes]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(resource))
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31 | 1
+
+	var p [bloomHashes]uint64
+	for i := range p {
+		p[i] = (h1 + uint64(i)*h2) % f.size
+	}
+	return p
+}
+
+func (f *bloomFilter) add(resource string) {
+	for _, p := range f.positions(resource) {
+		if f.counters != nil {
+			if f.counters[p] < 255 {
+				f.counters[p]++
+			}
+		} else {
+			f.bits[p/64] |= 1 << (p % 64)
+		}
+	}
+}
+
+// remove only has an effect in counting mode. Saturated counters are left
+// alone since their true count is unknown.
+func (f *bloomFilter) remove(resource string) {
+	if f.counters == nil {
+		return
+	}
+	for _, p := range f.positions(resource) {
+		if c := f.counters[p]; c > 0 && c < 255 {
+			f.counters[p]--
+		}
+	}
+}
+
+func (f *bloomFilter) mayContain(resource string) bool {
+	for _, p := range f.positions(resource) {
+		if f.counters != nil {
+			if f.counters[p] == 0 {
+				return false
+			}
+		} else if f.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomFilters holds the filter of every collection seen since New. A
+// collection's filter is seeded from disk the first time Exists needs it;
+// until then writes and deletes don't have to maintain it.
+type bloomFilters struct {
+	mutex    sync.Mutex
+	size     uint
+	counting bool
+	filters  map[string]*bloomFilter
+}
+
+func (b *bloomFilters) added(collection, resource string) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if f, ok := b.filters[collection]; ok {
+		f.add(resource)
+	}
+}
+
+func (b *bloomFilters) removed(collection, resource string) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if f, ok := b.filters[collection]; ok {
+		f.remove(resource)
+	}
+}
+
+// dropped forgets a collection's filter after the whole collection is deleted
+func (b *bloomFilters) dropped(collection string) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.filters, collection)
+}
+
+// bloomMayContain consults the collection filter, seeding it first if needed.
+// The caller must hold the collection mutex.
+func (d *Driver) bloomMayContain(collection, resource string) (bool, error) {
+	b := d.blooms
+	b.mutex.Lock()
+	f, ok := b.filters[collection]
+	b.mutex.Unlock()
+
+	if !ok {
+		names, err := d.resourceNames(collection)
+		if err != nil {
+			return false, err
+		}
+
+		f = newBloomFilter(b.size, b.counting)
+		for _, name := range names {
+			f.add(name)
+		}
+
+		b.mutex.Lock()
+		b.filters[collection] = f
+		b.mutex.Unlock()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return f.mayContain(resource), nil
+}
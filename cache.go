@@ -0,0 +1,147 @@
+package jsondb
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// recordCache is the read-through LRU cache of Options.CacheSize, holding
+// the decrypted, decompressed bytes of recently read records
+type recordCache struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List // of *cacheEntry, most recently used first
+	entries map[cacheKey]*list.Element
+
+	// generation counts invalidations, so a read racing a write can't put
+	// back the record the write just replaced
+	generation uint64
+}
+
+type cacheKey struct {
+	collection, resource string
+}
+
+type cacheEntry struct {
+	key cacheKey
+	b   []byte
+}
+
+func newRecordCache(size int) *recordCache {
+	return &recordCache{size: size, order: list.New(), entries: make(map[cacheKey]*list.Element)}
+}
+
+// get returns a copy of a cached record
+func (c *recordCache) get(collection, resource string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[cacheKey{collection, resource}]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return append([]byte(nil), e.Value.(*cacheEntry).b...), true
+}
+
+// current returns the generation to pass to add for a record about to be read
+func (c *recordCache) current() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+// add caches a copy of a record read at generation, unless something was
+// invalidated since
+func (c *recordCache) add(generation uint64, collection, resource string, b []byte) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	key := cacheKey{collection, resource}
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).b = append([]byte(nil), b...)
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, append([]byte(nil), b...)})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate forgets a record, or with an empty resource every record of the
+// collection and of the collections nested in it
+func (c *recordCache) invalidate(collection, resource string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	if resource != "" {
+		if e, ok := c.entries[cacheKey{collection, resource}]; ok {
+			c.order.Remove(e)
+			delete(c.entries, e.Value.(*cacheEntry).key)
+		}
+		return
+	}
+	for key, e := range c.entries {
+		if key.collection == collection || strings.HasPrefix(key.collection, collection+"/") {
+			c.order.Remove(e)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// reset forgets every record
+func (c *recordCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	c.order.Init()
+	c.entries = make(map[cacheKey]*list.Element)
+}
+
+// cachedRead returns a record from the cache, or reads it with read and
+// caches it, counting hits and misses in Stats and Options.Metrics
+func (d *Driver) cachedRead(collection, resource string, read func() ([]byte, error)) ([]byte, error) {
+	if d.cache == nil {
+		return read()
+	}
+	b, ok := d.cache.get(collection, resource)
+	if d.metrics != nil {
+		d.metrics.ObserveCache(ok)
+	}
+	if ok {
+		d.stats.cacheHits.Add(1)
+		return b, nil
+	}
+	d.stats.cacheMisses.Add(1)
+
+	generation := d.cache.current()
+	b, err := read()
+	if err == nil {
+		d.cache.add(generation, collection, resource, b)
+	}
+	return b, err
+}
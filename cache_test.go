@@ -0,0 +1,90 @@
+package jsondb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheInvalidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(d *Driver) error
+		want   *testUser // users/admins/cy after the change, nil when gone
+	}{
+		{"Write", func(d *Driver) error { return d.Write("users/admins", "cy", testUser{"Cy", 31}) }, &testUser{"Cy", 31}},
+		{"Patch", func(d *Driver) error { return d.Patch("users/admins", "cy", []byte(`{"Age":31}`), MergePatch) }, &testUser{"Cy", 31}},
+		{"WriteBatch", func(d *Driver) error {
+			return d.WriteBatch("users/admins", map[string]interface{}{"cy": testUser{"Cy", 31}})
+		}, &testUser{"Cy", 31}},
+		{"Transaction", func(d *Driver) error {
+			return d.Transaction(func(tx *Tx) error { return tx.Write("users/admins", "cy", testUser{"Cy", 31}) })
+		}, &testUser{"Cy", 31}},
+		{"Delete", func(d *Driver) error { return d.Delete("users/admins", "cy") }, nil},
+		{"DeleteBatch", func(d *Driver) error { return d.DeleteBatch("users/admins", []string{"cy"}) }, nil},
+		{"DropCollection", func(d *Driver) error { return d.DropCollection("users/admins", true) }, nil},
+		{"DropCollection of the parent", func(d *Driver) error { return d.DropCollection("users", true) }, nil},
+		{"RenameResource", func(d *Driver) error { return d.RenameResource("users/admins", "cy", "dan") }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDriver(t, &Options{CacheSize: 10})
+			if err := d.Write("users/admins", "cy", testUser{"Cy", 30}); err != nil {
+				t.Fatal(err)
+			}
+			var u testUser
+			for i := 0; i < 2; i++ {
+				if err := d.Read("users/admins", "cy", &u); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if s := d.Stats(); s.CacheHits != 1 || s.CacheMisses != 1 {
+				t.Fatalf("Stats() after two reads = %d hits, %d misses, want 1 and 1", s.CacheHits, s.CacheMisses)
+			}
+
+			if err := tt.change(d); err != nil {
+				t.Fatal(err)
+			}
+			u = testUser{}
+			err := d.Read("users/admins", "cy", &u)
+			if tt.want == nil && !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read() after %v = %+v, %v, want ErrNotFound", tt.name, u, err)
+			}
+			if tt.want != nil && (err != nil || u != *tt.want) {
+				t.Errorf("Read() after %v = %+v, %v, want %+v", tt.name, u, err, *tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	d, dir := newTestDriver(t, &Options{CacheSize: 2})
+	for i := 0; i < 3; i++ {
+		if err := d.Write("users", fmt.Sprint(i), testUser{Age: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range []string{"0", "1", "0", "2"} { // evicts 1
+		if err := d.Read("users", r, &testUser{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// edits behind the driver's back show which records were cached
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(filepath.Join(dir, "users", fmt.Sprint(i)+".json"), []byte(`{"Age":99}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		r    string
+		want int
+	}{{"0", 0}, {"2", 2}, {"1", 99}} {
+		var u testUser
+		if err := d.Read("users", tt.r, &u); err != nil || u.Age != tt.want {
+			t.Errorf("Read(%v) = %+v, %v, want age %d", tt.r, u, err, tt.want)
+		}
+	}
+}
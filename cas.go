@@ -0,0 +1,38 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConflict is returned by WriteIfRevision when the stored record isn't at
+// the expected revision
+var ErrConflict = errors.New("revision conflict")
+
+// WriteIfRevision writes v like Write, but only if the stored record is at
+// revision expectedRev, checked under the collection lock; otherwise it fails
+// with an error wrapping ErrConflict and leaves the record unchanged. An
+// expectedRev of 0 expects the record not to exist. Read the revision with
+// ReadWithMeta, then retry the read-modify-write on a conflict. It requires
+// Options.Metadata.
+func (d *Driver) WriteIfRevision(collection, resource string, v interface{}, expectedRev uint64) (err error) {
+	defer d.done(OpWriteIfRevision, collection, resource, time.Now(), &err)
+
+	if !d.metadata {
+		return fmt.Errorf("WriteIfRevision requires Options.Metadata")
+	}
+
+	return d.update(collection, resource, func(current json.RawMessage, found bool) (interface{}, error) {
+		var rev uint64
+		if found {
+			meta, _ := d.recordMeta(current)
+			rev = meta.Revision
+		}
+		if !found && expectedRev != 0 || found && rev != expectedRev {
+			return nil, fmt.Errorf("%w: %v in %v is at revision %d, expected %d", ErrConflict, resource, collection, rev, expectedRev)
+		}
+		return v, nil
+	})
+}
@@ -0,0 +1,87 @@
+// Command demo writes a few users into a database under the current
+// directory, reads them back and deletes one. The users collection next to
+// it holds the records a run from this directory leaves behind.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsondb "github.com/JJFelix/go-json-database"
+)
+
+type Address struct {
+	City    string
+	State   string
+	Country string
+	Pincode json.Number
+}
+
+type User struct {
+	Name    string
+	Age     json.Number
+	Contact string
+	Company string
+	Address Address
+}
+
+func main() {
+	dir := "./" // where files will reside
+
+	db, err := jsondb.New(dir, nil)
+	if err != nil {
+		fmt.Println("Error: ", err)
+	}
+
+	// Hard-coding values into the db
+	// you can create an api to send the data directly
+
+	employees := []User{
+		{"John", "23", "+254701028374", "IFAware Technologies", Address{"Nairobi City", "Nairobi", "Kenya", "00100"}},
+		{"James", "25", "+1741628374", "Google", Address{"San Francisco", "California", "USA", "20409"}},
+		{"Pedro", "22", "+1771828374", "Microsoft", Address{"Palo Alto", "California", "USA", "43693"}},
+		{"Cole", "21", "+54751088374", "Amazon", Address{"Lisbon City", "Lisbon", "Portugal", "39100"}},
+		{"Malo", "20", "+67706028974", "OpenAI", Address{"Oslo", "Greater Oslo", "Sweden", "94630"}},
+		{"Nico", "22", "+18702028376", "Netflix", Address{"Moscow", "West Russia", "Russia", "42321"}},
+	}
+
+	// write into db
+	for _, value := range employees {
+		db.Write("users", value.Name, User{
+			Name:    value.Name,
+			Age:     value.Age,
+			Contact: value.Contact,
+			Company: value.Company,
+			Address: value.Address,
+		})
+	}
+
+	// Read DB function
+	records, err := db.ReadAll("users")
+	if err != nil {
+		fmt.Println("Error: ", err)
+	}
+	fmt.Println(records) // records are in json format
+
+	allusers := []User{}
+
+	// unmarshal from json to go-understandable
+	for _, f := range records {
+		employeeFound := User{}
+		if err := json.Unmarshal([]byte(f), &employeeFound); err != nil {
+			fmt.Println("Error:", err)
+		}
+		allusers = append(allusers, employeeFound)
+	}
+	fmt.Println(allusers)
+
+	// db delete
+	if err := db.Delete("users", "Malo"); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	// if err := db.Delete("users", ""); err != nil{
+	// 	fmt.Println("Error:", err)
+	// }
+
+}
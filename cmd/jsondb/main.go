@@ -0,0 +1,342 @@
+// Command jsondb inspects and changes a database from the command line:
+//
+//	jsondb [-dir path] [-key-env VAR] <command> [arguments]
+//
+// The commands are
+//
+//	ls [collection]                       list the collections, or the records of one
+//	get <collection> <resource>           print a record
+//	put <collection> <resource> [file]    write a record from file, or stdin
+//	delete <collection> [resource]        delete a record, or a whole collection
+//	find [-where cond]... [-sort s] [-offset n] [-limit n] [-fields f,g] <collection>
+//	export [-format ndjson|csv|parquet] <collection>        write a collection to stdout
+//	import [-format ndjson|csv] [-key field] <collection> [file]
+//	backup [file]                         write a tar.gz backup to file, or stdout
+//	restore [-merge] [file]               restore a backup from file, or stdin
+//	gen-types [-out file] [-pkg name] [-type Name] [-sample n] <collection>
+//	                                      write Go types for the records of a collection
+//
+// Conditions are written as in jsondb.ParseCondition: -where 'Age>=30'. The
+// flags of gen-types may also follow the collection:
+//
+//	jsondb gen-types users -out user_gen.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	jsondb "github.com/JJFelix/go-json-database"
+	"github.com/jcelliott/lumber"
+)
+
+func main() {
+	global := flag.NewFlagSet("jsondb", flag.ExitOnError)
+	dir := global.String("dir", ".", "database directory")
+	keyEnv := global.String("key-env", "", "environment variable holding the base64 encryption key")
+	global.Usage = usage
+	global.Parse(os.Args[1:])
+
+	if global.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	opts := &jsondb.Options{Logger: lumber.NewConsoleLogger(lumber.WARN)}
+	if *keyEnv != "" {
+		opts.Encryption = jsondb.EnvKey(*keyEnv)
+	}
+	db, err := jsondb.New(*dir, opts)
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	cmd, args := global.Arg(0), global.Args()[1:]
+	run, ok := commands[cmd]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "jsondb: unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err := run(db, args); err != nil {
+		fatal(err)
+	}
+}
+
+var commands = map[string]func(*jsondb.Driver, []string) error{
+	"ls":        ls,
+	"get":       get,
+	"put":       put,
+	"delete":    del,
+	"find":      find,
+	"export":    export,
+	"import":    importRecords,
+	"backup":    backup,
+	"restore":   restore,
+	"gen-types": genTypes,
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: jsondb [-dir path] [-key-env VAR] <command> [arguments]
+
+commands:
+  ls [collection]
+  get <collection> <resource>
+  put <collection> <resource> [file]
+  delete <collection> [resource]
+  find [-where cond]... [-sort s] [-offset n] [-limit n] [-fields f,g] <collection>
+  export [-format ndjson|csv|parquet] <collection>
+  import [-format ndjson|csv] [-key field] <collection> [file]
+  backup [file]
+  restore [-merge] [file]
+  gen-types [-out file] [-pkg name] [-type Name] [-sample n] <collection>
+`)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "jsondb:", err)
+	os.Exit(1)
+}
+
+// needArgs checks the count of positional arguments
+func needArgs(args []string, min, max int, syntax string) error {
+	if len(args) < min || len(args) > max {
+		return fmt.Errorf("usage: jsondb %s", syntax)
+	}
+	return nil
+}
+
+// input opens the named file, or stdin for none or "-"
+func input(args []string, i int) (io.ReadCloser, error) {
+	if len(args) <= i || args[i] == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(args[i])
+}
+
+func ls(db *jsondb.Driver, args []string) error {
+	if err := needArgs(args, 0, 1, "ls [collection]"); err != nil {
+		return err
+	}
+	var names []string
+	var err error
+	if len(args) == 0 {
+		names, err = db.Collections()
+	} else {
+		names, err = db.Keys(args[0])
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return err
+}
+
+func get(db *jsondb.Driver, args []string) error {
+	if err := needArgs(args, 2, 2, "get <collection> <resource>"); err != nil {
+		return err
+	}
+	var record json.RawMessage
+	if err := db.Read(args[0], args[1], &record); err != nil {
+		return err
+	}
+	fmt.Println(string(record))
+	return nil
+}
+
+func put(db *jsondb.Driver, args []string) error {
+	if err := needArgs(args, 2, 3, "put <collection> <resource> [file]"); err != nil {
+		return err
+	}
+	in, err := input(args, 2)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(b) {
+		return errors.New("record is not valid JSON")
+	}
+	return db.Write(args[0], args[1], json.RawMessage(b))
+}
+
+func del(db *jsondb.Driver, args []string) error {
+	if err := needArgs(args, 1, 2, "delete <collection> [resource]"); err != nil {
+		return err
+	}
+	resource := ""
+	if len(args) == 2 {
+		resource = args[1]
+	}
+	return db.Delete(args[0], resource)
+}
+
+// conditions collects repeated -where flags
+type conditions []jsondb.Condition
+
+func (c *conditions) String() string { return fmt.Sprint(*c) }
+
+func (c *conditions) Set(s string) error {
+	cond, err := jsondb.ParseCondition(s)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, cond)
+	return nil
+}
+
+func find(db *jsondb.Driver, args []string) error {
+	fs := flag.NewFlagSet("find", flag.ExitOnError)
+	var where conditions
+	fs.Var(&where, "where", "condition such as 'Age>=30', repeatable")
+	sort := fs.String("sort", "", "sort fields such as 'Age desc, Name'")
+	offset := fs.Int("offset", 0, "records to skip")
+	limit := fs.Int("limit", 0, "most records to print, 0 for all")
+	fields := fs.String("fields", "", "comma separated fields to keep")
+	fs.Parse(args)
+
+	if err := needArgs(fs.Args(), 1, 1, "find [flags] <collection>"); err != nil {
+		return err
+	}
+	opts := jsondb.ListOptions{Sort: *sort, Offset: *offset, Limit: *limit}
+	if *fields != "" {
+		opts.Fields = strings.Split(*fields, ",")
+	}
+
+	records, err := db.FindWithOptions(fs.Arg(0), jsondb.Query{Conditions: where}, opts)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		fmt.Println(string(r))
+	}
+	return nil
+}
+
+func export(db *jsondb.Driver, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", string(jsondb.ExportNDJSON), "ndjson, csv or parquet")
+	fs.Parse(args)
+
+	if err := needArgs(fs.Args(), 1, 1, "export [-format ndjson|csv|parquet] <collection>"); err != nil {
+		return err
+	}
+	if *format == "parquet" {
+		return db.ExportParquet(fs.Arg(0), os.Stdout)
+	}
+	return db.ExportCollection(fs.Arg(0), jsondb.ExportFormat(*format), os.Stdout)
+}
+
+func importRecords(db *jsondb.Driver, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", string(jsondb.ExportNDJSON), "ndjson or csv")
+	key := fs.String("key", "", "field naming each record; empty generates ids")
+	fs.Parse(args)
+
+	if err := needArgs(fs.Args(), 1, 2, "import [-format ndjson|csv] [-key field] <collection> [file]"); err != nil {
+		return err
+	}
+	in, err := input(fs.Args(), 1)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	n, err := db.ImportCollection(fs.Arg(0), jsondb.ExportFormat(*format), in, *key)
+	fmt.Fprintf(os.Stderr, "imported %d records\n", n)
+	return err
+}
+
+func backup(db *jsondb.Driver, args []string) error {
+	if err := needArgs(args, 0, 1, "backup [file]"); err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] == "-" {
+		return db.Backup(os.Stdout)
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := db.Backup(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func restore(db *jsondb.Driver, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	merge := fs.Bool("merge", false, "keep the records missing from the backup")
+	fs.Parse(args)
+
+	if err := needArgs(fs.Args(), 0, 1, "restore [-merge] [file]"); err != nil {
+		return err
+	}
+	in, err := input(fs.Args(), 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	opts := jsondb.RestoreOptions{Mode: jsondb.RestoreOverwrite}
+	if *merge {
+		opts.Mode = jsondb.RestoreMerge
+	}
+	return db.Restore(in, opts)
+}
+
+func genTypes(db *jsondb.Driver, args []string) error {
+	fs := flag.NewFlagSet("gen-types", flag.ExitOnError)
+	out := fs.String("out", "", "file to write, stdout when empty")
+	pkg := fs.String("pkg", "main", "package of the generated file")
+	typeName := fs.String("type", "", "name of the record type, from the collection when empty")
+	sample := fs.Int("sample", 0, "records to inspect, 0 for all")
+	syntax := "gen-types [-out file] [-pkg name] [-type Name] [-sample n] <collection>"
+	fs.Parse(args)
+
+	// flags may follow the collection too, as in gen-types users -out user_gen.go
+	collection := fs.Arg(0)
+	if fs.NArg() > 0 {
+		fs.Parse(fs.Args()[1:])
+	}
+	if collection == "" || fs.NArg() > 0 {
+		return needArgs(nil, 1, 1, syntax)
+	}
+	if *typeName == "" {
+		*typeName = path.Base(collection)
+	}
+
+	schema, err := db.InferSchema(collection, *sample)
+	if err != nil {
+		return err
+	}
+	if schema.Sampled == 0 {
+		return fmt.Errorf("unable to generate types for %v - it holds no records", collection)
+	}
+	if *out == "" {
+		return jsondb.GenerateGoTypes(schema, *pkg, *typeName, os.Stdout)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := jsondb.GenerateGoTypes(schema, *pkg, *typeName, f); err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,58 @@
+package jsondb
+
+import "fmt"
+
+// Collection gives typed access to the records of one collection, all of
+// which hold a T
+type Collection[T any] struct {
+	d    *Driver
+	name string
+}
+
+// NewCollection binds the collection name to the record type T
+func NewCollection[T any](d *Driver, name string) *Collection[T] {
+	return &Collection[T]{d: d, name: name}
+}
+
+// Name returns the name of the collection
+func (c *Collection[T]) Name() string {
+	return c.name
+}
+
+// Get returns the record stored under resource
+func (c *Collection[T]) Get(resource string) (T, error) {
+	var v T
+	err := c.d.Read(c.name, resource, &v)
+	return v, err
+}
+
+// All returns every record of the collection, in ReadAll order
+func (c *Collection[T]) All() ([]T, error) {
+	records, err := c.d.ReadAll(c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]T, 0, len(records))
+	for _, record := range records {
+		var v T
+		if err := c.d.decode([]byte(record), &v); err != nil {
+			return nil, fmt.Errorf("unable to decode record of %v: %w", c.name, err)
+		}
+		all = append(all, v)
+	}
+	return all, nil
+}
+
+// Put stores v under resource, replacing any record of the same name
+func (c *Collection[T]) Put(resource string, v T) error {
+	return c.d.Write(c.name, resource, v)
+}
+
+// Delete removes the record stored under resource
+func (c *Collection[T]) Delete(resource string) error {
+	if resource == "" {
+		return fmt.Errorf("%w - unable to delete record (no name)", ErrEmptyResource)
+	}
+	return c.d.Delete(c.name, resource)
+}
@@ -0,0 +1,284 @@
+package jsondb
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Collections returns the names of the collections in the database, sorted.
+// Nested collections are listed by their full name ("a/b"), and a collection
+// whose records were all deleted is still listed until it is dropped.
+func (d *Driver) Collections() (names []string, err error) {
+	defer d.done(OpCollections, "", "", time.Now(), &err)
+
+	err = d.walkDir(d.dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == d.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if e.IsDir() {
+			if rel == trashDir || rel == metaDir || e.Name() == historyDir || strings.HasPrefix(e.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if d.storage == StorageFiles {
+				names = append(names, rel)
+			}
+			return nil
+		}
+		if name, ok := strings.CutSuffix(rel, ".log"); ok && d.storage == StorageAppendLog {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// DropCollection removes a collection and the collections nested in it. It
+// refuses a collection that still holds records unless force is set. With
+// Options.TrashRetention the records go to the trash, as with Delete.
+func (d *Driver) DropCollection(collection string, force bool) (err error) {
+	defer d.done(OpDropCollection, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to drop collection", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if !force {
+		names, err := d.resourceNames(collection)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return fmt.Errorf("unable to drop %v - collection is not empty (%d records), force to drop it", collection, len(names))
+		}
+	}
+
+	if d.storage == StorageAppendLog {
+		if err := d.backend.Remove(d.logPath(collection)); err != nil {
+			return notFound(collection, "", err)
+		}
+		if err := d.backend.Remove(d.seqPath(collection)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		d.blooms.dropped(collection)
+		d.changed(Deleted, collection, "", nil)
+		return d.dropLogIndex(collection)
+	}
+
+	dir := filepath.Join(d.dir, collection)
+	if fi, err := d.backend.Stat(dir); err != nil || !fi.IsDir() {
+		if err == nil {
+			err = os.ErrNotExist
+		}
+		return notFound(collection, "", err)
+	}
+
+	d.blooms.dropped(collection)
+	d.dropIndexes(collection)
+	d.dropExpiries(collection)
+	d.dropMigrated(collection)
+	if d.trashRetention > 0 {
+		err = d.trashCollection(collection)
+	} else {
+		err = d.backend.RemoveAll(dir)
+	}
+	if err == nil {
+		d.changed(Deleted, collection, "", nil)
+	}
+	return err
+}
+
+// RenameCollection renames a collection, which must exist, to a name that
+// must not. Both names are locked for the rename. Collections nested in the
+// old one move along with it, without being locked.
+func (d *Driver) RenameCollection(oldName, newName string) (err error) {
+	defer d.done(OpRenameCollection, oldName, "", time.Now(), &err)
+
+	if oldName == "" || newName == "" {
+		return fmt.Errorf("%w - unable to rename collection", ErrEmptyCollection)
+	}
+	for _, c := range []string{oldName, newName} {
+		if err := d.validateCollection(c); err != nil {
+			return err
+		}
+	}
+	oldClean, newClean := filepath.ToSlash(filepath.Clean(oldName)), filepath.ToSlash(filepath.Clean(newName))
+	if oldClean == newClean || strings.HasPrefix(newClean, oldClean+"/") {
+		return fmt.Errorf("unable to rename %v to %v - it would contain itself", oldName, newName)
+	}
+
+	// lock in name order so two crossed renames can't deadlock
+	first, second := oldName, newName
+	if second < first {
+		first, second = second, first
+	}
+	for _, c := range []string{first, second} {
+		unlock, err := d.lockCollection(c)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	src, dst := filepath.Join(d.dir, oldName), filepath.Join(d.dir, newName)
+	if d.storage == StorageAppendLog {
+		src, dst = d.logPath(oldName), d.logPath(newName)
+	}
+	if _, err := d.backend.Stat(src); err != nil {
+		return notFound(oldName, "", err)
+	}
+	if _, err := d.backend.Stat(dst); err == nil {
+		return fmt.Errorf("unable to rename %v to %v - collection already exists", oldName, newName)
+	}
+
+	if err := d.backend.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := d.backend.Rename(src, dst); err != nil {
+		return err
+	}
+	if d.storage == StorageAppendLog {
+		if err := d.backend.Rename(d.seqPath(oldName), d.seqPath(newName)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	d.blooms.dropped(oldName)
+	d.blooms.dropped(newName)
+	d.changed(Deleted, oldName, "", nil)
+	if d.storage == StorageAppendLog {
+		if err := d.dropLogIndex(oldName); err != nil {
+			return err
+		}
+		return d.dropLogIndex(newName)
+	}
+	d.dropIndexes(oldName)
+	d.dropIndexes(newName)
+	d.dropExpiries(oldName)
+	d.dropExpiries(newName)
+	d.dropMigrated(oldName)
+	d.dropMigrated(newName)
+	return nil
+}
+
+// RenameResource renames a record of a collection to a name that must not be
+// taken. The record file is renamed atomically under the collection lock;
+// with the appendlog storage the record is appended under the new name and
+// deleted under the old one.
+func (d *Driver) RenameResource(collection, oldName, newName string) (err error) {
+	defer d.done(OpRenameResource, collection, oldName, time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to rename record", ErrEmptyCollection)
+	}
+	if oldName == "" || newName == "" {
+		return fmt.Errorf("%w - unable to rename record (no name)", ErrEmptyResource)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	for _, name := range []string{oldName, newName} {
+		if err := d.validateResource(name); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	b, err := d.readRaw(collection, oldName)
+	if err != nil {
+		return notFound(collection, oldName, err)
+	}
+	if _, err := d.readRaw(collection, newName); err == nil {
+		return fmt.Errorf("unable to rename %v to %v in %v - record already exists", oldName, newName, collection)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if d.storage == StorageAppendLog {
+		if err := d.writeLogDoc(collection, newName, b); err != nil {
+			return err
+		}
+		if err := d.appendLog(collection, logEntry{Key: oldName, Deleted: true}); err != nil {
+			return err
+		}
+		d.blooms.removed(collection, oldName)
+		d.changed(Deleted, collection, oldName, nil)
+		return nil
+	}
+
+	stored, err := d.pack(collection, b)
+	if err != nil {
+		return err
+	}
+	clearNew, err := d.logWAL(collection, walEntry{Resource: newName, Record: stored})
+	if err != nil {
+		return err
+	}
+	defer clearNew()
+	clearOld, err := d.logWAL(collection, walEntry{Resource: oldName, Deleted: true})
+	if err != nil {
+		return err
+	}
+	defer clearOld()
+
+	dir := filepath.Join(d.dir, collection)
+	if err := d.backend.Rename(filepath.Join(dir, oldName+d.ext), filepath.Join(dir, newName+d.ext)); err != nil {
+		return err
+	}
+	at, err := d.expiresAt(collection, oldName)
+	if err != nil {
+		return err
+	}
+	if err := d.setExpiry(collection, newName, at); err != nil {
+		return err
+	}
+	if err := d.setExpiry(collection, oldName, time.Time{}); err != nil {
+		return err
+	}
+
+	d.blooms.removed(collection, oldName)
+	d.blooms.added(collection, newName)
+	d.changed(Deleted, collection, oldName, nil)
+	d.written(collection, newName, false, b)
+	if d.format == FormatJSON {
+		d.indexRecord(collection, oldName, nil)
+		d.indexRecord(collection, newName, b)
+	}
+	return nil
+}
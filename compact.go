@@ -0,0 +1,356 @@
+package jsondb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CompactionStats reports what Compact cleaned up
+type CompactionStats struct {
+	TempFiles      int   // temp files left behind by crashed writes, removed
+	ExpiredRecords int   // records whose TTL had passed, removed
+	Revisions      int   // history versions HistoryOptions no longer keeps, removed
+	Indexes        int   // index files and append logs rewritten without their stale lines
+	EmptyDirs      int   // collection dirs left without any file, removed
+	ReclaimedBytes int64 // what the collections' files shrank by
+}
+
+func (s *CompactionStats) add(o CompactionStats) {
+	s.TempFiles += o.TempFiles
+	s.ExpiredRecords += o.ExpiredRecords
+	s.Revisions += o.Revisions
+	s.Indexes += o.Indexes
+	s.EmptyDirs += o.EmptyDirs
+	s.ReclaimedBytes += o.ReclaimedBytes
+}
+
+// Compact cleans up the storage of every collection: it removes the temp
+// files of writes a crash interrupted, the records whose TTL has passed, the
+// history versions the collection's HistoryOptions no longer keep, such as
+// those over MaxAge a record was never written again after, and the dirs of
+// collections left empty. It rewrites index files, search indexes and
+// append logs that updates have grown with stale lines. Each collection is
+// locked while it is compacted. Histories of deleted records are kept, as
+// they are by writes. See Options.MaintenanceInterval to run it
+// periodically.
+func (d *Driver) Compact() (stats CompactionStats, err error) {
+	defer d.done(OpCompact, "", "", time.Now(), &err)
+
+	collections, err := d.Collections()
+	if err != nil {
+		return stats, err
+	}
+	// nested collections first, so their parents may be left empty
+	sort.Sort(sort.Reverse(sort.StringSlice(collections)))
+
+	for _, c := range collections {
+		s, err := d.compactCollection(c)
+		stats.add(s)
+		if err != nil {
+			return stats, fmt.Errorf("unable to compact %v: %w", c, err)
+		}
+	}
+	return stats, nil
+}
+
+func (d *Driver) compactCollection(collection string) (stats CompactionStats, err error) {
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return stats, err
+	}
+	defer unlock()
+
+	if d.storage == StorageAppendLog {
+		return d.compactLogCollection(collection)
+	}
+
+	before, err := d.ownSize(collection)
+	if err != nil {
+		return stats, err
+	}
+	defer func() {
+		if err == nil {
+			var after int64
+			after, err = d.ownSize(collection)
+			stats.ReclaimedBytes = before - after
+		}
+	}()
+
+	if stats.TempFiles, err = d.removeTempFiles(collection); err != nil {
+		return stats, err
+	}
+	if stats.ExpiredRecords, err = d.removeExpiredLocked(collection); err != nil {
+		return stats, err
+	}
+	if stats.Revisions, err = d.compactHistory(collection); err != nil {
+		return stats, err
+	}
+	if d.format == FormatJSON {
+		if stats.Indexes, err = d.compactIndexes(collection); err != nil {
+			return stats, err
+		}
+	}
+
+	removed, err := d.removeEmptyCollection(collection)
+	if removed {
+		stats.EmptyDirs++
+	}
+	return stats, err
+}
+
+// compactLogCollection compacts an append-log collection: its temp files
+// and the log itself. The caller must hold the collection mutex.
+func (d *Driver) compactLogCollection(collection string) (stats CompactionStats, err error) {
+	path := d.logPath(collection)
+	for _, p := range []string{path + d.tmpSuffix, d.idxPath(collection) + d.tmpSuffix} {
+		fi, err := d.backend.Stat(p)
+		if err != nil {
+			continue
+		}
+		if err := d.backend.Remove(p); err != nil && !os.IsNotExist(err) {
+			return stats, err
+		}
+		stats.TempFiles++
+		stats.ReclaimedBytes += fi.Size()
+	}
+
+	fi, err := d.backend.Stat(path)
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	if err := d.compactLog(collection); err != nil {
+		return stats, err
+	}
+	after, err := d.backend.Stat(path)
+	if err != nil {
+		return stats, err
+	}
+	if after.Size() < fi.Size() {
+		stats.Indexes++
+		stats.ReclaimedBytes += fi.Size() - after.Size()
+	}
+	return stats, nil
+}
+
+// ownDir reports whether a subdir of a collection dir belongs to the
+// collection, rather than being a collection nested in it
+func ownDir(name string) bool {
+	return name == historyDir || strings.HasPrefix(name, ".")
+}
+
+// walkOwn walks the files of a collection, skipping nested collections
+func (d *Driver) walkOwn(collection string, fn func(path string, e fs.DirEntry) error) error {
+	root := filepath.Join(d.dir, collection)
+	return d.walkDir(root, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if e.IsDir() {
+			if filepath.Dir(path) == root && !ownDir(e.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, e)
+	})
+}
+
+// ownSize adds up the size of a collection's files
+func (d *Driver) ownSize(collection string) (int64, error) {
+	var size int64
+	err := d.walkOwn(collection, func(path string, e fs.DirEntry) error {
+		fi, err := e.Info()
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
+
+// removeTempFiles removes the temp files in a collection's dirs; with the
+// collection mutex held, no write is using them
+func (d *Driver) removeTempFiles(collection string) (int, error) {
+	n := 0
+	err := d.walkOwn(collection, func(path string, e fs.DirEntry) error {
+		if !strings.HasSuffix(e.Name(), d.tmpSuffix) {
+			return nil
+		}
+		if err := d.backend.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// compactHistory prunes the histories of a collection to what its
+// HistoryOptions keep, removing the dirs it empties
+func (d *Driver) compactHistory(collection string) (int, error) {
+	h := d.history(collection)
+	if h == nil {
+		return 0, nil
+	}
+	dir := filepath.Join(d.dir, collection, historyDir)
+	files, err := d.backend.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		revisions, err := d.revisions(collection, file.Name())
+		if err != nil {
+			return n, err
+		}
+		removed, err := d.pruneHistory(collection, file.Name(), revisions, *h)
+		n += removed
+		if err != nil {
+			return n, err
+		}
+		if _, err := d.removeIfEmpty(filepath.Join(dir, file.Name())); err != nil {
+			return n, err
+		}
+	}
+	_, err = d.removeIfEmpty(dir)
+	return n, err
+}
+
+// compactIndexes rewrites the index files and search index of a collection
+// holding more lines than they have entries, returning how many it rewrote
+func (d *Driver) compactIndexes(collection string) (int, error) {
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for field, x := range indexes {
+		stale, err := d.staleLines(d.indexPath(collection, field), len(x.keys))
+		if err != nil {
+			return n, err
+		}
+		if !stale {
+			continue
+		}
+		if err := d.writeIndexFile(collection, field, x); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	search, err := d.loadSearch(collection)
+	if err != nil || search == nil {
+		return n, err
+	}
+	stale, err := d.staleLines(d.searchPath(collection), len(search.resources)+1)
+	if err != nil || !stale {
+		return n, err
+	}
+	if err := d.writeSearchFile(collection, search); err != nil {
+		return n, err
+	}
+	return n + 1, nil
+}
+
+// staleLines reports whether the file at path has more than live lines
+func (d *Driver) staleLines(path string, live int) (bool, error) {
+	b, err := d.backend.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Count(b, []byte("\n")) > live, nil
+}
+
+// removeEmptyCollection removes the dir of a collection holding nothing but
+// empty dirs of its own. Nested collections are left to their own pass,
+// under their own mutex.
+func (d *Driver) removeEmptyCollection(collection string) (bool, error) {
+	dir := filepath.Join(d.dir, collection)
+	files, err := d.backend.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, file := range files {
+		if !file.IsDir() || !ownDir(file.Name()) {
+			return false, nil
+		}
+	}
+	return d.removeIfEmpty(dir)
+}
+
+// removeIfEmpty removes dir if there is nothing in it but empty dirs, and
+// reports whether it did
+func (d *Driver) removeIfEmpty(dir string) (bool, error) {
+	files, err := d.backend.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			return false, nil
+		}
+		removed, err := d.removeIfEmpty(filepath.Join(dir, file.Name()))
+		if err != nil || !removed {
+			return false, err
+		}
+	}
+	if err := d.backend.Remove(dir); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// compactPeriodically is the maintenance chore started for
+// Options.MaintenanceInterval
+func (d *Driver) compactPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.life.stop:
+			return
+		case <-ticker.C:
+		}
+		stats, err := d.Compact()
+		if err != nil && !errors.Is(err, ErrClosed) {
+			d.log.Error("Unable to compact the database", "error", err)
+		} else if err == nil {
+			d.log.Debug("Compacted the database", "tempFiles", stats.TempFiles, "expiredRecords", stats.ExpiredRecords,
+				"revisions", stats.Revisions, "indexes", stats.Indexes, "emptyDirs", stats.EmptyDirs, "reclaimedBytes", stats.ReclaimedBytes)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package jsondb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// CompressionNone stores records as encoded, the default
+	CompressionNone = "none"
+
+	// CompressionGzip stores records gzip compressed. Files are recognized
+	// by the gzip header when read, so a collection can hold compressed and
+	// plain records side by side while compression is switched on or off.
+	CompressionGzip = "gzip"
+)
+
+// errDecompress is returned for a compressed record file that is corrupted
+var errDecompress = errors.New("unable to decompress record")
+
+// gzipMagic starts every gzip stream: the two id bytes and the deflate
+// method. Neither JSON nor gob records can start with it.
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+func validCompression(c string) bool {
+	return c == "" || c == CompressionNone || c == CompressionGzip
+}
+
+// compression returns the compression of a collection: its own setting, else
+// the driver's
+func (d *Driver) compression(collection string) string {
+	if c := d.collections[collection].Compression; c != "" {
+		return c
+	}
+	return d.defaultCompression
+}
+
+// compress compresses an encoded record as its collection asks for
+func (d *Driver) compress(collection string, b []byte) ([]byte, error) {
+	if d.compression(collection) != CompressionGzip {
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns the encoded record of a file's contents, whether or not
+// they are compressed
+func decompress(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, gzipMagic) {
+		return b, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecompress, err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDecompress, err)
+	}
+	return out, nil
+}
+
+// pack turns an encoded record into the bytes stored in its file, compressed
+// and then encrypted as configured
+func (d *Driver) pack(collection string, b []byte) ([]byte, error) {
+	b, err := d.compress(collection, b)
+	if err != nil {
+		return nil, err
+	}
+	return d.seal(b)
+}
+
+// unpack undoes pack
+func (d *Driver) unpack(b []byte) ([]byte, error) {
+	b, err := d.open(b)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(b)
+}
@@ -0,0 +1,116 @@
+package jsondb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CopyCollection duplicates every record of srcCollection into dstCollection,
+// which must not exist yet, and returns the number of records copied. Both
+// collections are locked for the copy, so it is a consistent snapshot. The
+// records are gathered in a hidden staging directory renamed into place at
+// the end: the destination appears complete or not at all. Records are hard
+// linked where the filesystem allows it, since every write replaces the file;
+// with Options.RecordPadding, which overwrites files in place, they are
+// always copied.
+func (d *Driver) CopyCollection(srcCollection, dstCollection string) (n int, err error) {
+	defer d.done(OpCopyCollection, srcCollection, "", time.Now(), &err)
+
+	if srcCollection == "" || dstCollection == "" {
+		return 0, fmt.Errorf("%w - unable to copy", ErrEmptyCollection)
+	}
+	if srcCollection == dstCollection {
+		return 0, fmt.Errorf("unable to copy %v onto itself", srcCollection)
+	}
+	for _, c := range []string{srcCollection, dstCollection} {
+		if err := d.validateCollection(c); err != nil {
+			return 0, err
+		}
+	}
+	if err := d.requireFiles("CopyCollection"); err != nil {
+		return 0, err
+	}
+
+	// lock in name order so two crossed copies can't deadlock
+	first, second := srcCollection, dstCollection
+	if second < first {
+		first, second = second, first
+	}
+	for _, c := range []string{first, second} {
+		unlock, err := d.lockCollection(c)
+		if err != nil {
+			return 0, err
+		}
+		defer unlock()
+	}
+
+	dst := filepath.Join(d.dir, dstCollection)
+	if _, err := d.backend.Stat(dst); err == nil {
+		return 0, fmt.Errorf("unable to copy into %v - collection already exists", dstCollection)
+	}
+
+	names, err := d.recordNames(srcCollection)
+	if err != nil {
+		return 0, err
+	}
+
+	staging := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+d.tmpSuffix)
+	if err := d.backend.RemoveAll(staging); err != nil {
+		return 0, err
+	}
+	if err := d.backend.MkdirAll(staging, 0755); err != nil {
+		return 0, err
+	}
+
+	for _, name := range names {
+		src := filepath.Join(d.dir, srcCollection, name+d.ext)
+		if err := d.copyRecordFile(src, filepath.Join(staging, name+d.ext)); err != nil {
+			d.backend.RemoveAll(staging)
+			return 0, err
+		}
+	}
+
+	if err := d.backend.Rename(staging, dst); err != nil {
+		d.backend.RemoveAll(staging)
+		return 0, err
+	}
+
+	watched := d.watchers.watching(dstCollection)
+	for _, name := range names {
+		d.blooms.added(dstCollection, name)
+		if watched {
+			b, _ := d.readFile(filepath.Join(dst, name+d.ext))
+			d.written(dstCollection, name, false, b)
+		}
+	}
+	return len(names), nil
+}
+
+// copyRecordFile hard links src to dst, or copies its bytes when linking
+// isn't possible or safe
+func (d *Driver) copyRecordFile(src, dst string) error {
+	if d.recordPadding == 0 {
+		if err := d.link(src, dst); err == nil {
+			return nil
+		}
+	}
+
+	in, err := d.openFile(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := d.backend.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,37 @@
+package jsondb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// The Ctx variants behave like the methods they're named after, but give up
+// with ctx.Err() once ctx is canceled or its deadline passes. ctx is checked
+// before each file operation, so a file already being read or written is
+// finished first, and a canceled collection-wide read returns no records.
+
+// WriteCtx is Write honoring ctx. It checks ctx again once it holds the
+// collection lock, before the record is touched.
+func (d *Driver) WriteCtx(ctx context.Context, collection, resource string, v interface{}) (err error) {
+	defer d.done(OpWriteCtx, collection, resource, time.Now(), &err)
+	return d.write(ctx, collection, resource, v)
+}
+
+// ReadCtx is Read honoring ctx
+func (d *Driver) ReadCtx(ctx context.Context, collection, resource string, v interface{}) (err error) {
+	defer d.done(OpReadCtx, collection, resource, time.Now(), &err)
+	return d.read(ctx, collection, resource, v)
+}
+
+// ReadAllCtx is ReadAll honoring ctx between the record files
+func (d *Driver) ReadAllCtx(ctx context.Context, collection string) (records []string, err error) {
+	defer d.done(OpReadAllCtx, collection, "", time.Now(), &err)
+	return d.readAll(ctx, collection)
+}
+
+// FindCtx is Find honoring ctx between the record files
+func (d *Driver) FindCtx(ctx context.Context, collection string, query Query) (records []json.RawMessage, err error) {
+	defer d.done(OpFindCtx, collection, "", time.Now(), &err)
+	return d.find(ctx, collection, query)
+}
@@ -0,0 +1,200 @@
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// IterateOptions selects the records a Cursor visits. The zero value visits
+// them all.
+type IterateOptions struct {
+	Offset int    // records to skip, after After is applied
+	Limit  int    // most records to visit; 0 means no limit
+	After  string // resume after this resource, as returned by Cursor.Token
+}
+
+// Cursor visits the records of a collection one at a time, reading each
+// record file only when Next reaches it. Records are visited in resource
+// order; ones deleted after Iterate listed the collection are skipped and
+// ones added after it aren't visited. A Cursor isn't safe for concurrent use.
+//
+//	cur, err := db.Iterate("users")
+//	if err != nil { ... }
+//	defer cur.Close()
+//	for cur.Next() {
+//		var u User
+//		if err := cur.Decode(&u); err != nil { ... }
+//	}
+//	if err := cur.Err(); err != nil { ... }
+type Cursor struct {
+	d          *Driver
+	collection string
+	names      []string
+	docs       [][]byte // the records of an append log, read in one scan
+	limit      int      // records left to visit, -1 for no limit
+
+	resource string
+	last     string // last record visited, for Token
+	b        []byte
+	err      error
+	closed   bool
+}
+
+// Iterate returns a Cursor over every record of a collection. A missing
+// collection has no records.
+func (d *Driver) Iterate(collection string) (*Cursor, error) {
+	return d.IterateWithOptions(collection, IterateOptions{})
+}
+
+// IterateWithOptions returns a Cursor over a page of a collection's records.
+// Page through a collection by passing the Token of the previous page's
+// cursor as After, which unlike Offset isn't thrown off by records added or
+// deleted between pages.
+func (d *Driver) IterateWithOptions(collection string, opts IterateOptions) (cur *Cursor, err error) {
+	defer d.done(OpIterate, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to iterate records", ErrEmptyCollection)
+	}
+	if opts.Offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d - must not be negative", opts.Offset)
+	}
+	if opts.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit %d - must not be negative", opts.Limit)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := d.beforeRead(collection, ""); err != nil {
+		return nil, err
+	}
+
+	cur = &Cursor{d: d, collection: collection, limit: -1}
+	if opts.Limit > 0 {
+		cur.limit = opts.Limit
+	}
+
+	if d.storage == StorageAppendLog {
+		names, docs, err := d.liveLog(collection)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		cur.names = names
+		cur.docs = make([][]byte, len(docs))
+		for i, doc := range docs {
+			cur.docs[i] = doc
+		}
+		sort.Sort(cursorOrder{cur})
+	} else if cur.names, err = d.resourceNames(collection); err != nil {
+		return nil, err
+	}
+
+	start := 0
+	if opts.After != "" {
+		start = sort.SearchStrings(cur.names, opts.After)
+		if start < len(cur.names) && cur.names[start] == opts.After {
+			start++
+		}
+	}
+	start += opts.Offset
+	if start > len(cur.names) {
+		start = len(cur.names)
+	}
+	cur.names = cur.names[start:]
+	if cur.docs != nil {
+		cur.docs = cur.docs[start:]
+	}
+
+	return cur, nil
+}
+
+// cursorOrder sorts the names of an append-log cursor along with their
+// records
+type cursorOrder struct{ c *Cursor }
+
+func (o cursorOrder) Len() int           { return len(o.c.names) }
+func (o cursorOrder) Less(i, j int) bool { return o.c.names[i] < o.c.names[j] }
+func (o cursorOrder) Swap(i, j int) {
+	o.c.names[i], o.c.names[j] = o.c.names[j], o.c.names[i]
+	o.c.docs[i], o.c.docs[j] = o.c.docs[j], o.c.docs[i]
+}
+
+// Next advances to the next record, reading it. It returns false when there
+// are no more records, the cursor is closed, or reading failed; Err tells
+// the last case apart.
+func (c *Cursor) Next() bool {
+	c.resource, c.b = "", nil
+	if c.closed || c.err != nil {
+		return false
+	}
+
+	for len(c.names) > 0 && c.limit != 0 {
+		name := c.names[0]
+		c.names = c.names[1:]
+
+		var b []byte
+		if c.docs != nil {
+			b, c.docs = c.docs[0], c.docs[1:]
+		} else {
+			var err error
+			b, err = c.d.readRaw(c.collection, name)
+			if os.IsNotExist(err) {
+				continue // deleted since the listing
+			}
+			if err != nil {
+				c.err = err
+				return false
+			}
+		}
+
+		if c.limit > 0 {
+			c.limit--
+		}
+		c.resource, c.last, c.b = name, name, b
+		return true
+	}
+	return false
+}
+
+// Resource returns the name of the current record
+func (c *Cursor) Resource() string {
+	return c.resource
+}
+
+// Raw returns the stored bytes of the current record
+func (c *Cursor) Raw() []byte {
+	return c.b
+}
+
+// Decode decodes the current record into v, running the AfterRead hooks of
+// the driver
+func (c *Cursor) Decode(v interface{}) (err error) {
+	if c.b == nil {
+		return fmt.Errorf("no current record - call Next first")
+	}
+	defer func() { c.d.afterRead(c.collection, c.resource, v, err) }()
+	if err := c.d.decode(c.b, v); err != nil {
+		return fmt.Errorf("unable to decode %v/%v: %w", c.collection, c.resource, err)
+	}
+	return nil
+}
+
+// Token returns a token resuming iteration after the last record visited,
+// for IterateOptions.After. It is empty before the first record.
+func (c *Cursor) Token() string {
+	return c.last
+}
+
+// Err returns the error that stopped Next, if any
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close releases the cursor; Next returns false afterwards
+func (c *Cursor) Close() error {
+	c.closed = true
+	c.names, c.docs, c.b = nil, nil, nil
+	return nil
+}
@@ -0,0 +1,6 @@
+// Package jsondb is a small embedded document database that stores every
+// record of a collection as a file under a directory, JSON encoded by
+// default. Open a database with New and use the Driver's Write, Read,
+// ReadAll and Delete; Options selects the encoding, the storage layout and
+// the optional features.
+package jsondb
@@ -0,0 +1,922 @@
+package jsondb
+
+import (
+	"context"
+	"crypto/cipher"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const Version = "1.0.0"
+
+// logger
+type (
+	Logger interface {
+		Fatal(string, ...interface{})
+		Error(string, ...interface{})
+		// Warning(string, ...interface{})
+		Info(string, ...interface{})
+		Debug(string, ...interface{})
+		Trace(string, ...interface{})
+	}
+
+	// Driver is safe for concurrent use. Every mutable field has exactly one
+	// guard, noted next to it; fields marked immutable are only set in New.
+	Driver struct {
+		mutex   *sync.Mutex            // pointer immutable, guards mutexes
+		mutexes map[string]*sync.Mutex // per-collection locks, never removed once created
+		dir     string                 // immutable
+		backend Storage                // immutable
+		log     *slog.Logger           // immutable, see newLogger
+		schemas *schemaWatchers        // pointer immutable, contents guarded by schemas.mutex
+		stats   *stats                 // pointer immutable, counters are atomic
+
+		collections         map[string]CollectionOptions // immutable copy of Options.Collections
+		collectionValidator func(string) error           // immutable
+		resourceValidator   func(string) error           // immutable
+
+		trash          *sync.Mutex   // pointer immutable, guards the _trash area
+		trashRetention time.Duration // immutable
+		tx             *sync.Mutex   // pointer immutable, serializes Transaction
+
+		codec   Codec  // immutable
+		format  string // immutable, see codecFormat
+		ext     string // immutable, record file extension of codec
+		storage string // immutable, one of the Storage constants
+
+		spotChecks chan spotCheck // immutable, nil unless Options.VerifyWrites is set
+		blooms     *bloomFilters  // pointer immutable, nil unless Options.BloomFilterBits is set; contents guarded by blooms.mutex
+		cache      *recordCache   // pointer immutable, nil unless Options.CacheSize is set; contents guarded by cache.mutex
+		writeDelay time.Duration  // immutable, only non-zero in builds with the tests tag
+		logIndexes *logIndexes    // pointer immutable, contents guarded by logIndexes.mutex
+		indexes    *fieldIndexes  // pointer immutable, see fieldIndexes for its guards
+		searches   *searchIndexes // pointer immutable, see searchIndexes for its guards
+		tmpSuffix  string         // immutable
+
+		manifestKey   []byte // immutable copy of Options.ManifestKey
+		recordPadding int    // immutable
+		mmapThreshold int    // immutable
+
+		wal     bool    // immutable
+		walSync WALSync // immutable
+
+		durability Durability // immutable
+
+		fileLocking bool          // immutable
+		lockTimeout time.Duration // immutable
+
+		idGenerator IDGenerator // immutable
+		metadata    bool        // immutable
+		metaField   string      // immutable
+		watchers    *watchers   // pointer immutable, contents guarded by watchers.mutex
+		hooks       []Hook      // immutable, set by Use on a copy
+
+		jsonSchemas *jsonSchemas // pointer immutable, contents guarded by jsonSchemas.mutex
+
+		expiries       *expiries     // pointer immutable, see expiries for its guards
+		expiryInterval time.Duration // immutable
+
+		defaultCompression string // immutable, one of the Compression constants
+
+		defaultHistory *HistoryOptions // immutable copy of Options.History, nil unless set
+
+		migrations *migrations // pointer immutable, contents guarded by migrations.mutex
+
+		keys    KeyProvider // immutable, nil unless Options.Encryption is set
+		ciphers *ciphers    // pointer immutable, contents guarded by ciphers.mutex
+
+		life     *lifecycle // pointer immutable, shared by copies, see lifecycle
+		readOnly bool       // immutable
+
+		observers []func(Op, string, string, time.Duration, error) // immutable, set by Observe on a copy
+		metrics   Metrics                                          // immutable, nil unless Options.Metrics
+		traceAll  bool                                             // immutable
+		traced    map[Op]bool                                      // immutable copy of Options.TraceOperations
+	}
+)
+
+type Options struct {
+	// Logger receives the driver's log messages, formatted as text with the
+	// structured context as key=value pairs after the message. It defaults
+	// to a console logger from INFO up; see also Slog.
+	Logger
+	testOptions
+
+	// Slog, when set, receives the driver's log records with their context
+	// as attributes: collection, resource, error and so on. It replaces
+	// Logger, which must then be nil.
+	Slog *slog.Logger
+
+	// Trace logs every operation as it completes, at LevelTrace, with the
+	// op, collection, resource, duration and error; TraceOperations only
+	// the operations it lists. Like the observers of Observe, public methods
+	// used by other operations are logged too.
+	Trace           bool
+	TraceOperations []Op
+
+	// Collections holds settings for individual collections, keyed by name
+	Collections map[string]CollectionOptions
+
+	// CollectionNameValidator, when set, is called with the collection name
+	// by every method taking one; a non-nil error aborts the call. See
+	// URLSafeCollectionValidator.
+	CollectionNameValidator func(name string) error
+
+	// ResourceNameValidator, when set, is called with the record name by
+	// every method taking one, after the driver's own checks that the name
+	// stays inside the collection dir and is portable, see
+	// PortableNameValidator.
+	ResourceNameValidator func(name string) error
+
+	// TrashRetention, when set, makes Delete move records into a trash area
+	// under the database dir instead of removing them. Deleted records stay
+	// restorable with Undelete until they're older than the retention.
+	TrashRetention time.Duration
+
+	// Format selects how records are encoded on disk: FormatJSON (the
+	// default) or FormatGob. See FormatGob before choosing it.
+	Format string
+
+	// Codec, instead of Format, sets how records are encoded, such as with
+	// CompactJSONCodec or a Codec wrapping a YAML or MessagePack package.
+	// Features looking inside records (indexes, queries, schemas and the
+	// like) need a JSON codec; with any other they behave as with FormatGob.
+	// Compressed files are told apart by their gzip header, so a codec's
+	// output must not start with the bytes 1f 8b 08.
+	Codec Codec
+
+	// Backend is the file system the database is kept in: Disk (the
+	// default) or Memory, or a Storage of your own. FileLocking and
+	// MmapThreshold require Disk.
+	Backend Storage
+
+	// Storage selects the on-disk layout: StorageFiles (the default) or
+	// StorageAppendLog for write-heavy collections
+	Storage string
+
+	// VerifyWrites samples 1% of writes and has a background goroutine read
+	// them back and compare their sha256 with what was written. Mismatches
+	// are logged as errors and counted in Stats. Unlike the per-collection
+	// CollectionOptions.VerifyWrites it never delays or fails a Write.
+	VerifyWrites bool
+
+	// BloomFilterBits, when non-zero, keeps an in-memory Bloom filter of
+	// that many bits per collection so Exists can answer for resources that
+	// were never written without a disk stat. Plain Bloom filters can't
+	// forget a resource, so deleted resources still cost a stat.
+	BloomFilterBits uint
+
+	// CacheSize, when set, keeps up to that many recently read records in
+	// memory, so reading them again doesn't touch the disk. Writes and
+	// deletes through the driver replace or drop the cached copy; changes
+	// made by other processes are not seen, so it can't be combined with
+	// FileLocking. Stats counts the cache hits and misses.
+	CacheSize int
+
+	// CountingBloomFilter uses counters instead of bits (one byte each) so
+	// deletes are removed from the filter too. Use it when resources are
+	// deleted often enough for stale filter hits to matter.
+	CountingBloomFilter bool
+
+	// TmpSuffix is appended to a record's file name to name the temp file it
+	// is written to before being renamed into place. It defaults to ".tmp".
+	// A per-process suffix such as fmt.Sprintf(".%d.tmp", os.Getpid())
+	// keeps two processes writing the same record from clobbering each
+	// other's temp file; the rename still makes each write atomic, and the
+	// last one wins.
+	TmpSuffix string
+
+	// ManifestKey is the HMAC-SHA256 key WriteManifest signs integrity
+	// manifests with and VerifyManifest checks them against
+	ManifestKey []byte
+
+	// RecordPadding pads every JSON record with spaces to exactly that many
+	// bytes. A Write replacing a record of the same padded size then
+	// overwrites the file in place instead of writing a temp file and
+	// renaming it, which pays off for fixed-schema, high-throughput
+	// collections. In-place overwrites are not atomic: a crash mid-write can
+	// leave a torn record. Records larger than the padding are written
+	// unpadded through the temp file as usual.
+	RecordPadding int
+
+	// MmapThreshold, when set, writes records of at least that many bytes
+	// into their temp file through a shared memory mapping flushed with
+	// msync instead of os.WriteFile, saving a copy through the kernel for
+	// very large records (a few MB and up). Platforms without mmap support
+	// always use os.WriteFile.
+	MmapThreshold int
+
+	// WriteAheadLog logs every Write and Delete of a record to a journal in
+	// the collection dir before touching the record file, and removes the
+	// entry once the change is applied. New replays the entries a crash
+	// left behind, which also repairs records torn by RecordPadding's
+	// in-place overwrites. It requires the files Storage.
+	WriteAheadLog bool
+
+	// WALSync selects when write-ahead log entries are fsynced; the default
+	// WALSyncAlways syncs every entry
+	WALSync WALSync
+
+	// Durability selects what record and metadata writes fsync before they
+	// return; the default DurabilityNone leaves it to the OS. See Durability
+	// for the cost of the others.
+	Durability Durability
+
+	// FileLocking also takes an advisory file lock, <collection>.lock in
+	// the database dir, whenever a collection is modified, so several
+	// processes can share the database. It uses flock on Unix and
+	// LockFileEx on Windows; New fails if the platform or the file system
+	// of dir doesn't support them. Reads don't take the lock: records are
+	// replaced atomically.
+	FileLocking bool
+
+	// LockTimeout bounds how long a modification waits for another
+	// process's file lock before failing with ErrLocked. Zero waits as long
+	// as it takes.
+	LockTimeout time.Duration
+
+	// IDGenerator makes the resource names of records stored with Insert.
+	// It defaults to UUIDv4; see also ULID and Sequential.
+	IDGenerator IDGenerator
+
+	// Metadata keeps a Meta in a reserved _meta member of every JSON object
+	// record: when it was created and last written, and a revision counting
+	// its writes. Structs without a _meta field ignore it when read, but
+	// maps read back must accept an object under _meta; see ReadWithMeta.
+	// Arrays and other non-object records are stored as is.
+	Metadata bool
+
+	// MetaField names the reserved member that Metadata keeps the revision
+	// and timestamps in, and Migrate the schema version, for records with a
+	// _meta field of their own. It defaults to "_meta". Records stored under
+	// another name keep it as an ordinary field, so choose it before the
+	// first write.
+	MetaField string
+
+	// ExpiryInterval is how often a background goroutine removes the files
+	// of records whose TTL has passed; see WriteWithTTL. It defaults to a
+	// minute. Expired records read as missing whether or not they have been
+	// removed yet.
+	ExpiryInterval time.Duration
+
+	// MaintenanceInterval, when set, is how often a background goroutine
+	// runs Compact. Errors are logged; it keeps running after them.
+	MaintenanceInterval time.Duration
+
+	// Encryption, when set, encrypts every record file with AES-GCM using
+	// keys from the KeyProvider, such as StaticKey or EnvKey. Plain records
+	// already stored stay readable; ReEncrypt encrypts them and rewrites
+	// records after a key rotation. Record contents are also encrypted in
+	// the write-ahead log and transaction journals, but not in DumpAll
+	// output. Indexes, unique constraints and search store record values
+	// in files of their own, so CreateIndex, AddUniqueConstraint and
+	// EnableSearch fail with it. It requires the files Storage.
+	Encryption KeyProvider
+
+	// Compression selects how record files are compressed: CompressionNone
+	// (the default) or CompressionGzip. Records are compressed before being
+	// encrypted. CollectionOptions.Compression overrides it per collection.
+	// It can't be combined with RecordPadding.
+	Compression string
+
+	// History, when set, keeps the versions of every record that writes
+	// replace, as HistoryOptions describes; see History. It requires the
+	// files Storage. CollectionOptions.History overrides it per collection.
+	History *HistoryOptions
+
+	// Metrics, when set, is told about every operation, collection lock
+	// wait, cache lookup and write verification, as Metrics describes;
+	// Collector exports them with expvar or to Prometheus
+	Metrics Metrics
+
+	// ReadOnly opens the database for reading only: every modification
+	// fails with ErrReadOnly and nothing under the dir is written, so it can
+	// be shared with a writing process or mounted read-only. Transaction
+	// journals and write-ahead logs left by a crash aren't recovered, and
+	// expired records and the trash aren't purged, until a writable New.
+	ReadOnly bool
+}
+
+// CollectionOptions are settings that only apply to one collection
+type CollectionOptions struct {
+	// VerifyWrites re-reads every record from disk after it's renamed into
+	// place and checks it matches what was written. A mismatch is retried
+	// once before Write fails with ErrWriteVerificationFailed.
+	VerifyWrites bool
+
+	// TTL, when set, has every record written to the collection expire that
+	// long after its last write, unless written with WriteWithTTL. It
+	// requires the files Storage.
+	TTL time.Duration
+
+	// Compression overrides Options.Compression for the collection
+	Compression string
+
+	// History overrides Options.History for the collection
+	History *HistoryOptions
+
+	// References selects what Delete and SoftDelete of a record of the
+	// collection do to the records referencing it with a Ref. Finding them
+	// reads every record of the database, so anything but the default
+	// ReferenceIgnore suits small databases. Transaction, DeleteBatch and
+	// deleting a whole collection don't check references.
+	References ReferencePolicy
+}
+
+// New opens the database stored under dir. options may be nil; see Options
+// for the defaults. It fails with an *OptionsError if options are invalid.
+func New(dir string, options *Options) (*Driver, error) {
+	dir = filepath.Clean(dir)
+
+	opts := Options{}
+	if options != nil {
+		opts = *options
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	driver := Driver{
+		mutex:   &sync.Mutex{},
+		dir:     dir,
+		backend: Disk(),
+		mutexes: make(map[string]*sync.Mutex),
+		log:     newLogger(opts),
+		schemas: newSchemaWatchers(),
+		stats:   &stats{},
+
+		collections:         make(map[string]CollectionOptions, len(opts.Collections)),
+		collectionValidator: opts.CollectionNameValidator,
+		resourceValidator:   opts.ResourceNameValidator,
+		trash:               &sync.Mutex{},
+		trashRetention:      opts.TrashRetention,
+		tx:                  &sync.Mutex{},
+
+		codec:   JSONCodec,
+		format:  FormatJSON,
+		ext:     ".json",
+		storage: StorageFiles,
+
+		writeDelay: opts.writeDelay(),
+		logIndexes: &logIndexes{indexes: make(map[string]map[string]int64)},
+		indexes:    &fieldIndexes{collections: make(map[string]map[string]*fieldIndex)},
+		searches:   &searchIndexes{collections: make(map[string]*searchIndex)},
+		tmpSuffix:  ".tmp",
+
+		manifestKey:   append([]byte(nil), opts.ManifestKey...),
+		recordPadding: opts.RecordPadding,
+		mmapThreshold: opts.MmapThreshold,
+
+		wal:     opts.WriteAheadLog,
+		walSync: opts.WALSync,
+
+		durability: opts.Durability,
+
+		metrics: opts.Metrics,
+
+		traceAll: opts.Trace,
+
+		fileLocking: opts.FileLocking,
+		lockTimeout: opts.LockTimeout,
+
+		idGenerator: UUIDv4,
+		metadata:    opts.Metadata,
+		metaField:   metaField,
+		watchers:    &watchers{collections: make(map[string][]chan Event)},
+		jsonSchemas: &jsonSchemas{collections: make(map[string]*jsonSchema)},
+
+		expiries:       &expiries{collections: make(map[string]map[string]time.Time)},
+		expiryInterval: time.Minute,
+
+		defaultCompression: CompressionNone,
+
+		migrations: &migrations{steps: make(map[string][]migration), applied: make(map[string]int)},
+
+		keys:    opts.Encryption,
+		ciphers: &ciphers{byID: make(map[string]cipher.AEAD)},
+
+		life:     newLifecycle(),
+		readOnly: opts.ReadOnly,
+	}
+	if opts.Backend != nil {
+		driver.backend = opts.Backend
+	}
+	driver.backend = gatedStorage{Storage: driver.backend, life: driver.life, readOnly: opts.ReadOnly}
+	if opts.IDGenerator != nil {
+		driver.idGenerator = opts.IDGenerator
+	}
+	if len(opts.TraceOperations) > 0 {
+		driver.traced = make(map[Op]bool, len(opts.TraceOperations))
+		for _, op := range opts.TraceOperations {
+			driver.traced[op] = true
+		}
+	}
+	if opts.Compression != "" {
+		driver.defaultCompression = opts.Compression
+	}
+	if opts.History != nil {
+		h := *opts.History
+		driver.defaultHistory = &h
+	}
+	if opts.ExpiryInterval > 0 {
+		driver.expiryInterval = opts.ExpiryInterval
+	}
+	if opts.TmpSuffix != "" {
+		driver.tmpSuffix = opts.TmpSuffix
+	}
+	if opts.MetaField != "" {
+		driver.metaField = opts.MetaField
+	}
+	if opts.Format == FormatGob {
+		driver.codec = GobCodec
+	}
+	if opts.Codec != nil {
+		driver.codec = opts.Codec
+	}
+	driver.format, driver.ext = codecFormat(driver.codec), driver.codec.Extension()
+	if opts.Storage == StorageAppendLog {
+		driver.storage = StorageAppendLog
+	}
+	for name, c := range opts.Collections {
+		if c.History != nil {
+			h := *c.History
+			c.History = &h
+		}
+		driver.collections[name] = c
+	}
+
+	// a read-only driver leaves recovery and the chores to a writable one
+	if !opts.ReadOnly {
+		if driver.fileLocking {
+			if err := driver.probeFileLocking(); err != nil {
+				return nil, err
+			}
+		}
+		if err := driver.recoverTransactions(); err != nil {
+			return nil, err
+		}
+		if driver.wal {
+			if err := driver.replayWAL(); err != nil {
+				return nil, err
+			}
+		}
+
+		if driver.trashRetention > 0 {
+			driver.startWorker(driver.purgeTrashPeriodically)
+		}
+		if opts.ExpiryInterval > 0 {
+			driver.startJanitor()
+		}
+		for _, c := range driver.collections {
+			if c.TTL > 0 {
+				driver.startJanitor()
+			}
+		}
+		if opts.MaintenanceInterval > 0 {
+			driver.startWorker(func() { driver.compactPeriodically(opts.MaintenanceInterval) })
+		}
+	}
+	if opts.BloomFilterBits > 0 {
+		driver.blooms = &bloomFilters{
+			size:     opts.BloomFilterBits,
+			counting: opts.CountingBloomFilter,
+			filters:  make(map[string]*bloomFilter),
+		}
+	}
+	if opts.CacheSize > 0 {
+		driver.cache = newRecordCache(opts.CacheSize)
+	}
+	if opts.VerifyWrites {
+		driver.spotChecks = make(chan spotCheck, 64)
+		driver.startWorker(driver.runSpotChecks)
+	}
+
+	if opts.ReadOnly {
+		driver.log.Debug("Using the database read-only", "dir", dir)
+		return &driver, nil
+	}
+	if _, err := driver.backend.Stat(dir); err != nil {
+		driver.log.Debug("Using the database (already exists)", "dir", dir)
+		return &driver, nil
+	}
+
+	driver.log.Debug("Creating the database", "dir", dir)
+	return &driver, driver.backend.MkdirAll(dir, 0755)
+}
+
+// Write encodes v and stores it as resource in collection, replacing any
+// record of the same name. The record file is replaced atomically.
+func (d *Driver) Write(collection, resource string, v interface{}) (err error) {
+	defer d.done(OpWrite, collection, resource, time.Now(), &err)
+	return d.write(context.Background(), collection, resource, v)
+}
+
+func (d *Driver) write(ctx context.Context, collection, resource string, v interface{}) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if collection == "" {
+		return fmt.Errorf("%w - no place to save record", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+
+	if v, err = d.beforeWrite(collection, resource, v); err != nil {
+		return err
+	}
+	defer func() { d.afterWrite(collection, resource, v, err) }()
+
+	if d.storage == StorageAppendLog {
+		return d.writeLog(collection, resource, v)
+	}
+
+	b, err := d.encode(v)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the lock may have taken a while
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return d.writeRecord(collection, resource, b)
+}
+
+// writeRaw stores an already encoded record under the collection mutex
+func (d *Driver) writeRaw(collection, resource string, b []byte) error {
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return d.writeRecord(collection, resource, b)
+}
+
+// writeRecord atomically stores an encoded record, verifying it when the
+// collection asks for it. The caller must hold the collection mutex.
+func (d *Driver) writeRecord(collection, resource string, b []byte) error {
+	dir := filepath.Join(d.dir, collection)
+	finalPath := filepath.Join(dir, resource+d.ext)
+	tempPath := finalPath + d.tmpSuffix
+
+	if err := d.backend.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if d.writeDelay > 0 {
+		time.Sleep(d.writeDelay)
+	}
+
+	if err := d.checkSchema(collection, resource, b); err != nil {
+		return err
+	}
+	if err := d.checkUnique(collection, map[string][]byte{resource: b}); err != nil {
+		return err
+	}
+	b, err := d.stampVersion(collection, b)
+	if err != nil {
+		return err
+	}
+	if b, err = d.stampMeta(collection, resource, b); err != nil {
+		return err
+	}
+	b = d.padRecord(b)
+	stored, err := d.pack(collection, b)
+	if err != nil {
+		return err
+	}
+
+	clearWAL, err := d.logWAL(collection, walEntry{Resource: resource, Record: stored})
+	if err != nil {
+		return err
+	}
+	defer clearWAL()
+
+	if err := d.archiveRecord(collection, resource); err != nil {
+		return err
+	}
+	existed := d.recordExists(collection, resource)
+	if err := d.storeFile(tempPath, finalPath, stored); err != nil {
+		return err
+	}
+	if err := d.resetExpiry(collection, resource); err != nil {
+		return err
+	}
+
+	if d.collections[collection].VerifyWrites {
+		expected, actual, ok := d.verifyRecord(finalPath, stored)
+		if !ok {
+			d.log.Warn("Verification failed, retrying", "collection", collection, "resource", resource, "expected", expected, "found", actual)
+			if err := d.storeFile(tempPath, finalPath, stored); err != nil {
+				return err
+			}
+			if expected, actual, ok = d.verifyRecord(finalPath, stored); !ok {
+				d.log.Error("Verification failed again", "collection", collection, "resource", resource, "expected", expected, "found", actual)
+				return &VerificationError{collection, resource, expected, actual}
+			}
+		}
+	}
+
+	d.queueSpotCheck(collection, finalPath, stored)
+	d.blooms.added(collection, resource)
+	d.written(collection, resource, existed, b)
+
+	if d.format == FormatJSON {
+		d.schemas.observe(d.log, collection, resource, b)
+		d.indexRecord(collection, resource, b)
+	}
+	return nil
+}
+
+// Read decodes the record stored as resource in collection into v
+func (d *Driver) Read(collection string, resource string, v interface{}) (err error) {
+	defer d.done(OpRead, collection, resource, time.Now(), &err)
+	return d.read(context.Background(), collection, resource, v)
+}
+
+func (d *Driver) read(ctx context.Context, collection, resource string, v interface{}) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if collection == "" {
+		return fmt.Errorf("%w - unable to read record", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to read record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+
+	if err := d.beforeRead(collection, resource); err != nil {
+		return err
+	}
+	defer func() { d.afterRead(collection, resource, v, err) }()
+
+	b, err := d.readRaw(collection, resource)
+	if err != nil {
+		return notFound(collection, resource, err)
+	}
+
+	return d.decode(b, v)
+}
+
+// readRaw returns the stored bytes of a record
+func (d *Driver) readRaw(collection, resource string) ([]byte, error) {
+	if d.storage == StorageAppendLog {
+		return d.cachedRead(collection, resource, func() ([]byte, error) {
+			doc, _, err := d.findLog(collection, resource)
+			return doc, err
+		})
+	}
+
+	if d.expired(collection, resource) {
+		return nil, os.ErrNotExist
+	}
+	b, err := d.cachedRead(collection, resource, func() ([]byte, error) {
+		record := filepath.Join(d.dir, collection, resource)
+		if _, err := d.stat(record); err != nil {
+			return nil, err
+		}
+		return d.readFile(record + d.ext)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.migrateRecord(collection, resource, b)
+}
+
+// ReadAll returns the raw encoded records of a collection
+func (d *Driver) ReadAll(collection string) (records []string, err error) {
+	defer d.done(OpReadAll, collection, "", time.Now(), &err)
+	return d.readAll(context.Background(), collection)
+}
+
+func (d *Driver) readAll(ctx context.Context, collection string) (records []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read record", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.beforeRead(collection, ""); err != nil {
+		return nil, err
+	}
+	defer func() { d.afterRead(collection, "", &records, err) }()
+
+	if d.storage == StorageAppendLog {
+		records, err := d.readAllLog(collection)
+		return records, notFound(collection, "", err)
+	}
+
+	dir := filepath.Join(d.dir, collection)
+	if _, err := d.stat(dir); err != nil {
+		return nil, notFound(collection, "", err)
+	}
+
+	files, _ := d.backend.ReadDir(dir)
+
+	for _, file := range files {
+		// skip in-flight temp files of concurrent writes
+		if file.IsDir() || filepath.Ext(file.Name()) != d.ext {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if d.expired(collection, strings.TrimSuffix(file.Name(), d.ext)) {
+			continue
+		}
+
+		b, err := d.readFile(filepath.Join(dir, file.Name()))
+		if os.IsNotExist(err) {
+			continue // deleted since the directory was listed
+		}
+		if err == nil {
+			b, err = d.migrateRecord(collection, strings.TrimSuffix(file.Name(), d.ext), b)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, string(b))
+	}
+	return records, nil
+}
+
+// Delete removes a record, or the whole collection when resource is empty
+func (d *Driver) Delete(collection, resource string) (err error) {
+	defer d.done(OpDelete, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to delete", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if resource != "" {
+		if err := d.validateResource(resource); err != nil {
+			return err
+		}
+	}
+
+	if err := d.beforeDelete(collection, resource); err != nil {
+		return err
+	}
+	defer func() { d.afterDelete(collection, resource, err) }()
+
+	if d.storage == StorageAppendLog {
+		return d.deleteLog(collection, resource)
+	}
+	if resource != "" {
+		if err := d.releaseReferences(collection, resource, d.trashRetention > 0); err != nil {
+			return err
+		}
+	}
+
+	path := filepath.Join(collection, resource)
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// a resource only ever names its record file, never a nested collection
+	if resource != "" {
+		fi, err := d.backend.Stat(filepath.Join(d.dir, path+d.ext))
+		if err == nil && !fi.Mode().IsRegular() {
+			err = os.ErrNotExist
+		}
+		if err != nil {
+			return notFound(collection, resource, err)
+		}
+		return d.deleteRecord(collection, resource, d.trashRetention > 0)
+	}
+
+	dir := filepath.Join(d.dir, path)
+	fi, err := d.backend.Stat(dir)
+	if err == nil && !fi.IsDir() {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return notFound(collection, resource, err)
+	}
+	d.blooms.dropped(collection)
+	d.dropIndexes(path)
+	d.dropExpiries(path)
+	d.dropMigrated(path)
+	if d.trashRetention > 0 {
+		err = d.trashCollection(path)
+	} else {
+		err = d.backend.RemoveAll(dir)
+	}
+	if err == nil {
+		d.changed(Deleted, filepath.ToSlash(path), "", nil)
+	}
+	return err
+}
+
+// deleteRecord removes the file of a record, or moves it into the trash. The
+// caller must hold the collection mutex.
+func (d *Driver) deleteRecord(collection, resource string, trash bool) error {
+	clearWAL, err := d.logWAL(collection, walEntry{Resource: resource, Deleted: true})
+	if err != nil {
+		return err
+	}
+	defer clearWAL()
+
+	path := filepath.Join(collection, resource)
+	if trash {
+		err = d.trashRecord(path)
+	} else {
+		err = d.backend.RemoveAll(filepath.Join(d.dir, path+d.ext))
+	}
+	if err != nil {
+		return err
+	}
+	d.blooms.removed(collection, resource)
+	d.indexRecord(collection, resource, nil)
+	d.changed(Deleted, collection, resource, nil)
+	return d.setExpiry(collection, resource, time.Time{})
+}
+
+// writeFile writes b to a temp file and renames it over finalPath
+func (d *Driver) writeFile(tempPath, finalPath string, b []byte) error {
+	if d.durability != DurabilityNone {
+		return d.writeFileSynced(tempPath, finalPath, b)
+	}
+	if err := d.backend.WriteFile(tempPath, b, 0644); err != nil {
+		return err
+	}
+
+	return d.backend.Rename(tempPath, finalPath)
+}
+
+// recordNames lists the resource names stored in a collection, in sorted
+// order, without reading the records
+func (d *Driver) recordNames(collection string) ([]string, error) {
+	files, err := d.backend.ReadDir(filepath.Join(d.dir, collection))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != d.ext {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), d.ext)
+		if d.expired(collection, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (d *Driver) getOrCreateMutex(collection string) *sync.Mutex {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	m, ok := d.mutexes[collection]
+	if !ok {
+		m = &sync.Mutex{}
+		d.mutexes[collection] = m
+	}
+
+	return m
+}
+
+func (d *Driver) stat(path string) (fi os.FileInfo, err error) {
+	if fi, err = d.backend.Stat(path); os.IsNotExist(err) {
+		fi, err = d.backend.Stat(path + d.ext)
+	}
+	return
+}
@@ -0,0 +1,219 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testUser struct {
+	Name string
+	Age  int
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *Options
+		wantErr bool
+	}{
+		{"nil options", nil, false},
+		{"defaults", &Options{Slog: quietSlog}, false},
+		{"durability", &Options{Slog: quietSlog, Durability: DurabilityStrict}, false},
+		{"file locking", &Options{Slog: quietSlog, FileLocking: true}, false},
+		{"invalid option", &Options{Slog: quietSlog, TrashRetention: -1}, true},
+		{"conflicting options", &Options{Slog: quietSlog, CountingBloomFilter: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New(t.TempDir(), tt.options)
+			if tt.wantErr {
+				var oe *OptionsError
+				if !errors.As(err, &oe) {
+					t.Fatalf("New() = %v, want an *OptionsError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() = %v", err)
+			}
+			d.Close()
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name                 string
+		collection, resource string
+		v                    interface{}
+		wantErr              error // nil when the write must succeed
+	}{
+		{"record", "users", "ada", testUser{"Ada", 36}, nil},
+		{"nested collection", "users/admins", "ada", testUser{"Ada", 36}, nil},
+		{"missing collection", "", "ada", testUser{"Ada", 36}, ErrEmptyCollection},
+		{"missing resource", "users", "", testUser{"Ada", 36}, ErrEmptyResource},
+		{"collection outside the dir", "../users", "ada", testUser{"Ada", 36}, ErrInvalidName},
+		{"resource outside the dir", "users", "../ada", testUser{"Ada", 36}, ErrInvalidName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, dir := newTestDriver(t, nil)
+			err := d.Write(tt.collection, tt.resource, tt.v)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Write() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write() = %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.collection, tt.resource+".json")); err != nil {
+				t.Fatalf("record file missing: %v", err)
+			}
+		})
+	}
+
+	t.Run("unencodable value", func(t *testing.T) {
+		d, _ := newTestDriver(t, nil)
+		if err := d.Write("users", "ada", make(chan int)); err == nil {
+			t.Fatal("Write() of a channel succeeded")
+		}
+		if err := d.Read("users", "ada", &testUser{}); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Read() after failed write = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestRead(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	if err := d.Write("users", "ada", testUser{"Ada", 36}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		collection, resource string
+		want                 testUser
+		wantErr              error
+	}{
+		{"record", "users", "ada", testUser{"Ada", 36}, nil},
+		{"missing record", "users", "bob", testUser{}, ErrNotFound},
+		{"missing collection", "admins", "ada", testUser{}, ErrNotFound},
+		{"missing collection name", "", "ada", testUser{}, ErrEmptyCollection},
+		{"missing resource name", "users", "", testUser{}, ErrEmptyResource},
+		{"invalid name", "users/..", "ada", testUser{}, ErrInvalidName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testUser
+			err := d.Read(tt.collection, tt.resource, &got)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Read() = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Read() got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("not found error", func(t *testing.T) {
+		err := d.Read("users", "bob", &testUser{})
+		var nf *NotFoundError
+		if !errors.As(err, &nf) || nf.Collection != "users" || nf.Resource != "bob" || !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Read() = %#v, want a *NotFoundError for users/bob", err)
+		}
+	})
+}
+
+func TestReadAll(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	for _, u := range []testUser{{"Bob", 41}, {"Ada", 36}} {
+		if err := d.Write("users", u.Name, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Write("users/admins", "Cy", testUser{"Cy", 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		collection string
+		want       []testUser
+		wantErr    error
+	}{
+		{"records in name order, without nested collections", "users", []testUser{{"Ada", 36}, {"Bob", 41}}, nil},
+		{"nested collection", "users/admins", []testUser{{"Cy", 30}}, nil},
+		{"missing collection", "admins", nil, ErrNotFound},
+		{"missing collection name", "", nil, ErrEmptyCollection},
+		{"invalid name", "..", nil, ErrInvalidName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := d.ReadAll(tt.collection)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadAll() = %v, want %v", err, tt.wantErr)
+			}
+			if len(records) != len(tt.want) {
+				t.Fatalf("ReadAll() = %d records, want %d", len(records), len(tt.want))
+			}
+			for i, r := range records {
+				var got testUser
+				if err := json.Unmarshal([]byte(r), &got); err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want[i] {
+					t.Errorf("record %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name                 string
+		collection, resource string
+		wantErr              error
+		gone, kept           []string // paths under the db dir
+	}{
+		{"record", "users", "ada", nil, []string{"users/ada.json"}, []string{"users/bob.json"}},
+		{"collection", "users", "", nil, []string{"users"}, nil},
+		{"nested collection", "users/admins", "", nil, []string{"users/admins"}, []string{"users/ada.json"}},
+		{"missing record", "users", "cy", ErrNotFound, nil, []string{"users/ada.json"}},
+		{"missing collection", "admins", "", ErrNotFound, nil, []string{"users"}},
+		// used to remove the nested users/admins collection
+		{"resource naming a collection", "users", "admins", ErrNotFound, nil, []string{"users/admins/cy.json"}},
+		{"missing collection name", "", "ada", ErrEmptyCollection, nil, []string{"users/ada.json"}},
+		{"invalid name", "users", "../users", ErrInvalidName, nil, []string{"users"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, dir := newTestDriver(t, nil)
+			for _, r := range []struct{ c, r string }{{"users", "ada"}, {"users", "bob"}, {"users/admins", "cy"}} {
+				if err := d.Write(r.c, r.r, testUser{Name: r.r}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := d.Delete(tt.collection, tt.resource)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Delete() = %v, want %v", err, tt.wantErr)
+			}
+			for _, p := range tt.gone {
+				if _, err := os.Stat(filepath.Join(dir, p)); !os.IsNotExist(err) {
+					t.Errorf("%v still there: %v", p, err)
+				}
+			}
+			for _, p := range tt.kept {
+				if _, err := os.Stat(filepath.Join(dir, p)); err != nil {
+					t.Errorf("%v gone: %v", p, err)
+				}
+			}
+		})
+	}
+}
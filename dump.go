@@ -0,0 +1,179 @@
+package jsondb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dumpedRecord is one element of a collection's array in a DumpAll dump
+type dumpedRecord struct {
+	Resource string          `json:"resource"`
+	Record   json.RawMessage `json:"record"`
+}
+
+// DumpAll writes the whole database as a single JSON object mapping every
+// collection name to the array of its records, each as
+// {"resource": name, "record": {...}}. Collections are read one at a time
+// and records are streamed out as they're read.
+func (d *Driver) DumpAll(w io.Writer) (err error) {
+	defer d.done(OpDumpAll, "", "", time.Now(), &err)
+
+	if err := d.requireJSON("DumpAll"); err != nil {
+		return err
+	}
+
+	collections, err := d.collectionNames()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("{")
+	for i, collection := range collections {
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		key, _ := json.Marshal(collection)
+		fmt.Fprintf(bw, "\n%s: [", key)
+
+		names, err := d.resourceNames(collection)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, name := range names {
+			b, err := d.readRaw(collection, name)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			rec, err := json.Marshal(dumpedRecord{name, b})
+			if err != nil {
+				return fmt.Errorf("unable to dump %v: %w", filepath.Join(collection, name), err)
+			}
+			if n > 0 {
+				bw.WriteString(",")
+			}
+			bw.WriteString("\n")
+			bw.Write(rec)
+			n++
+		}
+		bw.WriteString("\n]")
+	}
+	bw.WriteString("\n}\n")
+
+	return bw.Flush()
+}
+
+// LoadAll restores a dump written by DumpAll, writing every record back into
+// its collection, and returns the number of records written. Records are
+// decoded and written one at a time.
+func (d *Driver) LoadAll(r io.Reader) (n int, err error) {
+	defer d.done(OpLoadAll, "", "", time.Now(), &err)
+
+	if err := d.requireJSON("LoadAll"); err != nil {
+		return 0, err
+	}
+
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return n, err
+		}
+		collection, ok := t.(string)
+		if !ok {
+			return n, fmt.Errorf("invalid dump - expected a collection name, got %v", t)
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return n, err
+		}
+		for dec.More() {
+			var rec dumpedRecord
+			if err := dec.Decode(&rec); err != nil {
+				return n, fmt.Errorf("invalid dump record in %v: %w", collection, err)
+			}
+			if err := d.Write(collection, rec.Resource, rec.Record); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return n, err
+		}
+	}
+
+	return n, expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != want {
+		return fmt.Errorf("invalid dump - expected %v, got %v", want, t)
+	}
+	return nil
+}
+
+// collectionNames lists every collection holding records, nested ones as
+// "parent/child", in sorted order. The trash area and dot directories are
+// skipped.
+func (d *Driver) collectionNames() ([]string, error) {
+	seen := make(map[string]bool)
+
+	err := d.walkDir(d.dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == d.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if rel != "." && (rel == trashDir || rel == metaDir || e.Name() == historyDir || strings.HasPrefix(e.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case d.storage == StorageAppendLog && filepath.Ext(rel) == ".log":
+			seen[filepath.ToSlash(strings.TrimSuffix(rel, ".log"))] = true
+		case d.storage == StorageFiles && filepath.Ext(rel) == d.ext && filepath.Dir(rel) != ".":
+			seen[filepath.ToSlash(filepath.Dir(rel))] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,24 @@
+package jsondb
+
+import (
+	"strconv"
+	"testing"
+)
+
+// BenchmarkWrite measures a record write at every Durability level; the
+// numbers in the Durability doc come from it
+func BenchmarkWrite(b *testing.B) {
+	for _, level := range []Durability{DurabilityNone, DurabilityRelaxed, DurabilityStrict} {
+		b.Run(level.String(), func(b *testing.B) {
+			d, _ := newTestDriver(b, &Options{Durability: level})
+			user := testUser{Name: "Ada", Age: 36}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := d.Write("users", strconv.Itoa(i%64), user); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
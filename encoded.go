@@ -0,0 +1,58 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WriteAllEncoded stores records that are already encoded in the driver's
+// Format, keyed by resource, without a marshal/unmarshal round trip. With
+// the JSON format every record is checked with json.Valid first, and nothing
+// is written if one fails. Records are written in resource order through
+// the usual temp file, under a single hold of the collection mutex.
+func (d *Driver) WriteAllEncoded(collection string, records map[string][]byte) (err error) {
+	defer d.done(OpWriteAllEncoded, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - no place to save records", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+
+	resources := sortedKeys(records)
+	for _, resource := range resources {
+		if resource == "" {
+			return fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+		}
+		if err := d.validateResource(resource); err != nil {
+			return err
+		}
+		if d.format == FormatJSON && !json.Valid(records[resource]) {
+			return fmt.Errorf("invalid JSON in record %v - unable to save records to %v", resource, collection)
+		}
+	}
+
+	if d.storage == StorageAppendLog {
+		for _, resource := range resources {
+			if err := d.writeLog(collection, resource, json.RawMessage(records[resource])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, resource := range resources {
+		if err := d.writeRecord(collection, resource, records[resource]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
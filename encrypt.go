@@ -0,0 +1,314 @@
+package jsondb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrDecrypt is returned when an encrypted record fails authentication: it
+// was corrupted or tampered with, or its key id names the wrong key
+var ErrDecrypt = errors.New("unable to decrypt record")
+
+// sealedMagic starts every encrypted record file; files without it are read
+// as plain records, so a database can switch encryption on without rewriting
+// every record first (see ReEncrypt). A sealed file is the magic, a byte
+// with the key id's length, the key id, the nonce and the AES-GCM ciphertext.
+var sealedMagic = []byte("\x00jdbenc1")
+
+// KeyProvider supplies the AES keys of Options.Encryption: 16, 24 or 32
+// bytes for AES-128, AES-192 or AES-256. Every record stores the id of the
+// key it was encrypted with, so after rotating to a new current key the old
+// ones must stay available from Key until ReEncrypt has rewritten every
+// record. Keys are cached by id once looked up.
+type KeyProvider interface {
+	// CurrentKey returns the key new records are encrypted with, and its id.
+	// It is called on every write, so it should be cheap.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key with the given id
+	Key(id string) ([]byte, error)
+}
+
+type staticKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// StaticKey is a KeyProvider of a single key, with the id "static"
+func StaticKey(key []byte) KeyProvider {
+	return StaticKeys("static", map[string][]byte{"static": key})
+}
+
+// StaticKeys is a KeyProvider of a fixed set of keys, by id, where current
+// names the one to encrypt with and the others are kept for decrypting
+func StaticKeys(current string, keys map[string][]byte) KeyProvider {
+	copied := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		copied[id] = append([]byte(nil), key...)
+	}
+	return &staticKeys{current, copied}
+}
+
+func (k *staticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.current)
+	return k.current, key, err
+}
+
+func (k *staticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+	return key, nil
+}
+
+type envKeys struct {
+	current string
+	old     []string
+}
+
+// EnvKey is a KeyProvider reading base64 encoded keys from environment
+// variables, which double as the key ids. current is the variable holding
+// the key to encrypt with; old lists variables of rotated keys still needed
+// to decrypt.
+func EnvKey(current string, old ...string) KeyProvider {
+	return &envKeys{current, old}
+}
+
+func (k *envKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.current)
+	return k.current, key, err
+}
+
+func (k *envKeys) Key(id string) ([]byte, error) {
+	known := id == k.current
+	for _, v := range k.old {
+		known = known || id == v
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+
+	v, ok := os.LookupEnv(id)
+	if !ok {
+		return nil, fmt.Errorf("encryption key %q is not set in the environment", id)
+	}
+	key, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key %q is not valid base64: %w", id, err)
+	}
+	return key, nil
+}
+
+// KeyFuncs is a KeyProvider calling back into the application, such as to
+// fetch or unwrap data keys from a KMS
+type KeyFuncs struct {
+	Current func() (id string, key []byte, err error)
+	Lookup  func(id string) ([]byte, error)
+}
+
+func (k KeyFuncs) CurrentKey() (string, []byte, error) { return k.Current() }
+
+func (k KeyFuncs) Key(id string) ([]byte, error) { return k.Lookup(id) }
+
+// ciphers caches an AEAD per key id, guarded by mutex
+type ciphers struct {
+	mutex sync.Mutex
+	byID  map[string]cipher.AEAD
+}
+
+// aead returns the cipher of a key, looking the key up unless key is given
+func (d *Driver) aead(id string, key []byte) (cipher.AEAD, error) {
+	c := d.ciphers
+	c.mutex.Lock()
+	aead, ok := c.byID[id]
+	c.mutex.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	if key == nil {
+		var err error
+		if key, err = d.keys.Key(id); err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key %q: %w", id, err)
+	}
+	if aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.byID[id] = aead
+	return aead, nil
+}
+
+// seal encrypts an encoded record with the current key when encryption is
+// on; it returns b unchanged otherwise
+func (d *Driver) seal(b []byte) ([]byte, error) {
+	if d.keys == nil {
+		return b, nil
+	}
+
+	id, key, err := d.keys.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the encryption key: %w", err)
+	}
+	if id == "" || len(id) > 255 {
+		return nil, fmt.Errorf("invalid encryption key id %q - must be 1 to 255 bytes", id)
+	}
+	aead, err := d.aead(id, key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append(append([]byte(nil), sealedMagic...), byte(len(id))), id...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte(nil), header...), nonce...)
+	return aead.Seal(out, nonce, b, header), nil
+}
+
+// sealedKey returns the key id of an encrypted record file
+func sealedKey(b []byte) (id string, ok bool) {
+	if !bytes.HasPrefix(b, sealedMagic) || len(b) <= len(sealedMagic) {
+		return "", false
+	}
+	n := int(b[len(sealedMagic)])
+	start := len(sealedMagic) + 1
+	if len(b) < start+n {
+		return "", false
+	}
+	return string(b[start : start+n]), true
+}
+
+// open decrypts the contents of a record file; plain records are returned
+// as is
+func (d *Driver) open(b []byte) ([]byte, error) {
+	id, ok := sealedKey(b)
+	if !ok {
+		return b, nil
+	}
+	if d.keys == nil {
+		return nil, fmt.Errorf("record is encrypted with key %q, but Options.Encryption is not set", id)
+	}
+
+	aead, err := d.aead(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	header := len(sealedMagic) + 1 + len(id)
+	if len(b) < header+aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce := b[header : header+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, b[header+aead.NonceSize():], b[:header])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// readFile reads a record file, decrypting and decompressing it
+func (d *Driver) readFile(path string) ([]byte, error) {
+	b, err := d.backend.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return d.unpack(b)
+}
+
+// requirePlain fails features whose files would hold record values in the
+// clear when Options.Encryption is set
+func (d *Driver) requirePlain(feature string) error {
+	if d.keys != nil {
+		return fmt.Errorf("%s are not supported with Options.Encryption, they would store record values unencrypted", feature)
+	}
+	return nil
+}
+
+// ReEncrypt rewrites every record of the database not yet encrypted with the
+// current key of Options.Encryption, including plain records written before
+// encryption was switched on, and returns how many it rewrote. Run it after
+// rotating keys; once it returns, the old keys are only needed for records
+// still in the trash. Each collection is locked while it is rewritten.
+func (d *Driver) ReEncrypt() (n int, err error) {
+	defer d.done(OpReEncrypt, "", "", time.Now(), &err)
+
+	if d.keys == nil {
+		return 0, fmt.Errorf("ReEncrypt requires Options.Encryption")
+	}
+	current, _, err := d.keys.CurrentKey()
+	if err != nil {
+		return 0, fmt.Errorf("unable to get the encryption key: %w", err)
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range collections {
+		rewritten, err := d.reEncrypt(c, current)
+		n += rewritten
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (d *Driver) reEncrypt(collection, current string) (int, error) {
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	names, err := d.recordNames(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, name := range names {
+		path := filepath.Join(d.dir, collection, name+d.ext)
+		stored, err := d.backend.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if id, ok := sealedKey(stored); ok && id == current {
+			continue
+		}
+
+		b, err := d.open(stored)
+		if err != nil {
+			return n, fmt.Errorf("unable to re-encrypt %v: %w", filepath.Join(collection, name), err)
+		}
+		if b, err = d.seal(b); err != nil {
+			return n, err
+		}
+		if err := d.writeFile(path+d.tmpSuffix, path, b); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
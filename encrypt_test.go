@@ -0,0 +1,23 @@
+package jsondb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptionRejectsPlainIndexes(t *testing.T) {
+	d, _ := newTestDriver(t, &Options{Encryption: StaticKey(bytes.Repeat([]byte{1}, 32))})
+	if err := d.Write("users", "a", map[string]string{"email": "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.CreateIndex("users", "email"); err == nil {
+		t.Error("CreateIndex succeeded with Encryption set")
+	}
+	if err := d.AddUniqueConstraint("users", "email"); err == nil {
+		t.Error("AddUniqueConstraint succeeded with Encryption set")
+	}
+	if err := d.EnableSearch("users", []string{"email"}); err == nil {
+		t.Error("EnableSearch succeeded with Encryption set")
+	}
+}
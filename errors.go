@@ -0,0 +1,62 @@
+package jsondb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+var (
+	// ErrNotFound is matched by errors.Is for every *NotFoundError
+	ErrNotFound = errors.New("not found")
+
+	// ErrEmptyCollection is wrapped by the error of a call made without a
+	// collection name
+	ErrEmptyCollection = errors.New("missing collection")
+
+	// ErrEmptyResource is wrapped by the error of a call made without a
+	// resource name
+	ErrEmptyResource = errors.New("missing resource")
+
+	// ErrInvalidName is wrapped by the error of a call made with a name that
+	// would leave the database dir, that the driver reserves, or that
+	// Options.CollectionNameValidator or ResourceNameValidator rejects
+	ErrInvalidName = errors.New("invalid name")
+)
+
+// NotFoundError reports a record, or a whole collection when Resource is
+// empty, that doesn't exist. It matches both ErrNotFound and fs.ErrNotExist
+// with errors.Is.
+type NotFoundError struct {
+	Collection string
+	Resource   string
+	Err        error // underlying cause, wraps fs.ErrNotExist
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Resource == "" {
+		return fmt.Sprintf("unable to find collection named %v", e.Collection)
+	}
+	return fmt.Sprintf("unable to find record named %v in %v", e.Resource, e.Collection)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// notFound turns a missing file error into a *NotFoundError and returns any
+// other error unchanged
+func notFound(collection, resource string, err error) error {
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var nf *NotFoundError
+	if errors.As(err, &nf) {
+		return err
+	}
+	return &NotFoundError{Collection: collection, Resource: resource, Err: err}
+}
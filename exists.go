@@ -0,0 +1,145 @@
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// resourceNames lists the live resources of a collection in either storage;
+// a missing collection has none
+func (d *Driver) resourceNames(collection string) ([]string, error) {
+	var names []string
+	var err error
+	if d.storage == StorageAppendLog {
+		names, _, err = d.liveLog(collection)
+	} else {
+		names, err = d.recordNames(collection)
+	}
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return names, err
+}
+
+// Exists reports whether a record is stored, without reading it. With
+// Options.BloomFilterBits set, resources the collection's Bloom filter has
+// never seen are reported missing without touching the disk.
+func (d *Driver) Exists(collection, resource string) (ok bool, err error) {
+	defer d.done(OpExists, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return false, fmt.Errorf("%w - unable to check record", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return false, fmt.Errorf("%w - unable to check record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return false, err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return false, err
+	}
+
+	if d.blooms != nil {
+		mutex := d.getOrCreateMutex(collection)
+		mutex.Lock()
+		maybe, err := d.bloomMayContain(collection, resource)
+		mutex.Unlock()
+		if err != nil || !maybe {
+			return false, err
+		}
+	}
+
+	if d.storage == StorageAppendLog {
+		_, _, err := d.findLog(collection, resource)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	fi, err := d.backend.Stat(filepath.Join(d.dir, collection, resource+d.ext))
+	if os.IsNotExist(err) || (err == nil && d.expired(collection, resource)) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return fi.Mode().IsRegular(), nil
+}
+
+// BulkExists reports which of resources are stored in a collection, listing
+// the collection once instead of doing one stat per resource
+func (d *Driver) BulkExists(collection string, resources []string) (found map[string]bool, err error) {
+	defer d.done(OpBulkExists, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to check records", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	for _, r := range resources {
+		if err := d.validateResource(r); err != nil {
+			return nil, err
+		}
+	}
+
+	names, err := d.resourceNames(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool, len(names))
+	for _, name := range names {
+		stored[name] = true
+	}
+
+	found = make(map[string]bool, len(resources))
+	for _, r := range resources {
+		found[r] = stored[r]
+	}
+	return found, nil
+}
+
+// Count returns the number of records in a collection from its directory
+// listing, without reading them. A missing collection has none. With the
+// appendlog storage the log is scanned instead.
+func (d *Driver) Count(collection string) (n int, err error) {
+	defer d.done(OpCount, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to count records", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return 0, err
+	}
+
+	names, err := d.resourceNames(collection)
+	return len(names), err
+}
+
+// Keys returns the resource names of a collection, sorted, from its
+// directory listing. A missing collection has none. With the appendlog
+// storage the log is scanned instead.
+func (d *Driver) Keys(collection string) (keys []string, err error) {
+	defer d.done(OpKeys, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to list records", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	keys, err = d.resourceNames(collection)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
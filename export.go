@@ -0,0 +1,303 @@
+package jsondb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExportFormat selects the file format of ExportCollection and
+// ImportCollection
+type ExportFormat string
+
+const (
+	// ExportNDJSON is newline-delimited JSON: one compact record per line
+	ExportNDJSON ExportFormat = "ndjson"
+
+	// ExportCSV is CSV with a header row naming the top-level fields of the
+	// records, one column per field. Strings are written as is, null as an
+	// empty cell, and numbers, booleans, objects and arrays as JSON.
+	ExportCSV ExportFormat = "csv"
+)
+
+// ExportCollection writes every record of a collection to w in format, in
+// resource order. CSV export requires every record to be a JSON object.
+func (d *Driver) ExportCollection(collection string, format ExportFormat, w io.Writer) (err error) {
+	defer d.done(OpExportCollection, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to export", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.requireJSON("ExportCollection"); err != nil {
+		return err
+	}
+	if format != ExportNDJSON && format != ExportCSV {
+		return fmt.Errorf("invalid export format %q - must be %q or %q", format, ExportNDJSON, ExportCSV)
+	}
+
+	names, err := d.resourceNames(collection)
+	if err != nil {
+		return err
+	}
+
+	if format == ExportCSV {
+		return d.exportCSV(collection, names, w)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var line bytes.Buffer
+		if err := json.Compact(&line, b); err != nil {
+			return fmt.Errorf("unable to export %v: %w", filepath.Join(collection, name), err)
+		}
+		line.WriteByte('\n')
+		bw.Write(line.Bytes())
+	}
+	return bw.Flush()
+}
+
+// exportCSV reads every record first, to know the columns
+func (d *Driver) exportCSV(collection string, names []string, w io.Writer) error {
+	var rows []map[string]json.RawMessage
+	fields := make(map[string]bool)
+	for _, name := range names {
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var row map[string]json.RawMessage
+		if err := json.Unmarshal(b, &row); err != nil || row == nil {
+			return fmt.Errorf("unable to export %v as CSV - not a JSON object", filepath.Join(collection, name))
+		}
+		for field := range row {
+			fields[field] = true
+		}
+		rows = append(rows, row)
+	}
+
+	header := sortedKeys(fields)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	cells := make([]string, len(header))
+	for _, row := range rows {
+		for i, field := range header {
+			cells[i] = csvCell(row[field])
+		}
+		if err := cw.Write(cells); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvCell(v json.RawMessage) string {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	if v == nil || string(v) == "null" {
+		return ""
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, v) != nil {
+		return string(v)
+	}
+	return compact.String()
+}
+
+// ImportCollection writes every record read from r in format into a
+// collection and returns how many it wrote. Each record is stored under the
+// value of its keyField, which must be a string or a number, replacing any
+// record of that name; with an empty keyField records are stored with Insert
+// under generated ids. CSV cells become string fields except those holding a
+// JSON number, boolean, object or array, and empty cells are left out, so a
+// CSV round trip is lossy: a "123" or "true" string field comes back as a
+// number or a boolean, and empty strings and nulls are dropped; NDJSON
+// round trips are exact. Records are written one at a time, so an error
+// leaves the records before it imported.
+func (d *Driver) ImportCollection(collection string, format ExportFormat, r io.Reader, keyField string) (n int, err error) {
+	defer d.done(OpImportCollection, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to import", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return 0, err
+	}
+	if err := d.requireJSON("ImportCollection"); err != nil {
+		return 0, err
+	}
+
+	var next func() (map[string]json.RawMessage, json.RawMessage, error)
+	switch format {
+	case ExportNDJSON:
+		next = ndjsonRecords(r)
+	case ExportCSV:
+		next = csvRecords(r)
+	default:
+		return 0, fmt.Errorf("invalid import format %q - must be %q or %q", format, ExportNDJSON, ExportCSV)
+	}
+
+	for line := 1; ; line++ {
+		fields, raw, err := next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("unable to import record %d: %w", line, err)
+		}
+
+		if keyField == "" {
+			rec := make(map[string]interface{}, len(fields))
+			for k, v := range fields {
+				rec[k] = v
+			}
+			if _, err := d.Insert(collection, rec); err != nil {
+				return n, err
+			}
+			n++
+			continue
+		}
+
+		resource, err := importKey(fields[keyField])
+		if err != nil {
+			return n, fmt.Errorf("unable to import record %d: %s %w", line, keyField, err)
+		}
+		if err := d.Write(collection, resource, raw); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// importKey turns the key field of an imported record into a resource name
+func importKey(v json.RawMessage) (string, error) {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		if s == "" {
+			return "", fmt.Errorf("is empty")
+		}
+		return s, nil
+	}
+	var num json.Number
+	if json.Unmarshal(v, &num) == nil {
+		return num.String(), nil
+	}
+	if v == nil {
+		return "", fmt.Errorf("is missing")
+	}
+	return "", fmt.Errorf("must be a string or a number, got %s", v)
+}
+
+// ndjsonRecords returns an iterator over the JSON objects of r, one per
+// non-blank line
+func ndjsonRecords(r io.Reader) func() (map[string]json.RawMessage, json.RawMessage, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	return func() (map[string]json.RawMessage, json.RawMessage, error) {
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(line, &fields); err != nil || fields == nil {
+				return nil, nil, fmt.Errorf("not a JSON object: %.40s", line)
+			}
+			return fields, append(json.RawMessage(nil), line...), nil
+		}
+		if err := sc.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, io.EOF
+	}
+}
+
+// csvRecords returns an iterator over the rows of r as JSON objects keyed by
+// the header row
+func csvRecords(r io.Reader) func() (map[string]json.RawMessage, json.RawMessage, error) {
+	cr := csv.NewReader(r)
+	var header []string
+	return func() (map[string]json.RawMessage, json.RawMessage, error) {
+		if header == nil {
+			var err error
+			if header, err = cr.Read(); err != nil {
+				return nil, nil, err
+			}
+			for i := range header {
+				header[i] = strings.TrimSpace(header[i])
+			}
+		}
+
+		cells, err := cr.Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		fields := make(map[string]json.RawMessage, len(header))
+		for i, cell := range cells {
+			if cell == "" || header[i] == "" {
+				continue
+			}
+			fields[header[i]] = csvValue(cell)
+		}
+
+		// encode in header order, as a spreadsheet user would expect
+		var raw bytes.Buffer
+		raw.WriteByte('{')
+		keys := make([]string, 0, len(fields))
+		for _, h := range header {
+			if _, ok := fields[h]; ok {
+				keys = append(keys, h)
+			}
+		}
+		for i, k := range keys {
+			if i > 0 {
+				raw.WriteByte(',')
+			}
+			key, _ := json.Marshal(k)
+			raw.Write(key)
+			raw.WriteByte(':')
+			raw.Write(fields[k])
+		}
+		raw.WriteByte('}')
+		return fields, raw.Bytes(), nil
+	}
+}
+
+// csvValue parses a CSV cell into a JSON value
+func csvValue(cell string) json.RawMessage {
+	trimmed := strings.TrimSpace(cell)
+	if trimmed == "true" || trimmed == "false" {
+		return json.RawMessage(trimmed)
+	}
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[' || trimmed[0] == '-' || trimmed[0] >= '0' && trimmed[0] <= '9') && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	s, _ := json.Marshal(cell)
+	return s
+}
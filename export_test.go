@@ -0,0 +1,138 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// exportRoundTrip exports users in format and imports the result into
+// copies, keyed by id
+func exportRoundTrip(t *testing.T, d *Driver, format ExportFormat) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := d.ExportCollection("users", format, &buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if _, err := d.ImportCollection("copies", format, &buf, "id"); err != nil {
+		t.Fatalf("ImportCollection(%s) = %v", out, err)
+	}
+	return out
+}
+
+// sameRecord reports whether the record r of copies holds the same JSON as
+// want
+func sameRecord(t *testing.T, d *Driver, r, want string) bool {
+	t.Helper()
+	var got json.RawMessage
+	if err := d.Read("copies", r, &got); err != nil {
+		t.Errorf("Read(copies, %v) = %v", r, err)
+		return false
+	}
+	g, err := decodeDocument(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := decodeDocument([]byte(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonEqual(g, w)
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	records := map[string]string{
+		"ada": `{"id": "ada", "Name": "Ada", "Age": 36, "Tags": ["a", "b"], "Address": {"City": "London"}}`,
+		"bob": `{"id": "bob", "Name": "Bob, \"the\" builder\nof things", "Score": 1.5e-7, "Big": 12345678901234567890}`,
+		"cy":  `{"id": "cy", "Name": "Cy", "Zip": "00123", "Admin": true, "Note": "", "Boss": null}`,
+		"7":   `{"id": 7, "Name": "Seven"}`,
+	}
+	setup := func(t *testing.T) *Driver {
+		d, _ := newTestDriver(t, nil)
+		for r, doc := range records {
+			if err := d.Write("users", r, json.RawMessage(doc)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return d
+	}
+
+	t.Run("ndjson", func(t *testing.T) {
+		d := setup(t)
+		out := exportRoundTrip(t, d, ExportNDJSON)
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		if len(lines) != len(records) || !strings.HasPrefix(lines[0], `{"id":7,`) {
+			t.Errorf("ExportCollection() = %q, want one compact record per line in resource order", out)
+		}
+		for r, doc := range records {
+			if !sameRecord(t, d, r, doc) {
+				t.Errorf("NDJSON round trip of %v changed the record", r)
+			}
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		d := setup(t)
+		out := exportRoundTrip(t, d, ExportCSV)
+		if header, _, _ := strings.Cut(out, "\n"); header != "Address,Admin,Age,Big,Boss,Name,Note,Score,Tags,Zip,id" {
+			t.Errorf("CSV header = %q, want every field, sorted", header)
+		}
+		for _, r := range []string{"ada", "bob", "7"} {
+			if !sameRecord(t, d, r, records[r]) {
+				t.Errorf("CSV round trip of %v changed the record", r)
+			}
+		}
+		// the documented losses: "00123" isn't JSON so it stays a string,
+		// but empty strings and nulls are dropped
+		if !sameRecord(t, d, "cy", `{"id": "cy", "Name": "Cy", "Zip": "00123", "Admin": true}`) {
+			t.Error("CSV round trip of cy kept its empty fields")
+		}
+	})
+
+	t.Run("csv strings that look like JSON", func(t *testing.T) {
+		d, _ := newTestDriver(t, nil)
+		if err := d.Write("users", "ada", json.RawMessage(`{"id": "ada", "Phone": "123", "Flag": "true", "List": "[1]"}`)); err != nil {
+			t.Fatal(err)
+		}
+		exportRoundTrip(t, d, ExportCSV)
+		if !sameRecord(t, d, "ada", `{"id": "ada", "Phone": 123, "Flag": true, "List": [1]}`) {
+			t.Error("CSV import kept string fields holding JSON as strings")
+		}
+	})
+}
+
+func TestImportCollection(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   ExportFormat
+		in       string
+		keyField string
+		want     int
+		err      string
+	}{
+		{"ndjson blank lines", ExportNDJSON, "\n{\"id\":\"a\"}\n\n  \n{\"id\":2}\n", "id", 2, ""},
+		{"ndjson generated ids", ExportNDJSON, "{\"Name\":\"a\"}\n{\"Name\":\"b\"}\n", "", 2, ""},
+		{"ndjson not an object", ExportNDJSON, "{\"id\":\"a\"}\n[1]\n", "id", 1, "record 2: not a JSON object"},
+		{"ndjson missing key", ExportNDJSON, "{\"Name\":\"a\"}\n", "id", 0, "record 1: id is missing"},
+		{"ndjson empty key", ExportNDJSON, "{\"id\":\"\"}\n", "id", 0, "record 1: id is empty"},
+		{"ndjson object key", ExportNDJSON, "{\"id\":{}}\n", "id", 0, "record 1: id must be a string or a number"},
+		{"csv", ExportCSV, " id ,Name\na,Ada\nb,\n", "id", 2, ""},
+		{"csv ragged row", ExportCSV, "id,Name\na,Ada\nb\n", "id", 1, "record 2"},
+		{"empty csv", ExportCSV, "", "id", 0, ""},
+		{"unknown format", "xml", "", "id", 0, "invalid import format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDriver(t, nil)
+			n, err := d.ImportCollection("users", tt.format, strings.NewReader(tt.in), tt.keyField)
+			if n != tt.want || tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("ImportCollection() = %d, %v, want %d, %q", n, err, tt.want, tt.err)
+			}
+			if records, err := d.ReadAll("users"); len(records) != n {
+				t.Errorf("records after import = %q, %v, want %d", records, err, n)
+			}
+		})
+	}
+}
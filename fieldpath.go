@@ -0,0 +1,62 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// lookupPath returns the value at a dotted field path ("Address.City") of a
+// decoded JSON document
+func lookupPath(doc interface{}, path string) (interface{}, bool) {
+	v := doc
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// setPath stores v at a dotted field path of doc, creating the intermediate
+// objects
+func setPath(doc map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := doc[part].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			doc[part] = child
+		}
+		doc = child
+	}
+	doc[parts[len(parts)-1]] = v
+}
+
+// projectFields keeps only the given dotted field paths of a document
+func projectFields(doc interface{}, paths []string) map[string]interface{} {
+	out := make(map[string]interface{})
+	for _, path := range paths {
+		if v, ok := lookupPath(doc, path); ok {
+			setPath(out, path, v)
+		}
+	}
+	return out
+}
+
+// decodeDocument decodes a JSON record keeping numbers as json.Number, so
+// they survive re-encoding unchanged
+func decodeDocument(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,108 @@
+package jsondb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked is returned when another process holds a collection's file lock
+// for longer than Options.LockTimeout
+var ErrLocked = errors.New("collection is locked by another process")
+
+// lockPath is the advisory lock file of a collection, <dir>/<collection>.lock
+func (d *Driver) lockPath(collection string) string {
+	return filepath.Join(d.dir, collection+".lock")
+}
+
+// probeLockFile is taken and released by New with Options.FileLocking, so a
+// platform or file system without file locks fails New rather than the first
+// write. Dot names can't be collections.
+const probeLockFile = ".lock"
+
+func (d *Driver) probeFileLocking() error {
+	f, err := d.lockFile(filepath.Join(d.dir, probeLockFile))
+	if err != nil {
+		return fmt.Errorf("FileLocking is not available in %v: %w", d.dir, err)
+	}
+	err = unlockFile(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// lockCollection takes the collection mutex and, with Options.FileLocking,
+// the collection's file lock, which keeps other processes out. Call the
+// returned func to release both. The time taken is reported to
+// Options.Metrics.
+func (d *Driver) lockCollection(collection string) (func(), error) {
+	start := time.Now()
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	if err := d.checkWritable(collection); err != nil {
+		mutex.Unlock()
+		return nil, err
+	}
+	if !d.fileLocking {
+		d.lockWaited(collection, start)
+		return mutex.Unlock, nil
+	}
+
+	f, err := d.lockFile(d.lockPath(collection))
+	if err != nil {
+		mutex.Unlock()
+		return nil, fmt.Errorf("unable to lock %v: %w", collection, err)
+	}
+	d.lockWaited(collection, start)
+
+	return func() {
+		if err := unlockFile(f); err != nil {
+			d.log.Error("Unable to unlock", "collection", collection, "error", err)
+		}
+		f.Close()
+		mutex.Unlock()
+	}, nil
+}
+
+func (d *Driver) lockWaited(collection string, start time.Time) {
+	if d.metrics != nil {
+		d.metrics.ObserveLockWait(collection, time.Since(start))
+	}
+}
+
+// lockFile opens path and takes an exclusive lock on it, retrying until
+// Options.LockTimeout has passed
+func (d *Driver) lockFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(d.lockTimeout)
+	wait := time.Millisecond
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			return f, nil
+		}
+		if d.lockTimeout > 0 && time.Now().After(deadline) {
+			f.Close()
+			return nil, ErrLocked
+		}
+
+		time.Sleep(wait)
+		if wait < 100*time.Millisecond {
+			wait *= 2
+		}
+	}
+}
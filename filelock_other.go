@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly || windows)
+
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func tryLockFile(f *os.File) (bool, error) {
+	return false, fmt.Errorf("file locking is not supported on %s", runtime.GOOS)
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
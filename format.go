@@ -0,0 +1,141 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// FormatJSON stores records as indented JSON in .json files
+	FormatJSON = "json"
+
+	// FormatGob stores records with encoding/gob in .gob files. It keeps Go
+	// type fidelity that JSON loses, but gob streams carry no universal
+	// schema: a record can only be read back into the same Go type it was
+	// written from (or one gob considers compatible). Raw records returned by
+	// ReadAll and friends are gob bytes, and JSON-only features such as
+	// WatchSchema and InferSchema are unavailable. Use GobTyped to have the
+	// compiler check the types on both sides.
+	FormatGob = "gob"
+)
+
+// Codec encodes records for storage; see Options.Codec
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+
+	// Extension is the record file extension, dot included, such as ".yaml"
+	Extension() string
+}
+
+var (
+	// JSONCodec stores records as tab indented JSON in .json files, the
+	// default (FormatJSON)
+	JSONCodec Codec = jsonCodec{indent: true}
+
+	// CompactJSONCodec stores records as JSON without indentation in .json
+	// files. Records are JSON either way, so the JSON-only features work
+	// with both and a database can switch between them.
+	CompactJSONCodec Codec = jsonCodec{}
+
+	// GobCodec is FormatGob
+	GobCodec Codec = gobCodec{}
+)
+
+type jsonCodec struct {
+	indent bool
+}
+
+func (c jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	var b []byte
+	var err error
+	if c.indent {
+		b, err = json.MarshalIndent(v, "", "\t")
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(b, byte('\n')), nil
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, &v)
+}
+
+func (jsonCodec) Extension() string { return ".json" }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(b []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+func (gobCodec) Extension() string { return ".gob" }
+
+// codecFormat names the format of a codec: FormatJSON and FormatGob for the
+// built-in codecs, the extension without its dot for any other
+func codecFormat(c Codec) string {
+	switch c.(type) {
+	case jsonCodec:
+		return FormatJSON
+	case gobCodec:
+		return FormatGob
+	}
+	return strings.TrimPrefix(c.Extension(), ".")
+}
+
+// encode marshals a record with the driver's codec
+func (d *Driver) encode(v interface{}) ([]byte, error) {
+	return d.codec.Marshal(v)
+}
+
+// decode unmarshals a record stored with the driver's codec into v
+func (d *Driver) decode(b []byte, v interface{}) error {
+	return d.codec.Unmarshal(b, v)
+}
+
+// requireJSON fails features that need to look inside records when the
+// driver doesn't store JSON
+func (d *Driver) requireJSON(feature string) error {
+	if d.format != FormatJSON {
+		return fmt.Errorf("%s requires the %s format, driver uses %s", feature, FormatJSON, d.format)
+	}
+	return nil
+}
+
+// GobTyped reads and writes records of a single Go type T, so a gob record
+// can't be written from one type and read into another by mistake
+type GobTyped[T any] struct {
+	d          *Driver
+	collection string
+}
+
+// NewGobTyped binds a collection to the record type T
+func NewGobTyped[T any](d *Driver, collection string) *GobTyped[T] {
+	return &GobTyped[T]{d: d, collection: collection}
+}
+
+// Write stores v under resource
+func (g *GobTyped[T]) Write(resource string, v T) error {
+	return g.d.Write(g.collection, resource, v)
+}
+
+// Read returns the record stored under resource
+func (g *GobTyped[T]) Read(resource string) (T, error) {
+	var v T
+	err := g.d.Read(g.collection, resource, &v)
+	return v, err
+}
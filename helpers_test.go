@@ -0,0 +1,32 @@
+package jsondb
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// quietSlog discards everything logged through it
+var quietSlog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestDriver opens a database on a fresh temp dir with options, which may
+// be nil, logging nothing unless they set a logger. It is closed when the
+// test finishes.
+func newTestDriver(t testing.TB, options *Options) (*Driver, string) {
+	t.Helper()
+
+	opts := Options{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Logger == nil && opts.Slog == nil {
+		opts.Slog = quietSlog
+	}
+	dir := t.TempDir()
+	d, err := New(dir, &opts)
+	if err != nil {
+		t.Fatalf("unable to create test driver: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, dir
+}
@@ -0,0 +1,289 @@
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyDir is the dir of a collection that the replaced versions of its
+// records are kept in, one dir per record: <collection>/_history/<resource>/
+// <rev>.json. No collection can be named after it.
+const historyDir = "_history"
+
+// HistoryOptions turn on record history: every write replacing a record
+// first copies the stored version into the record's history, where History
+// lists it and ReadRevision reads it back. The zero value keeps every
+// version forever.
+type HistoryOptions struct {
+	// Keep bounds the number of versions kept per record, dropping the
+	// oldest first. Zero keeps them all.
+	Keep int
+
+	// MaxAge drops versions replaced longer ago than that. Zero keeps them
+	// however old.
+	MaxAge time.Duration
+}
+
+func (h HistoryOptions) problems() []string {
+	var problems []string
+	if h.Keep < 0 {
+		problems = append(problems, fmt.Sprintf("Keep must not be negative, got %d", h.Keep))
+	}
+	if h.MaxAge < 0 {
+		problems = append(problems, fmt.Sprintf("MaxAge must not be negative, got %v", h.MaxAge))
+	}
+	return problems
+}
+
+// Revision is a version of a record that a later write replaced
+type Revision struct {
+	Number   uint64    // counts the versions of the record from 1, oldest first
+	Replaced time.Time // when the write replacing it was made
+}
+
+// history returns the history settings of a collection: its own, else the
+// driver's, nil when history is off
+func (d *Driver) history(collection string) *HistoryOptions {
+	if h := d.collections[collection].History; h != nil {
+		return h
+	}
+	return d.defaultHistory
+}
+
+func (d *Driver) historyPath(collection, resource string) string {
+	return filepath.Join(d.dir, collection, historyDir, resource)
+}
+
+// History returns the replaced versions of a record kept in its history,
+// oldest first; the current version isn't among them. It is empty for records
+// never replaced and collections without history. The history of a deleted
+// record is kept until the collection is deleted, and RenameResource leaves
+// it under the old name.
+func (d *Driver) History(collection, resource string) (revisions []Revision, err error) {
+	defer d.done(OpHistory, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read history", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return nil, fmt.Errorf("%w - unable to read history (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return nil, err
+	}
+	if err := d.requireFiles("History"); err != nil {
+		return nil, err
+	}
+
+	return d.revisions(collection, resource)
+}
+
+// ReadRevision decodes a version of a record kept in its history into v
+func (d *Driver) ReadRevision(collection, resource string, number uint64, v interface{}) (err error) {
+	defer d.done(OpReadRevision, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to read revision", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to read revision (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+	if err := d.requireFiles("ReadRevision"); err != nil {
+		return err
+	}
+
+	b, err := d.readFile(filepath.Join(d.historyPath(collection, resource), strconv.FormatUint(number, 10)+d.ext))
+	if err != nil {
+		return notFound(collection, fmt.Sprintf("%s revision %d", resource, number), err)
+	}
+	return d.decode(b, v)
+}
+
+// VersionedRecord is a version of a record, as ReadAllVersions returns it
+type VersionedRecord struct {
+	Version   int       // counts the versions of the record from 1, as Revision.Number
+	WrittenAt time.Time // zero when unknown, see ReadAllVersions
+	Raw       string    // the encoded record, as ReadAll returns it
+}
+
+// ReadAllVersions returns the versions of a record kept in its history
+// followed by the current one, oldest first, so the current version has the
+// highest Version. Without history it returns the current version alone.
+// WrittenAt is the update time Options.Metadata kept in the version, else
+// when the version before it was replaced, for the versions that follow one
+// still in the history, and the file's modification time for the current
+// one. A deleted record whose history is kept returns its history.
+func (d *Driver) ReadAllVersions(collection, resource string) (versions []VersionedRecord, err error) {
+	defer d.done(OpReadAllVersions, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read versions", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return nil, fmt.Errorf("%w - unable to read versions (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return nil, err
+	}
+	if err := d.requireFiles("ReadAllVersions"); err != nil {
+		return nil, err
+	}
+
+	// a write in between would move the current version into the history
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	revisions, err := d.revisions(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range revisions {
+		b, err := d.readFile(filepath.Join(d.historyPath(collection, resource), strconv.FormatUint(r.Number, 10)+d.ext))
+		if os.IsNotExist(err) {
+			continue // pruned since it was listed
+		}
+		if err != nil {
+			return nil, err
+		}
+		v := VersionedRecord{Version: int(r.Number), Raw: string(b)}
+		if i > 0 && revisions[i-1].Number == r.Number-1 {
+			v.WrittenAt = revisions[i-1].Replaced
+		}
+		versions = append(versions, d.writtenAt(v, b))
+	}
+
+	b, err := d.readRaw(collection, resource)
+	if os.IsNotExist(err) && len(versions) > 0 {
+		return versions, nil
+	}
+	if err != nil {
+		return nil, notFound(collection, resource, err)
+	}
+	v := VersionedRecord{Version: 1, Raw: string(b)}
+	if n := len(revisions); n > 0 {
+		v.Version = int(revisions[n-1].Number) + 1
+	}
+	if fi, err := d.stat(filepath.Join(d.dir, collection, resource)); err == nil {
+		v.WrittenAt = fi.ModTime()
+	}
+	return append(versions, d.writtenAt(v, b)), nil
+}
+
+// writtenAt returns v with the update time kept in b, if any
+func (d *Driver) writtenAt(v VersionedRecord, b []byte) VersionedRecord {
+	if meta, ok := d.recordMeta(b); ok && !meta.UpdatedAt.IsZero() {
+		v.WrittenAt = meta.UpdatedAt
+	}
+	return v
+}
+
+// revisions lists the history of a record, oldest first
+func (d *Driver) revisions(collection, resource string) ([]Revision, error) {
+	files, err := d.backend.ReadDir(d.historyPath(collection, resource))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []Revision
+	for _, file := range files {
+		n, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), d.ext), 10, 64)
+		if file.IsDir() || filepath.Ext(file.Name()) != d.ext || err != nil {
+			continue // temp files of writes in flight
+		}
+		fi, err := file.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, Revision{Number: n, Replaced: fi.ModTime()})
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Number < revisions[j].Number })
+	return revisions, nil
+}
+
+// archiveRecord copies the stored file of a record into its history before a
+// write replaces it, then drops the versions the retention no longer keeps.
+// The caller must hold the collection mutex.
+func (d *Driver) archiveRecord(collection, resource string) error {
+	h := d.history(collection)
+	if h == nil {
+		return nil
+	}
+
+	b, err := d.backend.ReadFile(filepath.Join(d.dir, collection, resource+d.ext))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	revisions, err := d.revisions(collection, resource)
+	if err != nil {
+		return err
+	}
+	next := uint64(1)
+	if len(revisions) > 0 {
+		next = revisions[len(revisions)-1].Number + 1
+	}
+
+	dir := d.historyPath(collection, resource)
+	if err := d.backend.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, strconv.FormatUint(next, 10)+d.ext)
+	if err := d.writeFile(path+d.tmpSuffix, path, b); err != nil {
+		return fmt.Errorf("unable to archive %v: %w", filepath.Join(collection, resource), err)
+	}
+
+	revisions = append(revisions, Revision{Number: next, Replaced: time.Now()})
+	_, err = d.pruneHistory(collection, resource, revisions, *h)
+	return err
+}
+
+// pruneHistory removes the revisions of a record h doesn't keep and returns
+// how many it removed
+func (d *Driver) pruneHistory(collection, resource string, revisions []Revision, h HistoryOptions) (int, error) {
+	dir := d.historyPath(collection, resource)
+	n := 0
+	for i, r := range revisions {
+		tooMany := h.Keep > 0 && len(revisions)-i > h.Keep
+		tooOld := h.MaxAge > 0 && time.Since(r.Replaced) > h.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		err := d.backend.Remove(filepath.Join(dir, strconv.FormatUint(r.Number, 10)+d.ext))
+		if err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		if err == nil {
+			n++
+		}
+	}
+	return n, nil
+}
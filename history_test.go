@@ -0,0 +1,85 @@
+package jsondb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadAllVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		want    []int // the ages of the versions returned
+	}{
+		{"history", Options{History: &HistoryOptions{}}, []int{1, 2, 3}},
+		{"history with metadata", Options{History: &HistoryOptions{}, Metadata: true}, []int{1, 2, 3}},
+		{"keep 1", Options{History: &HistoryOptions{Keep: 1}}, []int{2, 3}},
+		{"no history", Options{}, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDriver(t, &tt.options)
+			start := time.Now().Add(-time.Second)
+			for age := 1; age <= 3; age++ {
+				if err := d.Write("users", "ada", testUser{"Ada", age}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			versions, err := d.ReadAllVersions("users", "ada")
+			if err != nil || len(versions) != len(tt.want) {
+				t.Fatalf("ReadAllVersions() = %+v, %v, want %d versions", versions, err, len(tt.want))
+			}
+			for i, v := range versions {
+				var u testUser
+				if err := d.decode([]byte(v.Raw), &u); err != nil || u.Age != tt.want[i] {
+					t.Errorf("version %d = %s, %v, want age %d", i, v.Raw, err, tt.want[i])
+				}
+				if tt.options.History != nil && v.Version != tt.want[i] {
+					t.Errorf("version %d is numbered %d, want %d", i, v.Version, tt.want[i])
+				}
+				if (i > 0 || tt.options.Metadata) && v.WrittenAt.Before(start) {
+					t.Errorf("version %d written at %v, before the test started", i, v.WrittenAt)
+				}
+				if i > 0 && v.WrittenAt.Before(versions[i-1].WrittenAt) {
+					t.Errorf("version %d written at %v, before the version it replaced", i, v.WrittenAt)
+				}
+			}
+			if tt.options.History == nil && versions[0].Version != 1 {
+				t.Errorf("current version without history is numbered %d, want 1", versions[0].Version)
+			}
+			if tt.name == "history" && !versions[0].WrittenAt.IsZero() {
+				t.Errorf("oldest version written at %v, want zero without metadata", versions[0].WrittenAt)
+			}
+
+			history, err := d.History("users", "ada")
+			if err != nil || len(history) != len(tt.want)-1 {
+				t.Errorf("History() = %+v, %v, want %d revisions", history, err, len(tt.want)-1)
+			}
+		})
+	}
+
+	t.Run("deleted", func(t *testing.T) {
+		d, _ := newTestDriver(t, &Options{History: &HistoryOptions{}})
+		for age := 1; age <= 2; age++ {
+			if err := d.Write("users", "ada", testUser{"Ada", age}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.Delete("users", "ada"); err != nil {
+			t.Fatal(err)
+		}
+		versions, err := d.ReadAllVersions("users", "ada")
+		if err != nil || len(versions) != 1 || versions[0].Version != 1 {
+			t.Errorf("ReadAllVersions() of a deleted record = %+v, %v, want its history", versions, err)
+		}
+		var u testUser
+		if err := d.ReadRevision("users", "ada", 1, &u); err != nil || u.Age != 1 {
+			t.Errorf("ReadRevision(1) = %+v, %v", u, err)
+		}
+		if _, err := d.ReadAllVersions("users", "bob"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ReadAllVersions() of a record never written = %v, want ErrNotFound", err)
+		}
+	})
+}
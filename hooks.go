@@ -0,0 +1,107 @@
+package jsondb
+
+// Hook intercepts Write, Read and Delete calls; register it with Use. Any of
+// its funcs may be nil. Before funcs run once the names are checked and
+// before anything is locked or touched; an error from one aborts the call
+// and is returned as is. After funcs see the call's final error. Hooks run in
+// the order they were registered.
+type Hook struct {
+	// BeforeWrite may return a replacement for v, such as a copy with a
+	// timestamp set, which is what gets stored, or reject the write. It also
+	// runs for WriteWithTTL and for the writes staged by Transaction and
+	// WriteBatch, whose AfterWrite runs once they commit. For Insert,
+	// Update, Upsert, Patch, Increment and WriteIfRevision it runs under the
+	// collection lock with the new record, so it must not call the driver
+	// on the same collection.
+	BeforeWrite func(collection, resource string, v interface{}) (interface{}, error)
+	AfterWrite  func(collection, resource string, v interface{}, err error)
+
+	// AfterRead may change the value v points to before the caller sees it.
+	// ReadAll, Find and the FindModified methods run both with an empty
+	// resource and v pointing to the records returned, a []string or a
+	// []json.RawMessage. Iterate runs BeforeRead with an empty resource,
+	// and Cursor.Decode runs AfterRead for each record it decodes.
+	BeforeRead func(collection, resource string) error
+	AfterRead  func(collection, resource string, v interface{}, err error)
+
+	// resource is empty when a whole collection is deleted
+	BeforeDelete func(collection, resource string) error
+	AfterDelete  func(collection, resource string, err error)
+}
+
+// Use returns a driver sharing d's storage and locks that runs h around the
+// calls that write, read or delete records, after the hooks already
+// registered on d; methods built on Write and Read, such as LoadAll,
+// ImportCollection, ReadWithMeta and ReadPopulated, run them too. Methods
+// that copy or move stored records as they are don't run hooks:
+// RenameResource, RenameCollection, CopyCollection, Undelete,
+// ForceUndelete, WriteAllEncoded, Restore, Migrate and MigrateAll, and the
+// janitor's expiry removals. Neither do ReadAt, ReadRevision, History,
+// ReadAllVersions, RandSample, Search, Aggregate, Count, ExportCollection,
+// ExportParquet, DumpAll and Backup.
+func (d *Driver) Use(h Hook) *Driver {
+	nd := *d
+	nd.hooks = append(append([]Hook{}, d.hooks...), h)
+	return &nd
+}
+
+func (d *Driver) beforeWrite(collection, resource string, v interface{}) (interface{}, error) {
+	for _, h := range d.hooks {
+		if h.BeforeWrite == nil {
+			continue
+		}
+		var err error
+		if v, err = h.BeforeWrite(collection, resource, v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (d *Driver) afterWrite(collection, resource string, v interface{}, err error) {
+	for _, h := range d.hooks {
+		if h.AfterWrite != nil {
+			h.AfterWrite(collection, resource, v, err)
+		}
+	}
+}
+
+func (d *Driver) beforeRead(collection, resource string) error {
+	for _, h := range d.hooks {
+		if h.BeforeRead == nil {
+			continue
+		}
+		if err := h.BeforeRead(collection, resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) afterRead(collection, resource string, v interface{}, err error) {
+	for _, h := range d.hooks {
+		if h.AfterRead != nil {
+			h.AfterRead(collection, resource, v, err)
+		}
+	}
+}
+
+func (d *Driver) beforeDelete(collection, resource string) error {
+	for _, h := range d.hooks {
+		if h.BeforeDelete == nil {
+			continue
+		}
+		if err := h.BeforeDelete(collection, resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) afterDelete(collection, resource string, err error) {
+	for _, h := range d.hooks {
+		if h.AfterDelete != nil {
+			h.AfterDelete(collection, resource, err)
+		}
+	}
+}
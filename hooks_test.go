@@ -0,0 +1,132 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingHook returns a Hook appending every call it sees to calls
+func recordingHook(calls *[]string) Hook {
+	return Hook{
+		BeforeWrite: func(c, r string, v interface{}) (interface{}, error) {
+			*calls = append(*calls, "before write "+c+"/"+r)
+			return v, nil
+		},
+		AfterWrite: func(c, r string, v interface{}, err error) { *calls = append(*calls, "after write "+c+"/"+r) },
+		BeforeRead: func(c, r string) error {
+			*calls = append(*calls, "before read "+c+"/"+r)
+			return nil
+		},
+		AfterRead: func(c, r string, v interface{}, err error) { *calls = append(*calls, "after read "+c+"/"+r) },
+		BeforeDelete: func(c, r string) error {
+			*calls = append(*calls, "before delete "+c+"/"+r)
+			return nil
+		},
+		AfterDelete: func(c, r string, err error) { *calls = append(*calls, "after delete "+c+"/"+r) },
+	}
+}
+
+func TestHooks(t *testing.T) {
+	write := []string{"before write users/ada", "after write users/ada"}
+	read := []string{"before read users/ada", "after read users/ada"}
+	readAll := []string{"before read users/", "after read users/"}
+
+	tests := []struct {
+		name    string
+		options Options
+		call    func(d *Driver) error
+		want    []string
+	}{
+		{"Write", Options{}, func(d *Driver) error { return d.Write("users", "ada", testUser{"Ada", 36}) }, write},
+		{"WriteWithTTL", Options{}, func(d *Driver) error { return d.WriteWithTTL("users", "ada", testUser{"Ada", 36}, time.Hour) }, write},
+		{"WriteIfRevision", Options{Metadata: true}, func(d *Driver) error { return d.WriteIfRevision("users", "ada", testUser{"Ada", 36}, 1) }, write},
+		{"Update", Options{}, func(d *Driver) error {
+			return d.Update("users", "ada", func(json.RawMessage) (interface{}, error) { return testUser{"Ada", 37}, nil })
+		}, write},
+		{"Patch", Options{}, func(d *Driver) error { return d.Patch("users", "ada", []byte(`{"Age":37}`), MergePatch) }, write},
+		{"Increment", Options{}, func(d *Driver) error { _, err := d.Increment("users", "ada", "Age", 1); return err }, write},
+		{"Transaction", Options{}, func(d *Driver) error {
+			return d.Transaction(func(tx *Tx) error {
+				if err := tx.Write("users", "ada", testUser{"Ada", 37}); err != nil {
+					return err
+				}
+				return tx.Delete("users", "bob")
+			})
+		}, []string{"before write users/ada", "before delete users/bob", "after write users/ada", "after delete users/bob"}},
+		{"WriteBatch", Options{}, func(d *Driver) error {
+			return d.WriteBatch("users", map[string]interface{}{"ada": testUser{"Ada", 37}})
+		}, write},
+		{"Read", Options{}, func(d *Driver) error { return d.Read("users", "ada", &testUser{}) }, read},
+		{"ReadJSON5", Options{}, func(d *Driver) error { return d.ReadJSON5("users", "ada", &testUser{}) }, read},
+		{"ReadWithMeta", Options{}, func(d *Driver) error { _, err := d.ReadWithMeta("users", "ada", &testUser{}); return err }, read},
+		{"ReadAll", Options{}, func(d *Driver) error { _, err := d.ReadAll("users"); return err }, readAll},
+		{"Find", Options{}, func(d *Driver) error { _, err := d.Find("users", Query{}); return err }, readAll},
+		{"FindModifiedAfter", Options{}, func(d *Driver) error { _, err := d.FindModifiedAfter("users", time.Time{}); return err }, readAll},
+		{"Iterate", Options{}, func(d *Driver) error {
+			cur, err := d.Iterate("users")
+			if err != nil {
+				return err
+			}
+			defer cur.Close()
+			for cur.Next() {
+				if err := cur.Decode(&testUser{}); err != nil {
+					return err
+				}
+			}
+			return cur.Err()
+		}, []string{"before read users/", "after read users/ada", "after read users/bob"}},
+		{"Delete", Options{}, func(d *Driver) error { return d.Delete("users", "ada") }, []string{"before delete users/ada", "after delete users/ada"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDriver(t, &tt.options)
+			for _, u := range []testUser{{"ada", 36}, {"bob", 41}} {
+				if err := d.Write("users", u.Name, u); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var calls []string
+			if err := tt.call(d.Use(recordingHook(&calls))); err != nil {
+				t.Fatal(err)
+			}
+			if len(calls) != len(tt.want) {
+				t.Fatalf("hook calls = %q, want %q", calls, tt.want)
+			}
+			for i := range calls {
+				if calls[i] != tt.want[i] {
+					t.Fatalf("hook calls = %q, want %q", calls, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHooksReject(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	if err := d.Write("users", "ada", testUser{"Ada", 36}); err != nil {
+		t.Fatal(err)
+	}
+	errRejected := errors.New("rejected")
+	h := d.Use(Hook{
+		BeforeWrite: func(c, r string, v interface{}) (interface{}, error) { return nil, errRejected },
+		BeforeRead:  func(c, r string) error { return errRejected },
+	})
+
+	if err := h.Patch("users", "ada", []byte(`{"Age":37}`), MergePatch); !errors.Is(err, errRejected) {
+		t.Errorf("Patch() = %v, want the hook's error", err)
+	}
+	if err := h.WriteWithTTL("users", "ada", testUser{"Ada", 37}, time.Hour); !errors.Is(err, errRejected) {
+		t.Errorf("WriteWithTTL() = %v, want the hook's error", err)
+	}
+	if _, err := h.ReadAll("users"); !errors.Is(err, errRejected) {
+		t.Errorf("ReadAll() = %v, want the hook's error", err)
+	}
+
+	var u testUser
+	if err := d.Read("users", "ada", &u); err != nil || u.Age != 36 {
+		t.Fatalf("record after rejected writes = %+v, %v", u, err)
+	}
+}
@@ -0,0 +1,254 @@
+package jsondb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDGenerator makes the resource names of records stored with Insert. seq
+// returns the collection's next sequence number, starting at 1 and persisted
+// by the driver, for generators that number records; the others never call
+// it. It runs under the collection lock.
+type IDGenerator func(collection string, seq func() (uint64, error)) (string, error)
+
+// UUIDv4 generates random RFC 4122 version 4 UUIDs. It is the default
+// IDGenerator.
+func UUIDv4(collection string, seq func() (uint64, error)) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// ulids holds the last ULID made, so ULIDs made in the same millisecond
+// still sort in the order they were made
+var ulids struct {
+	sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+// crockford is the base32 alphabet of ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates ULIDs: a millisecond timestamp followed by random bits,
+// encoded in 26 characters that sort by creation time. ULIDs made in the same
+// millisecond increment the random part, so they sort too.
+func ULID(collection string, seq func() (uint64, error)) (string, error) {
+	ulids.Lock()
+	defer ulids.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= ulids.ms {
+		ms = ulids.ms
+		i := len(ulids.entropy) - 1
+		for ; i >= 0; i-- {
+			ulids.entropy[i]++
+			if ulids.entropy[i] != 0 {
+				break
+			}
+		}
+		if i < 0 {
+			return "", fmt.Errorf("unable to make ULID - too many in one millisecond")
+		}
+	} else if _, err := rand.Read(ulids.entropy[:]); err != nil {
+		return "", err
+	}
+	ulids.ms = ms
+
+	// 48 bits of time then 80 of entropy, 5 bits per character
+	var b [16]byte
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	copy(b[6:], ulids.entropy[:])
+
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out), nil
+}
+
+// Sequential numbers the records of each collection 1, 2, 3, ... from the
+// collection's persisted sequence
+func Sequential(collection string, seq func() (uint64, error)) (string, error) {
+	n, err := seq()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(n, 10), nil
+}
+
+// seqFile holds the last sequence number handed out for a collection,
+// <dir>/<collection>/.sequence, or <dir>/<collection>.seq with the appendlog
+// storage
+const seqFile = ".sequence"
+
+func (d *Driver) seqPath(collection string) string {
+	if d.storage == StorageAppendLog {
+		return filepath.Join(d.dir, collection+".seq")
+	}
+	return filepath.Join(d.dir, collection, seqFile)
+}
+
+// nextSeq increments and returns the sequence number of a collection. The
+// caller must hold the collection lock.
+func (d *Driver) nextSeq(collection string) (uint64, error) {
+	path := d.seqPath(collection)
+
+	var n uint64
+	b, err := d.backend.ReadFile(path)
+	switch {
+	case err == nil:
+		if n, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err != nil {
+			return 0, fmt.Errorf("corrupt sequence of %v: %w", collection, err)
+		}
+	case !os.IsNotExist(err):
+		return 0, err
+	}
+
+	n++
+	if err := d.backend.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	if err := d.writeFile(path+d.tmpSuffix, path, []byte(strconv.FormatUint(n, 10)+"\n")); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// insertAttempts bounds how many IDs Insert tries when the generated ones
+// are taken, as happens with Sequential after records were written by name
+const insertAttempts = 100
+
+// Insert stores v under a new resource name made by Options.IDGenerator and
+// returns the name. The name is also stored in the record: in v's string
+// field tagged `jsondb:"id"`, or else its string field named ID, or under the
+// "id" key when v is a map[string]interface{}. v is changed in place when it
+// is a pointer or a map; other values are copied.
+func (d *Driver) Insert(collection string, v interface{}) (id string, err error) {
+	defer d.done(OpInsert, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return "", fmt.Errorf("%w - no place to insert record", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return "", err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	seq := func() (uint64, error) { return d.nextSeq(collection) }
+	for i := 0; ; i++ {
+		if i == insertAttempts {
+			return "", fmt.Errorf("unable to insert into %v - %d generated ids were all taken", collection, insertAttempts)
+		}
+		if id, err = d.idGenerator(collection, seq); err != nil {
+			return "", fmt.Errorf("unable to generate id in %v: %w", collection, err)
+		}
+		if id == "" {
+			return "", fmt.Errorf("%w - id generator returned an empty id", ErrEmptyResource)
+		}
+		if err := d.validateResource(id); err != nil {
+			return "", fmt.Errorf("unable to insert into %v - id generator returned an unusable id: %w", collection, err)
+		}
+
+		_, err = d.readRaw(collection, id)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		// taken, try another
+	}
+
+	rec, err := d.beforeWrite(collection, id, withID(v, id))
+	if err != nil {
+		return "", err
+	}
+	defer func() { d.afterWrite(collection, id, rec, err) }()
+
+	if d.storage == StorageAppendLog {
+		return id, d.insertLog(collection, id, rec)
+	}
+	b, err := d.encode(rec)
+	if err != nil {
+		return "", err
+	}
+	return id, d.writeRecord(collection, id, b)
+}
+
+func (d *Driver) insertLog(collection, resource string, v interface{}) error {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return d.writeLogDoc(collection, resource, doc)
+}
+
+// withID stores id in v's id field, as described by Insert, returning the
+// value to encode
+func withID(v interface{}, id string) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		m["id"] = id
+		return m
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct {
+		if f := idField(rv.Elem()); f.IsValid() {
+			f.SetString(id)
+		}
+		return v
+	}
+	if rv.Kind() == reflect.Struct {
+		cp := reflect.New(rv.Type()).Elem()
+		cp.Set(rv)
+		if f := idField(cp); f.IsValid() {
+			f.SetString(id)
+			return cp.Interface()
+		}
+	}
+	return v
+}
+
+func idField(s reflect.Value) reflect.Value {
+	t := s.Type()
+	byName := -1
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Type.Kind() != reflect.String {
+			continue
+		}
+		if f.Tag.Get("jsondb") == "id" {
+			return s.Field(i)
+		}
+		if f.Name == "ID" {
+			byName = i
+		}
+	}
+	if byName < 0 {
+		return reflect.Value{}
+	}
+	return s.Field(byName)
+}
@@ -0,0 +1,488 @@
+package jsondb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexDir is the subdirectory of a collection holding its secondary
+// indexes, one <field>.idx file per indexed field. Each file is an
+// append-only list of "<value>\t<resource>\n" lines, where value is the
+// record's field value encoded as JSON and an empty value records that the
+// resource no longer has an indexed value. The last line of a resource wins.
+const indexDir = ".indexes"
+
+// fieldIndex maps the values of one field of a collection to the resources
+// holding them. Only strings, numbers, booleans and null are indexed.
+type fieldIndex struct {
+	values map[string]map[string]bool // value key -> resources
+	keys   map[string]string          // resource -> value key
+	unique bool                       // see AddUniqueConstraint
+}
+
+func newFieldIndex() *fieldIndex {
+	return &fieldIndex{
+		values: make(map[string]map[string]bool),
+		keys:   make(map[string]string),
+	}
+}
+
+func (x *fieldIndex) set(resource, key string) {
+	if old, ok := x.keys[resource]; ok {
+		delete(x.values[old], resource)
+		if len(x.values[old]) == 0 {
+			delete(x.values, old)
+		}
+		delete(x.keys, resource)
+	}
+	if key == "" {
+		return
+	}
+	if x.values[key] == nil {
+		x.values[key] = make(map[string]bool)
+	}
+	x.values[key][resource] = true
+	x.keys[resource] = key
+}
+
+// fieldIndexes caches the secondary indexes of the collections, loaded from
+// disk on first use. A loaded collection without indexes has an empty map.
+// The map is guarded by mutex; each collection's indexes are only read or
+// changed under its collection mutex.
+type fieldIndexes struct {
+	mutex       sync.Mutex
+	collections map[string]map[string]*fieldIndex
+}
+
+func (d *Driver) indexPath(collection, field string) string {
+	return filepath.Join(d.dir, collection, indexDir, field+".idx")
+}
+
+// indexKey encodes an indexable field value, so that values equal for Find
+// share a key
+func indexKey(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "null", true
+	case bool:
+		return strconv.FormatBool(v), true
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return "", false
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	case string:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	}
+	return "", false
+}
+
+// recordIndexKey returns the key of a record's field value, or "" when the
+// record doesn't hold an indexable value there
+func recordIndexKey(doc interface{}, field string) string {
+	v, ok := lookupPath(doc, field)
+	if !ok {
+		return ""
+	}
+	key, _ := indexKey(v)
+	return key
+}
+
+// CreateIndex builds a secondary index of a collection on the dotted field
+// path, which Find then uses for Eq and In conditions on that field. The
+// index is kept up to date by every write and delete of the collection.
+// Index files hold the values of field in the clear, so it fails when
+// Options.Encryption is set.
+func (d *Driver) CreateIndex(collection, field string) (err error) {
+	defer d.done(OpCreateIndex, collection, "", time.Now(), &err)
+
+	if err := d.checkIndex(collection, field); err != nil {
+		return err
+	}
+	if err := d.requirePlain("indexes"); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+	if _, ok := indexes[field]; ok {
+		return fmt.Errorf("unable to create index on %v of %v - index already exists", field, collection)
+	}
+
+	x, err := d.buildIndex(collection, field)
+	if err != nil {
+		return err
+	}
+	indexes[field] = x
+	return nil
+}
+
+// DropIndex removes the secondary index of a collection on field, along with
+// its unique constraint if it has one
+func (d *Driver) DropIndex(collection, field string) (err error) {
+	defer d.done(OpDropIndex, collection, "", time.Now(), &err)
+
+	if err := d.checkIndex(collection, field); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+	if _, ok := indexes[field]; !ok {
+		return fmt.Errorf("unable to find index on %v of %v: %w", field, collection, os.ErrNotExist)
+	}
+
+	delete(indexes, field)
+	if err := d.backend.Remove(d.indexPath(collection, field) + uniqueMarker); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return d.backend.Remove(d.indexPath(collection, field))
+}
+
+// ListIndexes returns the fields a collection is indexed on, sorted
+func (d *Driver) ListIndexes(collection string) (fields []string, err error) {
+	defer d.done(OpListIndexes, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to list indexes", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return nil, err
+	}
+	return sortedKeys(indexes), nil
+}
+
+// Reindex rebuilds every secondary index of a collection, and its search
+// index, from its records, for when the record files were changed behind the
+// driver's back
+func (d *Driver) Reindex(collection string) (err error) {
+	defer d.done(OpReindex, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to reindex", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return d.reindex(collection)
+}
+
+// reindex rebuilds the indexes of a collection. The caller must hold the
+// collection mutex.
+func (d *Driver) reindex(collection string) error {
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+	for _, field := range sortedKeys(indexes) {
+		x, err := d.buildIndex(collection, field)
+		if err != nil {
+			return err
+		}
+		x.unique = indexes[field].unique
+		indexes[field] = x
+	}
+
+	search, err := d.loadSearch(collection)
+	if err != nil || search == nil {
+		return err
+	}
+	x, err := d.buildSearch(collection, search.fields)
+	if err != nil {
+		return err
+	}
+	d.searches.mutex.Lock()
+	d.searches.collections[collection] = x
+	d.searches.mutex.Unlock()
+	return nil
+}
+
+func (d *Driver) checkIndex(collection, field string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to index", ErrEmptyCollection)
+	}
+	if field == "" {
+		return fmt.Errorf("missing field - unable to index %v", collection)
+	}
+	if strings.ContainsAny(field, `/\`) {
+		return fmt.Errorf("invalid field %q - must not contain path separators", field)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.requireJSON("indexes"); err != nil {
+		return err
+	}
+	return d.requireFiles("indexes")
+}
+
+// loadIndexes returns the secondary indexes of a collection, reading them
+// from disk the first time. The caller must hold the collection mutex.
+func (d *Driver) loadIndexes(collection string) (map[string]*fieldIndex, error) {
+	c := d.indexes
+	c.mutex.Lock()
+	indexes, ok := c.collections[collection]
+	c.mutex.Unlock()
+	if ok {
+		return indexes, nil
+	}
+
+	indexes = make(map[string]*fieldIndex)
+	files, err := d.backend.ReadDir(filepath.Join(d.dir, collection, indexDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, file := range files {
+		field, ok := strings.CutSuffix(file.Name(), ".idx")
+		if !ok || file.IsDir() {
+			continue
+		}
+		x, err := d.readIndexFile(filepath.Join(d.dir, collection, indexDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		x.unique = d.isUniqueMarker(filepath.Join(d.dir, collection, indexDir), field)
+		indexes[field] = x
+	}
+
+	c.mutex.Lock()
+	c.collections[collection] = indexes
+	c.mutex.Unlock()
+	return indexes, nil
+}
+
+func (d *Driver) readIndexFile(path string) (*fieldIndex, error) {
+	b, err := d.backend.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	x := newFieldIndex()
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		key, resource, ok := strings.Cut(string(line), "\t")
+		if !ok || resource == "" {
+			continue // blank or torn last line
+		}
+		x.set(resource, key)
+	}
+	return x, nil
+}
+
+// buildIndex indexes every record of a collection on field and writes the
+// index file. The caller must hold the collection mutex.
+func (d *Driver) buildIndex(collection, field string) (*fieldIndex, error) {
+	names, err := d.resourceNames(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	x := newFieldIndex()
+	for _, name := range names {
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %v/%v: %w", collection, name, err)
+		}
+		x.set(name, recordIndexKey(doc, field))
+	}
+
+	return x, d.writeIndexFile(collection, field, x)
+}
+
+func (d *Driver) writeIndexFile(collection, field string, x *fieldIndex) error {
+	var b []byte
+	for _, resource := range sortedKeys(x.keys) {
+		b = append(b, x.keys[resource]+"\t"+resource+"\n"...)
+	}
+
+	path := d.indexPath(collection, field)
+	if err := d.backend.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return d.writeFile(path+d.tmpSuffix, path, b)
+}
+
+// indexRecord updates the indexes of a collection, and its search index,
+// for a written record, or for a deleted one when b is nil. Indexes are
+// derived data, so a failure is logged rather than failing the write;
+// Reindex repairs it. The caller must hold the collection mutex.
+func (d *Driver) indexRecord(collection, resource string, b []byte) {
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		d.log.Warn("Unable to load indexes", "collection", collection, "error", err)
+		return
+	}
+	search, err := d.loadSearch(collection)
+	if err != nil {
+		d.log.Warn("Unable to load search index", "collection", collection, "error", err)
+	}
+	if len(indexes) == 0 && search == nil {
+		return
+	}
+
+	var doc interface{}
+	if b != nil {
+		if doc, err = decodeDocument(b); err != nil {
+			d.log.Warn("Unable to index", "collection", collection, "resource", resource, "error", err)
+			return
+		}
+	}
+	if search != nil {
+		d.searchRecord(collection, resource, search, doc)
+	}
+
+	for field, x := range indexes {
+		key := ""
+		if doc != nil {
+			key = recordIndexKey(doc, field)
+		}
+		if x.keys[resource] == key {
+			continue
+		}
+		x.set(resource, key)
+
+		if err := d.appendIndexLine(d.indexPath(collection, field), key, resource); err != nil {
+			d.log.Warn("Unable to update index", "collection", collection, "field", field, "error", err)
+		}
+	}
+}
+
+func (d *Driver) appendIndexLine(path, key, resource string) error {
+	f, err := d.backend.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	w.WriteString(key + "\t" + resource + "\n")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dropIndexes forgets the cached indexes of a removed collection and of the
+// collections nested in it
+func (d *Driver) dropIndexes(collection string) {
+	c := d.indexes
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for name := range c.collections {
+		if name == collection || strings.HasPrefix(name, collection+"/") {
+			delete(c.collections, name)
+		}
+	}
+	d.dropSearches(collection)
+}
+
+// indexedCandidates returns the resources that can match conds according to
+// an index on the field of one of their Eq or In conditions. ok is false
+// when no condition can use an index.
+func (d *Driver) indexedCandidates(collection string, conds []Condition) (names []string, ok bool, err error) {
+	if d.storage != StorageFiles {
+		return nil, false, nil
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil || len(indexes) == 0 {
+		return nil, false, err
+	}
+
+	for _, c := range conds {
+		x, indexed := indexes[c.Field]
+		if !indexed {
+			continue
+		}
+
+		var values []interface{}
+		switch c.Op {
+		case Eq:
+			values = []interface{}{c.Value}
+		case In:
+			values = c.Value.([]interface{})
+		default:
+			continue
+		}
+
+		keys := make([]string, 0, len(values))
+		for _, v := range values {
+			key, ok := indexKey(v)
+			if !ok {
+				break
+			}
+			keys = append(keys, key)
+		}
+		if len(keys) < len(values) {
+			continue // objects and arrays aren't indexed
+		}
+
+		seen := make(map[string]bool)
+		for _, key := range keys {
+			for resource := range x.values[key] {
+				if !seen[resource] {
+					seen[resource] = true
+					names = append(names, resource)
+				}
+			}
+		}
+		sort.Strings(names)
+		return names, true, nil
+	}
+
+	return nil, false, nil
+}
@@ -0,0 +1,322 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// InferredSchema is the union of the fields observed in a sample of a
+// collection's records, as returned by InferSchema
+type InferredSchema struct {
+	Collection string
+	Sampled    int // number of records inspected
+	Fields     []InferredField
+}
+
+// InferredField describes the values observed for one JSON field
+type InferredField struct {
+	Name     string          // JSON key; empty for array elements
+	Kinds    []string        // sorted kinds seen: array, bool, float, int, null, object, string
+	Optional bool            // missing or null in some records
+	Varies   bool            // more than one non-null kind was seen
+	Fields   []InferredField // fields of object values
+	Elem     *InferredField  // elements of array values
+}
+
+// InferSchema samples up to sampleSize records of a collection, spread evenly
+// over the collection, and unions their fields. A sampleSize of zero or less
+// inspects every record.
+func (d *Driver) InferSchema(collection string, sampleSize int) (schema InferredSchema, err error) {
+	defer d.done(OpInferSchema, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return schema, fmt.Errorf("%w - unable to infer schema", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return schema, err
+	}
+	if err := d.requireFiles("InferSchema"); err != nil {
+		return schema, err
+	}
+	if err := d.requireJSON("InferSchema"); err != nil {
+		return schema, err
+	}
+
+	names, err := d.recordNames(collection)
+	if err != nil {
+		return schema, notFound(collection, "", err)
+	}
+
+	if sampleSize > 0 && sampleSize < len(names) {
+		sample := make([]string, sampleSize)
+		for i := range sample {
+			sample[i] = names[i*len(names)/sampleSize]
+		}
+		names = sample
+	}
+
+	root := newKindSet()
+	for _, name := range names {
+		b, err := d.readFile(filepath.Join(d.dir, collection, name+d.ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return schema, err
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return schema, fmt.Errorf("unable to decode %v: %w", filepath.Join(collection, name), err)
+		}
+
+		root.add(v)
+		schema.Sampled++
+	}
+
+	schema.Collection = collection
+	schema.Fields = root.fieldList()
+	return schema, nil
+}
+
+// kindSet accumulates the values seen at one position of the documents
+type kindSet struct {
+	kinds   map[string]bool
+	objects int // object values seen, to tell optional fields apart
+	fields  map[string]*fieldSet
+	elem    *kindSet
+}
+
+type fieldSet struct {
+	*kindSet
+	present int
+}
+
+func newKindSet() *kindSet {
+	return &kindSet{kinds: make(map[string]bool)}
+}
+
+func (k *kindSet) add(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		k.kinds["null"] = true
+	case bool:
+		k.kinds["bool"] = true
+	case string:
+		k.kinds["string"] = true
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			k.kinds["float"] = true
+		} else {
+			k.kinds["int"] = true
+		}
+	case []interface{}:
+		k.kinds["array"] = true
+		if k.elem == nil {
+			k.elem = newKindSet()
+		}
+		for _, e := range v {
+			k.elem.add(e)
+		}
+	case map[string]interface{}:
+		k.kinds["object"] = true
+		k.objects++
+		if k.fields == nil {
+			k.fields = make(map[string]*fieldSet)
+		}
+		for name, child := range v {
+			f, ok := k.fields[name]
+			if !ok {
+				f = &fieldSet{kindSet: newKindSet()}
+				k.fields[name] = f
+			}
+			f.present++
+			f.add(child)
+		}
+	}
+}
+
+func (k *kindSet) field(name string, optional bool) InferredField {
+	f := InferredField{Name: name, Optional: optional || k.kinds["null"]}
+
+	for kind := range k.kinds {
+		f.Kinds = append(f.Kinds, kind)
+	}
+	sort.Strings(f.Kinds)
+
+	nonNull := len(k.kinds)
+	if k.kinds["null"] {
+		nonNull--
+	}
+	f.Varies = nonNull > 1
+
+	f.Fields = k.fieldList()
+	if k.elem != nil {
+		elem := k.elem.field("", false)
+		f.Elem = &elem
+	}
+
+	return f
+}
+
+func (k *kindSet) fieldList() []InferredField {
+	names := make([]string, 0, len(k.fields))
+	for name := range k.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var fields []InferredField
+	for _, name := range names {
+		f := k.fields[name]
+		fields = append(fields, f.field(name, f.present < k.objects))
+	}
+	return fields
+}
+
+// GenerateGoTypes writes gofmt-ed Go struct definitions matching an inferred
+// schema. Objects become named nested structs, numbers seen both as int and
+// float become json.Number, fields whose kind varies become json.RawMessage
+// and optional fields are pointers tagged omitempty.
+func GenerateGoTypes(schema InferredSchema, pkg, typeName string, w io.Writer) error {
+	if pkg == "" || typeName == "" {
+		return fmt.Errorf("missing package or type name - unable to generate types")
+	}
+
+	g := &typeGen{}
+	g.structType(exportedName(typeName), schema.Fields)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated from collection %q; DO NOT EDIT.\n\n", schema.Collection)
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if g.usesJSON {
+		buf.WriteString("import \"encoding/json\"\n\n")
+	}
+	buf.Write(g.out.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+type typeGen struct {
+	out      bytes.Buffer
+	usesJSON bool
+	pending  []pendingStruct
+}
+
+type pendingStruct struct {
+	name   string
+	fields []InferredField
+}
+
+// structType emits the struct named name, then the structs nested in it
+func (g *typeGen) structType(name string, fields []InferredField) {
+	fmt.Fprintf(&g.out, "type %s struct {\n", name)
+
+	used := make(map[string]bool)
+	for _, f := range fields {
+		goName := exportedName(f.Name)
+		for base, i := goName, 2; used[goName]; i++ {
+			goName = fmt.Sprintf("%s%d", base, i)
+		}
+		used[goName] = true
+
+		typ := g.goType(name+goName, f)
+		tag := f.Name
+		if f.Optional {
+			tag += ",omitempty"
+			// a pointer keeps an empty array apart from a missing one
+			if typ != "json.RawMessage" {
+				typ = "*" + typ
+			}
+		}
+		fmt.Fprintf(&g.out, "\t%s %s `json:%q`\n", goName, typ, tag)
+	}
+	g.out.WriteString("}\n\n")
+
+	pending := g.pending
+	g.pending = nil
+	for _, p := range pending {
+		g.structType(p.name, p.fields)
+	}
+}
+
+// goType picks the Go type for a field, queueing a nested struct named
+// nested when the field holds objects
+func (g *typeGen) goType(nested string, f InferredField) string {
+	kinds := make(map[string]bool)
+	for _, k := range f.Kinds {
+		if k != "null" {
+			kinds[k] = true
+		}
+	}
+
+	switch {
+	case len(kinds) == 2 && kinds["int"] && kinds["float"]:
+		g.usesJSON = true
+		return "json.Number"
+	case len(kinds) != 1:
+		g.usesJSON = true
+		return "json.RawMessage"
+	case kinds["string"]:
+		return "string"
+	case kinds["bool"]:
+		return "bool"
+	case kinds["int"]:
+		return "int64"
+	case kinds["float"]:
+		return "float64"
+	case kinds["object"]:
+		g.pending = append(g.pending, pendingStruct{nested, f.Fields})
+		return nested
+	default: // array
+		if f.Elem == nil || len(f.Elem.Kinds) == 0 {
+			g.usesJSON = true
+			return "[]json.RawMessage"
+		}
+		elem := g.goType(nested+"Item", *f.Elem)
+		if f.Elem.Optional && !strings.HasPrefix(elem, "[]") && elem != "json.RawMessage" {
+			elem = "*" + elem
+		}
+		return "[]" + elem
+	}
+}
+
+// exportedName turns a JSON key into an exported Go identifier
+func exportedName(key string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+
+	name := b.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "F" + name
+	}
+	return name
+}
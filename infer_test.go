@@ -0,0 +1,209 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// inferRecords cover every kind GenerateGoTypes maps, optional and varying
+// fields, and keys that aren't Go identifiers
+var inferRecords = map[string]string{
+	"ada": `{
+		"name": "Ada", "age": 36, "score": 9.5, "mixed": 1, "admin": true, "nickname": "ada",
+		"address": {"city": "London", "zip": "N1"},
+		"tags": ["math", "engines"], "ratings": [5, 4],
+		"jobs": [{"title": "analyst", "years": 10}],
+		"varies": "a string", "maybe": null, "first-name": "Augusta", "2fa": false,
+		"empty": [], "huge": 9007199254740993
+	}`,
+	"bob": `{
+		"name": "Bob", "age": 41, "score": 7, "mixed": 2.25, "admin": false,
+		"address": {"city": "Paris", "zip": "75001", "floor": 3},
+		"tags": [], "ratings": [],
+		"jobs": [{"title": "clerk", "years": 1.5, "remote": true}, null],
+		"varies": {"nested": [1, "two"]}, "maybe": "now", "first-name": "Robert", "2fa": true,
+		"huge": 1
+	}`,
+	"cy": `{
+		"name": "Cy", "age": 0, "score": 0.1, "mixed": 3, "admin": false,
+		"address": {"city": "", "zip": ""},
+		"tags": ["x"], "ratings": [1],
+		"jobs": [],
+		"varies": 12, "first-name": "", "2fa": false, "empty": [1],
+		"huge": -9007199254740993
+	}`,
+}
+
+func TestGenerateGoTypes(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	for name, doc := range inferRecords {
+		if err := d.Write("users", name, json.RawMessage(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	schema, err := d.InferSchema("users", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var src bytes.Buffer
+	if err := GenerateGoTypes(schema, "main", "user", &src); err != nil {
+		t.Fatal(err)
+	}
+
+	// gofmt aligns the fields, so whitespace is compared collapsed
+	got := strings.Join(strings.Fields(src.String()), " ")
+	for _, line := range []string{
+		"type User struct {",
+		"Name string `json:\"name\"`",
+		"Age int64 `json:\"age\"`",
+		"Score json.Number `json:\"score\"`",
+		"Nickname *string `json:\"nickname,omitempty\"`",
+		"Address UserAddress `json:\"address\"`",
+		"Tags []string `json:\"tags\"`",
+		"Jobs []*UserJobsItem `json:\"jobs\"`",
+		"Varies json.RawMessage `json:\"varies\"`",
+		"Maybe *string `json:\"maybe,omitempty\"`",
+		"FirstName string `json:\"first-name\"`",
+		"F2fa bool `json:\"2fa\"`",
+		"type UserAddress struct {",
+		"Floor *int64 `json:\"floor,omitempty\"`",
+		"type UserJobsItem struct {",
+		"Years json.Number `json:\"years\"`",
+		"Empty *[]int64 `json:\"empty,omitempty\"`",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("generated types lack %q:\n%s", line, src.String())
+		}
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		roundTrip(t, src.Bytes(), "User", inferRecords)
+	})
+
+	if _, err := d.InferSchema("admins", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("InferSchema of a missing collection = %v, want ErrNotFound", err)
+	}
+}
+
+// roundTrip compiles the generated types with a program decoding every record
+// into typeName and encoding it back, and checks it gets the records back.
+// Nulls are compared as missing members, which is what a nil pointer tagged
+// omitempty encodes to.
+func roundTrip(t *testing.T, types []byte, typeName string, records map[string]string) {
+	if testing.Short() {
+		t.Skip("compiles a program")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool in PATH")
+	}
+
+	dir := t.TempDir()
+	main := `package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+func main() {
+	var in map[string]json.RawMessage
+	if err := json.NewDecoder(os.Stdin).Decode(&in); err != nil {
+		panic(err)
+	}
+	out := make(map[string]interface{}, len(in))
+	for name, b := range in {
+		var v ` + typeName + `
+		if err := json.Unmarshal(b, &v); err != nil {
+			panic(name + ": " + err.Error())
+		}
+		out[name] = v
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+		panic(err)
+	}
+}
+`
+	for name, b := range map[string][]byte{
+		"go.mod":   []byte("module roundtrip\n\ngo 1.21\n"),
+		"types.go": types,
+		"main.go":  []byte(main),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw := make(map[string]json.RawMessage, len(records))
+	for name, doc := range records {
+		raw[name] = json.RawMessage(doc)
+	}
+	in, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(goTool, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	cmd.Stdin = bytes.NewReader(in)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("round trip program failed: %v\n%s", err, stderr.String())
+	}
+
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range records {
+		if g, w := withoutNulls(t, got[name]), withoutNulls(t, []byte(want)); !reflect.DeepEqual(g, w) {
+			t.Errorf("%v round trips to\n%s\nwant\n%s", name, got[name], want)
+		}
+	}
+}
+
+// withoutNulls decodes b, numbers kept exact, dropping object members holding
+// null
+func withoutNulls(t *testing.T, b []byte) interface{} {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	var drop func(v interface{}) interface{}
+	drop = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if child == nil {
+					delete(v, k)
+				} else {
+					v[k] = drop(child)
+				}
+			}
+		case []interface{}:
+			for i, child := range v {
+				v[i] = drop(child)
+			}
+		case json.Number:
+			// 7 and 7.0 are the same float64; ints stay exact
+			if strings.ContainsAny(v.String(), ".eE") {
+				f, _ := v.Float64()
+				return f
+			}
+			return v.String()
+		}
+		return v
+	}
+	return drop(v)
+}
@@ -0,0 +1,406 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ReadJSON5 reads a record that may have been edited by hand as JSON5: it
+// accepts comments, trailing commas, unquoted keys, single-quoted strings and
+// JSON5 number forms (hex, leading or trailing decimal point, leading +).
+// Infinity and NaN have no JSON equivalent and are rejected. If the content
+// can't be read as JSON5 it is decoded as plain JSON instead, and the JSON5
+// error is returned when that fails too.
+func (d *Driver) ReadJSON5(collection, resource string, v interface{}) (err error) {
+	defer d.done(OpReadJSON5, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to read record", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to read record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+	if err := d.requireJSON("ReadJSON5"); err != nil {
+		return err
+	}
+
+	if err := d.beforeRead(collection, resource); err != nil {
+		return err
+	}
+	defer func() { d.afterRead(collection, resource, v, err) }()
+
+	raw, err := d.readRaw(collection, resource)
+	if err != nil {
+		return notFound(collection, resource, err)
+	}
+
+	b, err := json5ToJSON(raw)
+	if err != nil {
+		if json.Unmarshal(raw, v) == nil {
+			return nil
+		}
+		return fmt.Errorf("unable to read %v/%v as JSON5: %w", collection, resource, err)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// WriteJSON5 writes a record for the hand-edited use case of ReadJSON5. JSON5
+// is only a read format here: the record is written as standard JSON, which
+// is valid JSON5.
+func (d *Driver) WriteJSON5(collection, resource string, v interface{}) error {
+	return d.Write(collection, resource, v)
+}
+
+// json5ToJSON rewrites a JSON5 document as standard JSON
+func json5ToJSON(src []byte) ([]byte, error) {
+	p := &json5Parser{src: src}
+	if err := p.run(); err != nil {
+		return nil, err
+	}
+	return p.out.Bytes(), nil
+}
+
+type json5Parser struct {
+	src []byte
+	i   int
+	out bytes.Buffer
+}
+
+func (p *json5Parser) run() error {
+	for p.i < len(p.src) {
+		c := p.src[p.i]
+		switch {
+		case c == '/':
+			if err := p.skipComment(); err != nil {
+				return err
+			}
+		case c == '"' || c == '\'':
+			if err := p.str(); err != nil {
+				return err
+			}
+		case c == ',':
+			p.i++
+			if next, ok := p.peek(); !ok || (next != '}' && next != ']') {
+				p.out.WriteByte(',')
+			}
+		case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			if err := p.number(); err != nil {
+				return err
+			}
+		case p.space() > 0:
+			p.out.WriteByte(' ')
+			p.i += p.space()
+		case isIdentByte(c) || c == '\\':
+			if err := p.ident(); err != nil {
+				return err
+			}
+		default:
+			p.out.WriteByte(c)
+			p.i++
+		}
+	}
+	return nil
+}
+
+// peek returns the next byte that isn't whitespace or part of a comment
+func (p *json5Parser) peek() (byte, bool) {
+	save, out := p.i, p.out.Len()
+	defer func() { p.i = save; p.out.Truncate(out) }()
+
+	for p.i < len(p.src) {
+		switch c := p.src[p.i]; c {
+		case ' ', '\t', '\n', '\r':
+			p.i++
+		case '/':
+			if p.skipComment() != nil {
+				return c, true
+			}
+		default:
+			n := p.space()
+			if n == 0 {
+				return c, true
+			}
+			p.i += n
+		}
+	}
+	return 0, false
+}
+
+// space returns the length of the whitespace character at p.i that JSON5
+// allows and JSON doesn't, such as a BOM, U+00A0 or U+2028, or 0
+func (p *json5Parser) space() int {
+	c := p.src[p.i]
+	if c == '\v' || c == '\f' {
+		return 1
+	}
+	if c < utf8.RuneSelf {
+		return 0
+	}
+	r, size := utf8.DecodeRune(p.src[p.i:])
+	if isJSON5Space(r) {
+		return size
+	}
+	return 0
+}
+
+func isJSON5Space(r rune) bool {
+	switch r {
+	case '\t', '\n', '\v', '\f', '\r', ' ', '\u00a0', '\u2028', '\u2029', '\ufeff':
+		return true
+	}
+	return unicode.Is(unicode.Zs, r)
+}
+
+func (p *json5Parser) skipComment() error {
+	if p.i+1 >= len(p.src) {
+		return fmt.Errorf("json5: unexpected '/' at offset %d", p.i)
+	}
+
+	switch p.src[p.i+1] {
+	case '/':
+		end := bytes.IndexByte(p.src[p.i:], '\n')
+		if end < 0 {
+			p.i = len(p.src)
+		} else {
+			p.i += end
+		}
+	case '*':
+		end := bytes.Index(p.src[p.i+2:], []byte("*/"))
+		if end < 0 {
+			return fmt.Errorf("json5: unterminated comment at offset %d", p.i)
+		}
+		p.i += 2 + end + 2
+	default:
+		return fmt.Errorf("json5: unexpected '/' at offset %d", p.i)
+	}
+	return nil
+}
+
+// str converts a single- or double-quoted string into a JSON string
+func (p *json5Parser) str() error {
+	quote := p.src[p.i]
+	start := p.i
+	p.i++
+	p.out.WriteByte('"')
+
+	for {
+		if p.i >= len(p.src) {
+			return fmt.Errorf("json5: unterminated string at offset %d", start)
+		}
+		c := p.src[p.i]
+		switch {
+		case c == quote:
+			p.i++
+			p.out.WriteByte('"')
+			return nil
+		case c == '\n' || c == '\r':
+			return fmt.Errorf("json5: newline in string at offset %d", p.i)
+		case c == '"':
+			p.out.WriteString(`\"`)
+			p.i++
+		case c == '\\':
+			if err := p.escape(); err != nil {
+				return err
+			}
+		default:
+			p.out.WriteByte(c)
+			p.i++
+		}
+	}
+}
+
+func (p *json5Parser) escape() error {
+	if p.i+1 >= len(p.src) {
+		return fmt.Errorf("json5: unterminated escape at offset %d", p.i)
+	}
+	c := p.src[p.i+1]
+	p.i += 2
+
+	switch c {
+	case '\n': // line continuation
+	case '\r':
+		if p.i < len(p.src) && p.src[p.i] == '\n' {
+			p.i++
+		}
+	case '\'':
+		p.out.WriteByte('\'')
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't', 'u':
+		p.out.WriteByte('\\')
+		p.out.WriteByte(c)
+	case 'v':
+		p.out.WriteString(`\u000b`)
+	case '0':
+		p.out.WriteString(`\u0000`)
+	case 'x':
+		if p.i+2 > len(p.src) {
+			return fmt.Errorf("json5: short \\x escape at offset %d", p.i-2)
+		}
+		p.out.WriteString(`\u00`)
+		p.out.Write(p.src[p.i : p.i+2])
+		p.i += 2
+	default:
+		r, size := utf8.DecodeRune(p.src[p.i-1:])
+		p.out.WriteRune(r)
+		p.i += size - 1
+	}
+	return nil
+}
+
+// number converts a JSON5 number literal into a JSON one
+func (p *json5Parser) number() error {
+	start := p.i
+	if c := p.src[p.i]; c == '-' {
+		p.out.WriteByte('-')
+		p.i++
+	} else if c == '+' {
+		p.i++
+	}
+
+	rest := p.src[p.i:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("Infinity")), bytes.HasPrefix(rest, []byte("NaN")):
+		return fmt.Errorf("json5: %s at offset %d has no JSON equivalent", p.word(), start)
+	case bytes.HasPrefix(rest, []byte("0x")), bytes.HasPrefix(rest, []byte("0X")):
+		p.i += 2
+		hex := p.digits(isHexDigit)
+		n, ok := new(big.Int).SetString(hex, 16)
+		if !ok {
+			return fmt.Errorf("json5: invalid hex number at offset %d", start)
+		}
+		p.out.WriteString(n.String())
+		return nil
+	}
+
+	intPart := p.digits(isDigit)
+	var frac string
+	if p.i < len(p.src) && p.src[p.i] == '.' {
+		p.i++
+		frac = p.digits(isDigit)
+	}
+	if intPart == "" && frac == "" {
+		return fmt.Errorf("json5: invalid number at offset %d", start)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	p.out.WriteString(intPart)
+	if frac != "" {
+		p.out.WriteString("." + frac)
+	}
+
+	if p.i < len(p.src) && (p.src[p.i] == 'e' || p.src[p.i] == 'E') {
+		p.out.WriteByte('e')
+		p.i++
+		if p.i < len(p.src) && (p.src[p.i] == '+' || p.src[p.i] == '-') {
+			p.out.WriteByte(p.src[p.i])
+			p.i++
+		}
+		exp := p.digits(isDigit)
+		if exp == "" {
+			return fmt.Errorf("json5: invalid exponent at offset %d", start)
+		}
+		p.out.WriteString(exp)
+	}
+	return nil
+}
+
+// ident handles true, false, null and unquoted object keys, which may hold
+// \u escapes
+func (p *json5Parser) ident() error {
+	start := p.i
+	word, escaped, err := p.identName()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case escaped:
+	case word == "true", word == "false", word == "null":
+		p.out.WriteString(word)
+		return nil
+	case word == "Infinity", word == "NaN":
+		return fmt.Errorf("json5: %s at offset %d has no JSON equivalent", word, start)
+	}
+
+	if next, ok := p.peek(); !ok || next != ':' {
+		return fmt.Errorf("json5: unexpected identifier %q at offset %d", word, start)
+	}
+	key, _ := json.Marshal(word)
+	p.out.Write(key)
+	return nil
+}
+
+// identName reads an identifier, unescaping its \u escapes
+func (p *json5Parser) identName() (name string, escaped bool, err error) {
+	var b strings.Builder
+	for p.i < len(p.src) {
+		c := p.src[p.i]
+		switch {
+		case c == '\\':
+			if p.i+6 > len(p.src) || p.src[p.i+1] != 'u' {
+				return "", false, fmt.Errorf("json5: invalid escape in identifier at offset %d", p.i)
+			}
+			r, err := strconv.ParseUint(string(p.src[p.i+2:p.i+6]), 16, 32)
+			if err != nil {
+				return "", false, fmt.Errorf("json5: invalid \\u escape in identifier at offset %d", p.i)
+			}
+			b.WriteRune(rune(r))
+			p.i += 6
+			escaped = true
+		case c >= utf8.RuneSelf:
+			if p.space() > 0 {
+				return b.String(), escaped, nil
+			}
+			r, size := utf8.DecodeRune(p.src[p.i:])
+			b.WriteRune(r)
+			p.i += size
+		case isIdentByte(c) || isDigit(c):
+			b.WriteByte(c)
+			p.i++
+		default:
+			return b.String(), escaped, nil
+		}
+	}
+	return b.String(), escaped, nil
+}
+
+func (p *json5Parser) word() string {
+	start := p.i
+	for p.i < len(p.src) && (isIdentByte(p.src[p.i]) || isDigit(p.src[p.i])) {
+		p.i++
+	}
+	return string(p.src[start:p.i])
+}
+
+func (p *json5Parser) digits(ok func(byte) bool) string {
+	start := p.i
+	for p.i < len(p.src) && ok(p.src[p.i]) {
+		p.i++
+	}
+	return string(p.src[start:p.i])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isIdentByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$' || c >= utf8.RuneSelf
+}
@@ -0,0 +1,98 @@
+package jsondb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSON5ToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string // "" when the input must be rejected
+	}{
+		{"plain JSON", `{"a": [1, "two", true, null]}`, `{"a": [1, "two", true, null]}`},
+		{"comments", "{// line\n\"a\": /* block */ 1}", `{"a": 1}`},
+		{"trailing commas", `{"a": [1, 2,], "b": 3,}`, `{"a": [1, 2], "b": 3}`},
+		{"trailing comma before a comment", "[1, // last\n]", `[1]`},
+		{"unquoted keys", `{a: 1, $b_2: 2, _c: 3}`, `{"a": 1, "$b_2": 2, "_c": 3}`},
+		{"single quotes", `{'a': 'it\'s "x"'}`, `{"a": "it's \"x\""}`},
+		{"escapes", `['\x41\v\0', "é", 'a\
+b']`, `["A\u000b\u0000", "é", "ab"]`},
+		{"hex", `[0x1F, -0xff, 0x10000000000000000]`, `[31, -255, 18446744073709551616]`},
+		{"decimal points", `[.5, 5., -.5, +1, 1e3, 2.5E-2]`, `[0.5, 5, -0.5, 1, 1e3, 2.5e-2]`},
+		{"BOM", "\ufeff{\"a\": 1}", `{"a": 1}`},
+		{"unicode whitespace", "{\u00a0a\u2028: 1,\u3000\v\fb:\u2029 2}", `{"a": 1, "b": 2}`},
+		{"unicode keys", `{café: 1}`, `{"café": 1}`},
+		{"escaped keys", `{\u0061b: 1, \u0074rue: 2, x\u0079: 3}`, `{"ab": 1, "true": 2, "xy": 3}`},
+		{"unicode whitespace in strings", "['\u00a0\u2028']", "[\"\u00a0\u2028\"]"},
+
+		{"Infinity", `[Infinity]`, ""},
+		{"negative Infinity", `[-Infinity]`, ""},
+		{"NaN", `{a: NaN}`, ""},
+		{"unterminated comment", `{/* a: 1}`, ""},
+		{"lone slash", `{a: 1 / 2}`, ""},
+		{"unterminated string", `{a: 'x}`, ""},
+		{"newline in string", "{a: 'x\ny'}", ""},
+		{"bare identifier value", `{a: b}`, ""},
+		{"bad identifier escape", `{\x61: 1}`, ""},
+		{"short identifier escape", `{\u61: 1}`, ""},
+		{"invalid exponent", `[1e]`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json5ToJSON([]byte(tt.in))
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("json5ToJSON(%q) = %s, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("json5ToJSON(%q) = %v", tt.in, err)
+			}
+			g, err := decodeDocument(got)
+			if err != nil {
+				t.Fatalf("json5ToJSON(%q) = %s, not JSON: %v", tt.in, got, err)
+			}
+			w, err := decodeDocument([]byte(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(g, w) {
+				t.Errorf("json5ToJSON(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadJSON5(t *testing.T) {
+	d, dir := newTestDriver(t, nil)
+	if err := d.WriteJSON5("users", "ada", testUser{"Ada", 36}); err != nil {
+		t.Fatal(err)
+	}
+	edit := func(doc string) {
+		if err := os.WriteFile(filepath.Join(dir, "users", "ada.json"), []byte(doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var u testUser
+	if err := d.ReadJSON5("users", "ada", &u); err != nil || u != (testUser{"Ada", 36}) {
+		t.Fatalf("ReadJSON5() of a JSON record = %+v, %v", u, err)
+	}
+
+	edit("\ufeff{\n  // edited by hand\n  Name: 'Ada',\n  Age: 0x24,\n}\n")
+	u = testUser{}
+	if err := d.ReadJSON5("users", "ada", &u); err != nil || u != (testUser{"Ada", 36}) {
+		t.Fatalf("ReadJSON5() of a JSON5 record = %+v, %v", u, err)
+	}
+
+	edit("{Name: 'Ada', Age: NaN}")
+	err := d.ReadJSON5("users", "ada", &testUser{})
+	if err == nil || !strings.Contains(err.Error(), "NaN") {
+		t.Fatalf("ReadJSON5() of a record holding NaN = %v, want the JSON5 error", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Package jsondbtest provides throwaway databases for tests, kept in memory
+// so they need no temp dir:
+//
+//	func TestSignup(t *testing.T) {
+//		db := jsondbtest.New(t)
+//		...
+//	}
+//
+// NewOnDisk stores one in a temp dir instead, for tests of what the files
+// hold or of features requiring the Disk Storage.
+package jsondbtest
+
+import (
+	"testing"
+
+	jsondb "github.com/JJFelix/go-json-database"
+)
+
+// nopLogger discards everything logged through it
+type nopLogger struct{}
+
+func (nopLogger) Fatal(string, ...interface{}) {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Trace(string, ...interface{}) {}
+
+// New returns a driver on a fresh jsondb.Memory Storage that logs nothing,
+// isolated from every other. It is closed when the test and its subtests
+// finish.
+func New(t testing.TB) *jsondb.Driver {
+	t.Helper()
+	return NewWithOptions(t, nil)
+}
+
+// NewWithOptions is New with options, which may be nil. Their Backend is
+// replaced with a fresh Memory Storage, and a nil Logger with one logging
+// nothing unless Slog is set.
+func NewWithOptions(t testing.TB, options *jsondb.Options) *jsondb.Driver {
+	t.Helper()
+
+	opts := jsondb.Options{}
+	if options != nil {
+		opts = *options
+	}
+	opts.Backend = jsondb.Memory()
+	if opts.Logger == nil && opts.Slog == nil {
+		opts.Logger = nopLogger{}
+	}
+
+	d, err := jsondb.New("db", &opts)
+	if err != nil {
+		t.Fatalf("unable to create test driver: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// NewOnDisk is NewWithOptions storing the database under a fresh t.TempDir(),
+// which is returned too. options' Backend is left as set, the Disk Storage
+// unless they set one. The dir is removed once the driver is closed.
+func NewOnDisk(t testing.TB, options *jsondb.Options) (*jsondb.Driver, string) {
+	t.Helper()
+
+	opts := jsondb.Options{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Logger == nil && opts.Slog == nil {
+		opts.Logger = nopLogger{}
+	}
+
+	dir := t.TempDir()
+	d, err := jsondb.New(dir, &opts)
+	if err != nil {
+		t.Fatalf("unable to create test driver: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, dir
+}
@@ -0,0 +1,38 @@
+package jsondbtest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jsondb "github.com/JJFelix/go-json-database"
+)
+
+func TestNewOnDisk(t *testing.T) {
+	var db *jsondb.Driver
+	t.Run("test", func(t *testing.T) {
+		var dir string
+		db, dir = NewOnDisk(t, nil)
+		if err := db.Write("users", "ada", map[string]string{"Name": "Ada"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "users", "ada.json")); err != nil {
+			t.Fatalf("record not on disk: %v", err)
+		}
+	})
+
+	if _, err := db.Collections(); !errors.Is(err, jsondb.ErrClosed) {
+		t.Fatalf("Collections() after the test = %v, want ErrClosed", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	a, b := New(t), New(t)
+	if err := a.Write("users", "ada", map[string]string{"Name": "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.Exists("users", "ada"); err != nil || ok {
+		t.Fatalf("Exists() on another database = %v, %v, want false", ok, err)
+	}
+}
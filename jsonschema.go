@@ -0,0 +1,538 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// metaDir is the area under the database dir where the driver keeps its own
+// files, such as the schemas set with SetSchema. It can't be used as a
+// collection.
+const metaDir = "_meta"
+
+// ErrSchemaViolation is matched by errors.Is for every *SchemaViolationError
+var ErrSchemaViolation = errors.New("schema violation")
+
+// SchemaViolationError reports a record rejected by its collection's JSON
+// Schema, with one problem per failed keyword
+type SchemaViolationError struct {
+	Collection string
+	Resource   string
+	Problems   []string // "<JSON pointer>: <problem>"; the whole record is "(record)"
+}
+
+func (e *SchemaViolationError) Error() string {
+	return fmt.Sprintf("record %v in %v violates the collection schema - %s", e.Resource, e.Collection, strings.Join(e.Problems, "; "))
+}
+
+func (e *SchemaViolationError) Is(target error) bool {
+	return target == ErrSchemaViolation
+}
+
+// jsonSchemas caches the schemas set with SetSchema, loaded from disk on
+// first use; a loaded collection without a schema maps to nil
+type jsonSchemas struct {
+	mutex       sync.Mutex
+	collections map[string]*jsonSchema
+}
+
+func (d *Driver) schemaPath(collection string) string {
+	return filepath.Join(d.dir, metaDir, "schemas", collection+".json")
+}
+
+// SetSchema registers a JSON Schema every record written to a collection
+// must satisfy from now on, by Write, Update, Patch, Insert and transactions
+// alike; an empty schema removes it. It is stored under the database's _meta
+// directory, so it applies again after a restart. Records already stored
+// aren't checked.
+//
+// The supported keywords are type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, uniqueItems,
+// minProperties, maxProperties, minLength, maxLength, pattern, minimum,
+// maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf,
+// oneOf and not. Others, such as format and annotations, are ignored, except
+// $ref, which is rejected.
+func (d *Driver) SetSchema(collection string, schema []byte) (err error) {
+	defer d.done(OpSetSchema, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to set schema", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.requireJSON("SetSchema"); err != nil {
+		return err
+	}
+
+	var compiled *jsonSchema
+	if len(schema) > 0 {
+		doc, err := decodeDocument(schema)
+		if err != nil {
+			return fmt.Errorf("invalid schema for %v: %w", collection, err)
+		}
+		if compiled, err = compileSchema(doc, ""); err != nil {
+			return fmt.Errorf("invalid schema for %v: %w", collection, err)
+		}
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := d.schemaPath(collection)
+	if compiled == nil {
+		err = d.backend.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else if err = d.backend.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		err = d.writeFile(path+d.tmpSuffix, path, schema)
+	}
+	if err != nil {
+		return err
+	}
+
+	s := d.jsonSchemas
+	s.mutex.Lock()
+	s.collections[collection] = compiled
+	s.mutex.Unlock()
+	return nil
+}
+
+// checkSchema validates an encoded record against its collection's schema,
+// if any. The caller must hold the collection lock.
+func (d *Driver) checkSchema(collection, resource string, b []byte) error {
+	if d.format != FormatJSON {
+		return nil
+	}
+
+	s := d.jsonSchemas
+	s.mutex.Lock()
+	schema, ok := s.collections[collection]
+	s.mutex.Unlock()
+	if !ok {
+		raw, err := d.backend.ReadFile(d.schemaPath(collection))
+		switch {
+		case err == nil:
+			doc, err := decodeDocument(raw)
+			if err == nil {
+				schema, err = compileSchema(doc, "")
+			}
+			if err != nil {
+				return fmt.Errorf("corrupt schema of %v: %w", collection, err)
+			}
+		case !os.IsNotExist(err):
+			return err
+		}
+		s.mutex.Lock()
+		s.collections[collection] = schema
+		s.mutex.Unlock()
+	}
+	if schema == nil {
+		return nil
+	}
+
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return err
+	}
+	if obj, ok := doc.(map[string]interface{}); ok && d.metadata {
+		delete(obj, d.metaField) // maintained by the driver, not the caller
+	}
+	var problems []string
+	schema.validate(doc, "", &problems)
+	if len(problems) > 0 {
+		return &SchemaViolationError{Collection: collection, Resource: resource, Problems: problems}
+	}
+	return nil
+}
+
+// jsonSchema is a compiled JSON Schema. Unset keywords are nil.
+type jsonSchema struct {
+	always *bool // the true and false schemas
+
+	types      []string
+	enum       []interface{}
+	constValue *interface{}
+	not        *jsonSchema
+	allOf      []*jsonSchema
+	anyOf      []*jsonSchema
+	oneOf      []*jsonSchema
+
+	properties    map[string]*jsonSchema
+	required      []string
+	additional    *jsonSchema
+	minProperties *int
+	maxProperties *int
+
+	items       *jsonSchema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+}
+
+var schemaTypes = map[string]bool{
+	"null": true, "boolean": true, "number": true, "integer": true,
+	"string": true, "array": true, "object": true,
+}
+
+// compileSchema checks a decoded schema and compiles it; at is the JSON
+// pointer of v within the whole schema, for errors
+func compileSchema(v interface{}, at string) (*jsonSchema, error) {
+	if b, ok := v.(bool); ok {
+		return &jsonSchema{always: &b}, nil
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: a schema must be an object or a boolean, got %s", pointerOrRoot(at), jsonType(v))
+	}
+
+	s := &jsonSchema{}
+	var err error
+	sub := func(key string, v interface{}) *jsonSchema {
+		if err != nil {
+			return nil
+		}
+		var c *jsonSchema
+		c, err = compileSchema(v, at+"/"+key)
+		return c
+	}
+	list := func(key string, v interface{}) []*jsonSchema {
+		arr, ok := v.([]interface{})
+		if !ok || len(arr) == 0 {
+			if err == nil {
+				err = fmt.Errorf("%s/%s: must be a non-empty array of schemas", at, key)
+			}
+			return nil
+		}
+		out := make([]*jsonSchema, len(arr))
+		for i, e := range arr {
+			out[i] = sub(fmt.Sprintf("%s/%d", key, i), e)
+		}
+		return out
+	}
+	number := func(key string, v interface{}) *float64 {
+		n, ok := v.(json.Number)
+		f, ferr := n.Float64()
+		if (!ok || ferr != nil) && err == nil {
+			err = fmt.Errorf("%s/%s: must be a number", at, key)
+		}
+		return &f
+	}
+	count := func(key string, v interface{}) *int {
+		f := number(key, v)
+		if err == nil && (*f < 0 || *f != math.Trunc(*f)) {
+			err = fmt.Errorf("%s/%s: must be a non-negative integer", at, key)
+		}
+		n := int(*f)
+		return &n
+	}
+
+	for _, key := range sortedKeys(obj) {
+		v := obj[key]
+		switch key {
+		case "$ref":
+			err = fmt.Errorf("%s/$ref: references are not supported", at)
+		case "type":
+			switch t := v.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				for _, e := range t {
+					name, _ := e.(string)
+					s.types = append(s.types, name)
+				}
+			}
+			if len(s.types) == 0 {
+				err = fmt.Errorf("%s/type: must be a type name or an array of them", at)
+			}
+			for _, t := range s.types {
+				if !schemaTypes[t] && err == nil {
+					err = fmt.Errorf("%s/type: unknown type %q", at, t)
+				}
+			}
+		case "enum":
+			arr, ok := v.([]interface{})
+			if !ok {
+				err = fmt.Errorf("%s/enum: must be an array", at)
+			}
+			s.enum = arr
+		case "const":
+			s.constValue = &v
+		case "not":
+			s.not = sub(key, v)
+		case "allOf":
+			s.allOf = list(key, v)
+		case "anyOf":
+			s.anyOf = list(key, v)
+		case "oneOf":
+			s.oneOf = list(key, v)
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("%s/properties: must be an object", at)
+				break
+			}
+			s.properties = make(map[string]*jsonSchema, len(props))
+			for _, name := range sortedKeys(props) {
+				s.properties[name] = sub("properties/"+escapePointer(name), props[name])
+			}
+		case "required":
+			arr, ok := v.([]interface{})
+			for _, e := range arr {
+				name, isString := e.(string)
+				ok = ok && isString
+				s.required = append(s.required, name)
+			}
+			if !ok {
+				err = fmt.Errorf("%s/required: must be an array of strings", at)
+			}
+		case "additionalProperties":
+			s.additional = sub(key, v)
+		case "items":
+			s.items = sub(key, v)
+		case "uniqueItems":
+			b, ok := v.(bool)
+			if !ok {
+				err = fmt.Errorf("%s/uniqueItems: must be a boolean", at)
+			}
+			s.uniqueItems = b
+		case "pattern":
+			p, ok := v.(string)
+			if !ok {
+				err = fmt.Errorf("%s/pattern: must be a string", at)
+				break
+			}
+			if s.pattern, err = regexp.Compile(p); err != nil {
+				err = fmt.Errorf("%s/pattern: %w", at, err)
+			}
+		case "minProperties":
+			s.minProperties = count(key, v)
+		case "maxProperties":
+			s.maxProperties = count(key, v)
+		case "minItems":
+			s.minItems = count(key, v)
+		case "maxItems":
+			s.maxItems = count(key, v)
+		case "minLength":
+			s.minLength = count(key, v)
+		case "maxLength":
+			s.maxLength = count(key, v)
+		case "minimum":
+			s.minimum = number(key, v)
+		case "maximum":
+			s.maximum = number(key, v)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum = number(key, v)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum = number(key, v)
+		case "multipleOf":
+			if s.multipleOf = number(key, v); err == nil && *s.multipleOf <= 0 {
+				err = fmt.Errorf("%s/multipleOf: must be positive", at)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// validate appends to problems every way v, found at the JSON pointer at of
+// the record, fails s
+func (s *jsonSchema) validate(v interface{}, at string, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, pointerOrRoot(at)+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			fail("no value is allowed here")
+		}
+		return
+	}
+
+	if len(s.types) > 0 && !schemaTypeMatches(s.types, v) {
+		fail("must be of type %s, got %s", strings.Join(s.types, " or "), jsonType(v))
+		return
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			found = found || jsonEqual(v, e)
+		}
+		if !found {
+			fail("must be one of the enum values")
+		}
+	}
+	if s.constValue != nil && !jsonEqual(v, *s.constValue) {
+		fail("must equal the const value")
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, at, problems)
+	}
+	if s.anyOf != nil && countValid(s.anyOf, v) == 0 {
+		fail("must match at least one schema of anyOf")
+	}
+	if s.oneOf != nil {
+		if n := countValid(s.oneOf, v); n != 1 {
+			fail("must match exactly one schema of oneOf, matches %d", n)
+		}
+	}
+	if s.not != nil && countValid([]*jsonSchema{s.not}, v) == 1 {
+		fail("must not match the schema of not")
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		if s.minProperties != nil && len(v) < *s.minProperties {
+			fail("must have at least %d properties, has %d", *s.minProperties, len(v))
+		}
+		if s.maxProperties != nil && len(v) > *s.maxProperties {
+			fail("must have at most %d properties, has %d", *s.maxProperties, len(v))
+		}
+		for _, name := range sortedKeys(v) {
+			child := at + "/" + escapePointer(name)
+			if p, ok := s.properties[name]; ok {
+				p.validate(v[name], child, problems)
+			} else if s.additional != nil {
+				if s.additional.always != nil && !*s.additional.always {
+					fail("property %q is not allowed", name)
+				} else {
+					s.additional.validate(v[name], child, problems)
+				}
+			}
+		}
+
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items, has %d", *s.minItems, len(v))
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items, has %d", *s.maxItems, len(v))
+		}
+		if s.uniqueItems {
+			for i := range v {
+				for j := i + 1; j < len(v); j++ {
+					if jsonEqual(v[i], v[j]) {
+						fail("items %d and %d must be unique", i, j)
+					}
+				}
+			}
+		}
+		if s.items != nil {
+			for i, e := range v {
+				s.items.validate(e, fmt.Sprintf("%s/%d", at, i), problems)
+			}
+		}
+
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			fail("must be at least %d characters long, is %d", *s.minLength, n)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("must be at most %d characters long, is %d", *s.maxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match the pattern %q", s.pattern.String())
+		}
+
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			fail("invalid number %s", v)
+			return
+		}
+		if s.minimum != nil && f < *s.minimum {
+			fail("must be at least %v, is %v", *s.minimum, v)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			fail("must be at most %v, is %v", *s.maximum, v)
+		}
+		if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+			fail("must be greater than %v, is %v", *s.exclusiveMinimum, v)
+		}
+		if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+			fail("must be less than %v, is %v", *s.exclusiveMaximum, v)
+		}
+		if s.multipleOf != nil {
+			if q := f / *s.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("must be a multiple of %v, is %v", *s.multipleOf, v)
+			}
+		}
+	}
+}
+
+func countValid(schemas []*jsonSchema, v interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		var problems []string
+		if s.validate(v, "", &problems); len(problems) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func schemaTypeMatches(types []string, v interface{}) bool {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if n, ok := v.(json.Number); ok {
+				if f, err := n.Float64(); err == nil && f == math.Trunc(f) {
+					return true
+				}
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		default:
+			if jsonType(v) == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// escapePointer escapes a member name as a JSON pointer token
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+func pointerOrRoot(at string) string {
+	if at == "" {
+		return "(record)"
+	}
+	return at
+}
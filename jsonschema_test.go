@@ -0,0 +1,174 @@
+package jsondb
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		doc    string
+		want   []string // problems, nil when valid
+	}{
+		{"true", `true`, `{"a": 1}`, nil},
+		{"false", `false`, `1`, []string{"(record): no value is allowed here"}},
+
+		{"type string", `{"type": "string"}`, `"x"`, nil},
+		{"type mismatch", `{"type": "string"}`, `1`, []string{"(record): must be of type string, got number"}},
+		{"type list", `{"type": ["string", "null"]}`, `null`, nil},
+		{"integer", `{"type": "integer"}`, `3`, nil},
+		{"integer 1.0", `{"type": "integer"}`, `1.0`, nil},
+		{"integer 1e2", `{"type": "integer"}`, `1e2`, nil},
+		{"integer 1.5", `{"type": "integer"}`, `1.5`, []string{"(record): must be of type integer, got number"}},
+		{"number integer", `{"type": "number"}`, `3`, nil},
+		{"boolean", `{"type": "boolean"}`, `false`, nil},
+		{"array", `{"type": "array"}`, `{}`, []string{"(record): must be of type array, got object"}},
+
+		{"enum", `{"enum": ["a", 1, null]}`, `1.0`, nil},
+		{"enum mismatch", `{"enum": ["a", 1]}`, `"b"`, []string{"(record): must be one of the enum values"}},
+		{"const", `{"const": {"a": [1]}}`, `{"a": [1.0]}`, nil},
+		{"const mismatch", `{"const": 1}`, `2`, []string{"(record): must equal the const value"}},
+
+		{"allOf", `{"allOf": [{"minimum": 1}, {"maximum": 2}]}`, `3`, []string{"(record): must be at most 2, is 3"}},
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"type": "null"}]}`, `null`, nil},
+		{"anyOf mismatch", `{"anyOf": [{"type": "string"}, {"type": "null"}]}`, `1`, []string{"(record): must match at least one schema of anyOf"}},
+		{"oneOf", `{"oneOf": [{"type": "integer"}, {"type": "string"}]}`, `1`, nil},
+		{"oneOf both", `{"oneOf": [{"type": "integer"}, {"type": "number"}]}`, `1`, []string{"(record): must match exactly one schema of oneOf, matches 2"}},
+		{"not", `{"not": {"type": "string"}}`, `"x"`, []string{"(record): must not match the schema of not"}},
+
+		{"properties", `{"properties": {"age": {"type": "integer"}, "a/b": {"type": "string"}}}`, `{"age": "x", "a/b": 1, "other": 1}`,
+			[]string{"/a~1b: must be of type string, got number", "/age: must be of type integer, got string"}},
+		{"required", `{"required": ["name", "age"]}`, `{"name": "Ada"}`, []string{`(record): missing required property "age"`}},
+		{"required on a non-object", `{"required": ["name"]}`, `1`, nil},
+		{"additionalProperties false", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"a": 1, "b": 2}`, []string{`(record): property "b" is not allowed`}},
+		{"additionalProperties schema", `{"properties": {"a": {}}, "additionalProperties": {"type": "string"}}`, `{"a": 1, "b": 2}`, []string{"/b: must be of type string, got number"}},
+		{"minProperties", `{"minProperties": 2}`, `{"a": 1}`, []string{"(record): must have at least 2 properties, has 1"}},
+		{"maxProperties", `{"maxProperties": 1}`, `{"a": 1, "b": 2}`, []string{"(record): must have at most 1 properties, has 2"}},
+
+		{"items", `{"items": {"type": "string"}}`, `["a", 1]`, []string{"/1: must be of type string, got number"}},
+		{"minItems", `{"minItems": 1}`, `[]`, []string{"(record): must have at least 1 items, has 0"}},
+		{"maxItems", `{"maxItems": 1}`, `[1, 2]`, []string{"(record): must have at most 1 items, has 2"}},
+		{"uniqueItems", `{"uniqueItems": true}`, `[1, "1", [1], {"a": 1}]`, nil},
+		{"uniqueItems 1 and 1.0", `{"uniqueItems": true}`, `[1, 1.0]`, []string{"(record): items 0 and 1 must be unique"}},
+		{"uniqueItems objects", `{"uniqueItems": true}`, `[{"a": 1, "b": 2}, {"b": 2, "a": 1}]`, []string{"(record): items 0 and 1 must be unique"}},
+		{"uniqueItems false", `{"uniqueItems": false}`, `[1, 1]`, nil},
+
+		{"minLength counts characters", `{"minLength": 3}`, `"né"`, []string{"(record): must be at least 3 characters long, is 2"}},
+		{"maxLength", `{"maxLength": 2}`, `"née"`, []string{"(record): must be at most 2 characters long, is 3"}},
+		{"pattern", `{"pattern": "^[a-z]+$"}`, `"Ada"`, []string{`(record): must match the pattern "^[a-z]+$"`}},
+		{"pattern is not anchored", `{"pattern": "d"}`, `"Ada"`, nil},
+
+		{"minimum", `{"minimum": 1}`, `1`, nil},
+		{"minimum below", `{"minimum": 1}`, `0.5`, []string{"(record): must be at least 1, is 0.5"}},
+		{"maximum", `{"maximum": 1}`, `1.5`, []string{"(record): must be at most 1, is 1.5"}},
+		{"exclusiveMinimum", `{"exclusiveMinimum": 1}`, `1`, []string{"(record): must be greater than 1, is 1"}},
+		{"exclusiveMaximum", `{"exclusiveMaximum": 1}`, `1`, []string{"(record): must be less than 1, is 1"}},
+		{"multipleOf", `{"multipleOf": 3}`, `9`, nil},
+		{"multipleOf mismatch", `{"multipleOf": 3}`, `10`, []string{"(record): must be a multiple of 3, is 10"}},
+		{"multipleOf float", `{"multipleOf": 0.1}`, `0.3`, nil},
+		{"multipleOf float mismatch", `{"multipleOf": 0.1}`, `0.35`, []string{"(record): must be a multiple of 0.1, is 0.35"}},
+		{"number keywords ignore strings", `{"minimum": 5}`, `"1"`, nil},
+
+		{"unknown keywords are ignored", `{"format": "email", "title": "x"}`, `"nope"`, nil},
+		{"nested", `{"properties": {"jobs": {"items": {"required": ["title"]}}}}`, `{"jobs": [{"title": "a"}, {}]}`, []string{`/jobs/1: missing required property "title"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := mustDecode(t, tt.schema)
+			s, err := compileSchema(schema, "")
+			if err != nil {
+				t.Fatalf("compileSchema(%s) = %v", tt.schema, err)
+			}
+			var problems []string
+			s.validate(mustDecode(t, tt.doc), "", &problems)
+			if !reflect.DeepEqual(problems, tt.want) {
+				t.Errorf("validate(%s) against %s =\n%q\nwant\n%q", tt.doc, tt.schema, problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileSchemaRejects(t *testing.T) {
+	tests := []struct {
+		schema, want string
+	}{
+		{`{"$ref": "#/definitions/x"}`, "/$ref: references are not supported"},
+		{`{"properties": {"a": {"$ref": "#"}}}`, "/properties/a/$ref: references are not supported"},
+		{`1`, "(record): a schema must be an object or a boolean, got number"},
+		{`{"type": "str"}`, `/type: unknown type "str"`},
+		{`{"type": []}`, "/type: must be a type name or an array of them"},
+		{`{"enum": 1}`, "/enum: must be an array"},
+		{`{"anyOf": []}`, "/anyOf: must be a non-empty array of schemas"},
+		{`{"required": [1]}`, "/required: must be an array of strings"},
+		{`{"uniqueItems": 1}`, "/uniqueItems: must be a boolean"},
+		{`{"pattern": "("}`, "/pattern: error parsing regexp"},
+		{`{"minItems": -1}`, "/minItems: must be a non-negative integer"},
+		{`{"maxLength": 1.5}`, "/maxLength: must be a non-negative integer"},
+		{`{"minimum": "1"}`, "/minimum: must be a number"},
+		{`{"multipleOf": 0}`, "/multipleOf: must be positive"},
+	}
+	for _, tt := range tests {
+		_, err := compileSchema(mustDecode(t, tt.schema), "")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("compileSchema(%s) = %v, want an error containing %q", tt.schema, err, tt.want)
+		}
+	}
+}
+
+func TestSetSchema(t *testing.T) {
+	d, dir := newTestDriver(t, nil)
+	if err := d.SetSchema("users", []byte(`{"$ref": "#"}`)); err == nil {
+		t.Fatal("SetSchema() accepted $ref")
+	}
+	schema := `{"type": "object", "required": ["Name"], "properties": {"Age": {"type": "integer", "minimum": 0}}}`
+	if err := d.SetSchema("users", []byte(schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "ada", testUser{"Ada", 36}); err != nil {
+		t.Fatalf("Write() of a valid record = %v", err)
+	}
+	err := d.Write("users", "bob", map[string]interface{}{"Age": -1})
+	var sv *SchemaViolationError
+	if !errors.As(err, &sv) || !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("Write() of an invalid record = %v, want a *SchemaViolationError", err)
+	}
+	want := []string{`(record): missing required property "Name"`, "/Age: must be at least 0, is -1"}
+	if sv.Collection != "users" || sv.Resource != "bob" || !reflect.DeepEqual(sv.Problems, want) {
+		t.Errorf("SchemaViolationError = %+v, want problems %q", sv, want)
+	}
+	if err := d.Patch("users", "ada", []byte(`{"Age": 1.5}`), MergePatch); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("Patch() breaking the schema = %v, want ErrSchemaViolation", err)
+	}
+
+	// the schema applies again after a restart
+	d.Close()
+	d, err = New(dir, &Options{Slog: quietSlog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Write("users", "bob", map[string]interface{}{"Age": 1}); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("Write() after a restart = %v, want ErrSchemaViolation", err)
+	}
+
+	if err := d.SetSchema("users", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Write("users", "bob", map[string]interface{}{"Age": 1}); err != nil {
+		t.Errorf("Write() after removing the schema = %v", err)
+	}
+}
+
+func mustDecode(t *testing.T, doc string) interface{} {
+	t.Helper()
+	v, err := decodeDocument([]byte(doc))
+	if err != nil {
+		t.Fatalf("unable to decode %s: %v", doc, err)
+	}
+	return v
+}
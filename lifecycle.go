@@ -0,0 +1,196 @@
+package jsondb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrClosed is wrapped by the error of every operation started after
+	// Close
+	ErrClosed = errors.New("database is closed")
+
+	// ErrReadOnly is wrapped by the error of every modification of a driver
+	// opened with Options.ReadOnly
+	ErrReadOnly = errors.New("database is read-only")
+)
+
+// lifecycle tracks Close for a driver and the copies Observe and Use make of
+// it. Close goes through its states in field order.
+type lifecycle struct {
+	mutex   sync.Mutex     // guards setting closing and adding workers
+	closing atomic.Bool    // fails new collection locks and workers
+	stop    chan struct{}  // closed to stop the background goroutines
+	workers sync.WaitGroup // the background goroutines
+	closed  atomic.Bool    // fails every file access
+	once    sync.Once
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{stop: make(chan struct{})}
+}
+
+// startWorker runs fn on a background goroutine that Close stops by closing
+// stop and waits for. It reports false, doing nothing, once Close has
+// started.
+func (d *Driver) startWorker(fn func()) bool {
+	l := d.life
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closing.Load() {
+		return false
+	}
+	l.workers.Add(1)
+	go func() {
+		defer l.workers.Done()
+		fn()
+	}()
+	return true
+}
+
+// checkWritable fails modifications after Close or with Options.ReadOnly
+func (d *Driver) checkWritable(collection string) error {
+	if d.life.closing.Load() {
+		return fmt.Errorf("%w - unable to modify %v", ErrClosed, collection)
+	}
+	if d.readOnly {
+		return fmt.Errorf("%w - unable to modify %v", ErrReadOnly, collection)
+	}
+	return nil
+}
+
+// Close shuts the driver down, along with every driver made from it by
+// Observe or Use. New modifications fail with ErrClosed straight away; the
+// ones in progress are allowed to finish, which includes waiting for the
+// locks taken with LockCollection to be released. Then the background
+// goroutines are stopped, once the TTL janitor and trash purge have finished
+// a pass they may be in and the pending VerifyWrites spot checks have run,
+// and the channels of Watch and Listen are closed. Once Close returns no
+// file lock is held and every operation, reads included, fails with
+// ErrClosed. Calling it again does nothing.
+func (d *Driver) Close() error {
+	l := d.life
+	l.once.Do(func() {
+		l.mutex.Lock()
+		l.closing.Store(true)
+		l.mutex.Unlock()
+
+		// a mutation holds its collection mutex from before it checks
+		// closing until it is done, so taking each one waits for them all
+		d.mutex.Lock()
+		mutexes := make([]*sync.Mutex, 0, len(d.mutexes))
+		for _, m := range d.mutexes {
+			mutexes = append(mutexes, m)
+		}
+		d.mutex.Unlock()
+		for _, m := range mutexes {
+			m.Lock()
+			m.Unlock()
+		}
+
+		close(l.stop)
+		l.workers.Wait()
+		l.closed.Store(true)
+
+		d.watchers.closeAll()
+	})
+	return nil
+}
+
+// gatedStorage is the Storage of a driver, failing every call after Close
+// and those modifying files with Options.ReadOnly
+type gatedStorage struct {
+	Storage
+	life     *lifecycle
+	readOnly bool
+}
+
+func (s gatedStorage) check(op, name string, modifies bool) error {
+	if s.life.closed.Load() {
+		return &fs.PathError{Op: op, Path: name, Err: ErrClosed}
+	}
+	if modifies && s.readOnly {
+		return &fs.PathError{Op: op, Path: name, Err: ErrReadOnly}
+	}
+	return nil
+}
+
+func (s gatedStorage) Stat(name string) (fs.FileInfo, error) {
+	if err := s.check("stat", name, false); err != nil {
+		return nil, err
+	}
+	return s.Storage.Stat(name)
+}
+
+func (s gatedStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := s.check("readdir", name, false); err != nil {
+		return nil, err
+	}
+	return s.Storage.ReadDir(name)
+}
+
+func (s gatedStorage) ReadFile(name string) ([]byte, error) {
+	if err := s.check("open", name, false); err != nil {
+		return nil, err
+	}
+	return s.Storage.ReadFile(name)
+}
+
+func (s gatedStorage) WriteFile(name string, b []byte, perm fs.FileMode) error {
+	if err := s.check("open", name, true); err != nil {
+		return err
+	}
+	return s.Storage.WriteFile(name, b, perm)
+}
+
+func (s gatedStorage) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	modifies := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if err := s.check("open", name, modifies); err != nil {
+		return nil, err
+	}
+	return s.Storage.OpenFile(name, flag, perm)
+}
+
+func (s gatedStorage) Rename(oldpath, newpath string) error {
+	if err := s.check("rename", oldpath, true); err != nil {
+		return err
+	}
+	return s.Storage.Rename(oldpath, newpath)
+}
+
+func (s gatedStorage) Remove(name string) error {
+	if err := s.check("remove", name, true); err != nil {
+		return err
+	}
+	return s.Storage.Remove(name)
+}
+
+func (s gatedStorage) RemoveAll(path string) error {
+	if err := s.check("removeall", path, true); err != nil {
+		return err
+	}
+	return s.Storage.RemoveAll(path)
+}
+
+func (s gatedStorage) MkdirAll(path string, perm fs.FileMode) error {
+	if err := s.check("mkdir", path, true); err != nil {
+		return err
+	}
+	return s.Storage.MkdirAll(path, perm)
+}
+
+func (s gatedStorage) Link(oldname, newname string) error {
+	l, ok := s.Storage.(interface{ Link(string, string) error })
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	if err := s.check("link", oldname, true); err != nil {
+		return err
+	}
+	return l.Link(oldname, newname)
+}
@@ -0,0 +1,200 @@
+package jsondb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidListOptions is wrapped by the error of ReadAllWithOptions and
+// FindWithOptions when ListOptions holds a negative Offset or Limit or a Sort
+// they can't parse
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// ListOptions sorts, pages and projects the records returned by
+// ReadAllWithOptions and FindWithOptions. The zero value returns every
+// record, in listing order, whole.
+type ListOptions struct {
+	// Sort orders the records by comma-separated dotted field paths, each
+	// optionally followed by asc (the default) or desc: "Age desc, Name".
+	// Records missing a field come after the others; values of different
+	// types order null, booleans, numbers, strings, then objects and arrays.
+	Sort string
+
+	Offset int // records to skip after sorting
+	Limit  int // most records to return; 0 means no limit
+
+	// Fields are the dotted field paths to keep in each record; the others
+	// are dropped. Empty keeps the whole record.
+	Fields []string
+}
+
+// sortKey is one field of ListOptions.Sort
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+func parseSort(s string) ([]sortKey, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var keys []sortKey
+	for _, part := range strings.Split(s, ",") {
+		words := strings.Fields(part)
+		if len(words) == 0 || len(words) > 2 {
+			return nil, fmt.Errorf("%w: invalid sort %q - want \"field [asc|desc], ...\"", ErrInvalidListOptions, s)
+		}
+		key := sortKey{field: words[0]}
+		if len(words) == 2 {
+			switch strings.ToLower(words[1]) {
+			case "asc":
+			case "desc":
+				key.desc = true
+			default:
+				return nil, fmt.Errorf("%w: invalid sort direction %q for %v - must be asc or desc", ErrInvalidListOptions, words[1], words[0])
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ReadAllWithOptions returns the records of a collection sorted, paged and
+// projected as opts selects. Sorting reads every record into memory first.
+// It requires the json Format.
+func (d *Driver) ReadAllWithOptions(collection string, opts ListOptions) (records []json.RawMessage, err error) {
+	defer d.done(OpReadAllWithOptions, collection, "", time.Now(), &err)
+	return d.list(collection, Query{}, opts)
+}
+
+// FindWithOptions is Find with the matches sorted, paged and projected as
+// opts selects
+func (d *Driver) FindWithOptions(collection string, query Query, opts ListOptions) (records []json.RawMessage, err error) {
+	defer d.done(OpFindWithOptions, collection, "", time.Now(), &err)
+	return d.list(collection, query, opts)
+}
+
+func (d *Driver) list(collection string, query Query, opts ListOptions) ([]json.RawMessage, error) {
+	if opts.Offset < 0 {
+		return nil, fmt.Errorf("%w: invalid offset %d - must not be negative", ErrInvalidListOptions, opts.Offset)
+	}
+	if opts.Limit < 0 {
+		return nil, fmt.Errorf("%w: invalid limit %d - must not be negative", ErrInvalidListOptions, opts.Limit)
+	}
+	keys, err := parseSort(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := d.find(context.Background(), collection, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) > 0 {
+		docs := make([]interface{}, len(records))
+		for i, b := range records {
+			if docs[i], err = decodeDocument(b); err != nil {
+				return nil, err
+			}
+		}
+		sort.Stable(listOrder{records, docs, keys})
+	}
+
+	if opts.Offset >= len(records) {
+		return []json.RawMessage{}, nil
+	}
+	records = records[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(records) {
+		records = records[:opts.Limit]
+	}
+
+	if len(opts.Fields) > 0 {
+		for i, b := range records {
+			doc, err := decodeDocument(b)
+			if err != nil {
+				return nil, err
+			}
+			if records[i], err = json.Marshal(projectFields(doc, opts.Fields)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return records, nil
+}
+
+// listOrder sorts records by the sort keys of their decoded docs
+type listOrder struct {
+	records []json.RawMessage
+	docs    []interface{}
+	keys    []sortKey
+}
+
+func (o listOrder) Len() int { return len(o.records) }
+
+func (o listOrder) Swap(i, j int) {
+	o.records[i], o.records[j] = o.records[j], o.records[i]
+	o.docs[i], o.docs[j] = o.docs[j], o.docs[i]
+}
+
+func (o listOrder) Less(i, j int) bool {
+	for _, k := range o.keys {
+		a, okA := lookupPath(o.docs[i], k.field)
+		b, okB := lookupPath(o.docs[j], k.field)
+		switch {
+		case !okA && !okB:
+			continue
+		case !okA || !okB:
+			return okA // missing fields last, whatever the direction
+		}
+
+		cmp := sortCompare(a, b)
+		if cmp == 0 {
+			continue
+		}
+		if k.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return false
+}
+
+// sortCompare orders any two decoded JSON values, by type first
+func sortCompare(a, b interface{}) int {
+	ra, rb := sortRank(a), sortRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	if a, ok := a.(bool); ok {
+		switch b := b.(bool); {
+		case a == b:
+			return 0
+		case b:
+			return -1
+		}
+		return 1
+	}
+	cmp, _ := compareValues(a, b)
+	return cmp
+}
+
+func sortRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case json.Number:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
@@ -0,0 +1,174 @@
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeType says what happened to a record
+type ChangeType int
+
+const (
+	Created ChangeType = iota
+	Modified
+	Deleted
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Created:
+		return "created"
+	case Modified:
+		return "modified"
+	case Deleted:
+		return "deleted"
+	}
+	return fmt.Sprintf("ChangeType(%d)", int(t))
+}
+
+// ChangeEvent reports a change to a record observed on disk
+type ChangeEvent struct {
+	Type       ChangeType
+	Collection string
+	Resource   string
+	ModTime    time.Time // zero for deletions
+}
+
+type fileSnapshot struct {
+	modTime time.Time
+	size    int64
+}
+
+// Listen polls a collection directory every interval and sends a ChangeEvent
+// for each record created, modified or deleted since the previous poll, by
+// comparing file modification times and sizes. Unlike OS file notifications
+// it works on any filesystem, including network mounts. Records present when
+// Listen is called don't produce events. Call the returned func to stop
+// polling; it closes the channel, as Close does.
+func (d *Driver) Listen(collection string, interval time.Duration) (_ <-chan ChangeEvent, _ func(), err error) {
+	defer d.done(OpListen, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, nil, fmt.Errorf("%w - unable to listen for changes", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, nil, err
+	}
+	if err := d.requireFiles("Listen"); err != nil {
+		return nil, nil, err
+	}
+	if interval <= 0 {
+		return nil, nil, fmt.Errorf("invalid interval %v - must be positive", interval)
+	}
+
+	dir := filepath.Join(d.dir, collection)
+	prev, err := d.snapshotDir(dir, d.ext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan ChangeEvent, 16)
+	done := make(chan struct{})
+
+	started := d.startWorker(func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-d.life.stop:
+				return
+			case <-ticker.C:
+			}
+
+			next, err := d.snapshotDir(dir, d.ext)
+			if err != nil {
+				d.log.Error("Unable to poll", "dir", dir, "error", err)
+				continue
+			}
+
+			for _, e := range diffSnapshots(collection, prev, next) {
+				select {
+				case ch <- e:
+				case <-done:
+					return
+				case <-d.life.stop:
+					return
+				}
+			}
+			prev = next
+		}
+	})
+	if !started {
+		return nil, nil, fmt.Errorf("%w - unable to listen for changes", ErrClosed)
+	}
+
+	var once sync.Once
+	stop := func() { once.Do(func() { close(done) }) }
+
+	return ch, stop, nil
+}
+
+// snapshotDir records the modification time and size of every record file in
+// dir; a missing dir is an empty snapshot
+func (d *Driver) snapshotDir(dir, ext string) (map[string]fileSnapshot, error) {
+	snap := make(map[string]fileSnapshot)
+
+	files, err := d.backend.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return snap, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ext {
+			continue
+		}
+
+		fi, err := file.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snap[strings.TrimSuffix(file.Name(), ext)] = fileSnapshot{fi.ModTime(), fi.Size()}
+	}
+
+	return snap, nil
+}
+
+// diffSnapshots turns the differences between two snapshots into events,
+// sorted by resource name
+func diffSnapshots(collection string, prev, next map[string]fileSnapshot) []ChangeEvent {
+	var events []ChangeEvent
+
+	for name, n := range next {
+		p, ok := prev[name]
+		switch {
+		case !ok:
+			events = append(events, ChangeEvent{Created, collection, name, n.modTime})
+		case p != n:
+			events = append(events, ChangeEvent{Modified, collection, name, n.modTime})
+		}
+	}
+	for name := range prev {
+		if _, ok := next[name]; !ok {
+			events = append(events, ChangeEvent{Type: Deleted, Collection: collection, Resource: name})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Resource < events[j].Resource })
+	return events
+}
@@ -0,0 +1,33 @@
+package jsondb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LockCollection takes the collection mutex, and the collection's file lock
+// with Options.FileLocking, and returns a func that releases them. Until
+// then every Write and Delete on the collection blocks, which gives a
+// migration exclusive access for its whole duration. Calling the driver's
+// own Write or Delete on the collection from the holder deadlocks;
+// migrations have to work on the files directly or through another
+// collection.
+func (d *Driver) LockCollection(collection string) (_ func(), err error) {
+	defer d.done(OpLockCollection, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to lock", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() { once.Do(unlock) }, nil
+}
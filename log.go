@@ -0,0 +1,134 @@
+package jsondb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jcelliott/lumber"
+)
+
+// LevelTrace is the slog level of the operations logged for Options.Trace
+// and TraceOperations, below slog.LevelDebug
+const LevelTrace = slog.LevelDebug - 4
+
+// newLogger returns the logger of a driver: Options.Slog, else a shim over
+// Options.Logger, else one logging to the console from INFO up
+func newLogger(opts Options) *slog.Logger {
+	if opts.Slog != nil {
+		return opts.Slog
+	}
+	if opts.Logger == nil {
+		opts.Logger = lumber.NewConsoleLogger(lumber.INFO)
+	}
+	return slog.New(&loggerHandler{log: opts.Logger})
+}
+
+// loggerHandler is the slog.Handler writing to a Logger. A record is logged
+// as its message followed by its attributes as key=value, through the method
+// of its level; warnings go to Error unless the Logger also has a Warn
+// method, as lumber's loggers do.
+type loggerHandler struct {
+	log    Logger
+	attrs  string // preformatted by WithAttrs, each with a leading space
+	prefix string // the WithGroup groups, each followed by a dot
+}
+
+func (h *loggerHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *loggerHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.prefix, a)
+		return true
+	})
+	line := b.String()
+
+	switch {
+	case r.Level >= slog.LevelError:
+		h.log.Error("%s\n", line)
+	case r.Level >= slog.LevelWarn:
+		if w, ok := h.log.(interface{ Warn(string, ...interface{}) }); ok {
+			w.Warn("%s\n", line)
+		} else {
+			h.log.Error("%s\n", line)
+		}
+	case r.Level >= slog.LevelInfo:
+		h.log.Info("%s\n", line)
+	case r.Level >= slog.LevelDebug:
+		h.log.Debug("%s\n", line)
+	default:
+		h.log.Trace("%s\n", line)
+	}
+	return nil
+}
+
+func (h *loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		writeAttr(&b, h.prefix, a)
+	}
+	return &loggerHandler{log: h.log, attrs: b.String(), prefix: h.prefix}
+}
+
+func (h *loggerHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &loggerHandler{log: h.log, attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// writeAttr appends " key=value" to b, quoting values with spaces
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, prefix, ga)
+		}
+		return
+	}
+
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = fmt.Sprintf("%q", v)
+	}
+	b.WriteString(" " + prefix + a.Key + "=" + v)
+}
+
+// trace logs a completed operation at LevelTrace when Options.Trace or
+// TraceOperations selects it
+func (d *Driver) trace(op Op, collection, resource string, elapsed time.Duration, err error) {
+	if !d.traceAll && !d.traced[op] {
+		return
+	}
+	ctx := context.Background()
+	if !d.log.Enabled(ctx, LevelTrace) {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("op", string(op))}
+	if collection != "" {
+		attrs = append(attrs, slog.String("collection", collection))
+	}
+	if resource != "" {
+		attrs = append(attrs, slog.String("resource", resource))
+	}
+	attrs = append(attrs, slog.Duration("duration", elapsed))
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	d.log.LogAttrs(ctx, LevelTrace, "Operation done", attrs...)
+}
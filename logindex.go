@@ -0,0 +1,255 @@
+package jsondb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logIndexes caches the resource to offset index of append-log collections.
+// Each index is mirrored in <collection>.idx, an append-only file of
+// "<offset> <resource>\n" lines where an offset of -1 records a deletion.
+type logIndexes struct {
+	mutex   sync.Mutex
+	indexes map[string]map[string]int64
+}
+
+func (d *Driver) idxPath(collection string) string {
+	return d.logPath(collection) + ".idx"
+}
+
+// SeekRecord returns the byte offset in an append-log collection of the
+// latest entry of resource, for use with ReadAt
+func (d *Driver) SeekRecord(collection, resource string) (offset int64, err error) {
+	defer d.done(OpSeekRecord, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to seek record", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return 0, fmt.Errorf("%w - unable to seek record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return 0, err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return 0, err
+	}
+	if d.storage != StorageAppendLog {
+		return 0, fmt.Errorf("SeekRecord requires the %s storage, driver uses %s", StorageAppendLog, d.storage)
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	index, err := d.loadLogIndex(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, ok := index[resource]
+	if !ok {
+		return 0, fmt.Errorf("unable to find record named %v in %v: %w", resource, collection, os.ErrNotExist)
+	}
+	return offset, nil
+}
+
+// ReadAt decodes into v the append-log entry starting at offset, without
+// scanning the log. The offset must be the latest entry of a record, as
+// returned by SeekRecord; any other offset is not found.
+func (d *Driver) ReadAt(collection string, offset int64, v interface{}) (err error) {
+	defer d.done(OpReadAt, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to read record", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if d.storage != StorageAppendLog {
+		return fmt.Errorf("ReadAt requires the %s storage, driver uses %s", StorageAppendLog, d.storage)
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	index, err := d.loadLogIndex(collection)
+	if err != nil {
+		return err
+	}
+	live := false
+	for _, off := range index {
+		if off == offset {
+			live = true
+			break
+		}
+	}
+	if !live {
+		return fmt.Errorf("unable to find a record at offset %d of %v: %w", offset, collection, os.ErrNotExist)
+	}
+
+	f, err := d.openFile(d.logPath(collection))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	e, _, err := readLogEntry(bufio.NewReader(f), fi.Size()-offset)
+	if err != nil {
+		return fmt.Errorf("no log entry at offset %d of %v: %w", offset, collection, err)
+	}
+
+	return d.decode(e.Doc, v)
+}
+
+// loadLogIndex returns the cached index of a collection, reading it from the
+// .idx file or rebuilding it from the log if needed. The caller must hold
+// the collection mutex.
+func (d *Driver) loadLogIndex(collection string) (map[string]int64, error) {
+	x := d.logIndexes
+	x.mutex.Lock()
+	index, ok := x.indexes[collection]
+	x.mutex.Unlock()
+	if ok {
+		return index, nil
+	}
+
+	index, err := d.readIdxFile(d.idxPath(collection))
+	if os.IsNotExist(err) {
+		if index, err = d.rebuildLogIndex(collection); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	x.mutex.Lock()
+	x.indexes[collection] = index
+	x.mutex.Unlock()
+	return index, nil
+}
+
+func (d *Driver) readIdxFile(path string) (map[string]int64, error) {
+	b, err := d.backend.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int64)
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		off, key, ok := strings.Cut(string(line), " ")
+		if !ok {
+			continue // blank or torn last line
+		}
+		offset, err := strconv.ParseInt(off, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt index %v: %w", path, err)
+		}
+		if offset < 0 {
+			delete(index, key)
+		} else {
+			index[key] = offset
+		}
+	}
+	return index, nil
+}
+
+// rebuildLogIndex scans the log and rewrites the .idx file from it
+func (d *Driver) rebuildLogIndex(collection string) (map[string]int64, error) {
+	index := make(map[string]int64)
+	err := d.scanLog(collection, func(off int64, e logEntry) error {
+		if e.Deleted {
+			delete(index, e.Key)
+		} else {
+			index[e.Key] = off
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if d.readOnly {
+		return index, nil // kept in memory only
+	}
+	return index, d.writeIdxFile(collection, index)
+}
+
+func (d *Driver) writeIdxFile(collection string, index map[string]int64) error {
+	var b []byte
+	for key, offset := range index {
+		b = append(b, strconv.FormatInt(offset, 10)+" "+key+"\n"...)
+	}
+
+	path := d.idxPath(collection)
+	return d.writeFile(path+d.tmpSuffix, path, b)
+}
+
+// indexLogEntry records an appended entry in the collection index. The index
+// is derived from the log, so on failure it is dropped to be rebuilt later
+// rather than failing the write. The caller must hold the collection mutex.
+func (d *Driver) indexLogEntry(collection, resource string, offset int64) {
+	x := d.logIndexes
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	path := d.idxPath(collection)
+	f, err := d.backend.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if os.IsNotExist(err) {
+		delete(x.indexes, collection) // not built yet, rebuilt on first seek
+		return
+	}
+	if err == nil {
+		_, err = f.Write([]byte(strconv.FormatInt(offset, 10) + " " + resource + "\n"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		d.log.Warn("Unable to update log index, dropping it", "collection", collection, "error", err)
+		delete(x.indexes, collection)
+		d.backend.Remove(path)
+		return
+	}
+
+	if index, ok := x.indexes[collection]; ok {
+		if offset < 0 {
+			delete(index, resource)
+		} else {
+			index[resource] = offset
+		}
+	}
+}
+
+// dropLogIndex forgets the index of a collection whose log is removed or
+// rewritten
+func (d *Driver) dropLogIndex(collection string) error {
+	x := d.logIndexes
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	delete(x.indexes, collection)
+	if err := d.backend.Remove(d.idxPath(collection)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
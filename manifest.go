@@ -0,0 +1,181 @@
+package jsondb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrManifestSignature is returned by VerifyManifest when the manifest
+// doesn't carry a valid signature for Options.ManifestKey
+var ErrManifestSignature = errors.New("manifest signature mismatch")
+
+// IntegrityError describes a record that doesn't match the manifest
+type IntegrityError struct {
+	Collection string
+	Resource   string
+	Problem    string // "modified", "missing" or "unexpected"
+	Expected   string // sha256 from the manifest; empty for unexpected records
+	Actual     string // sha256 on disk; empty for missing records
+}
+
+func (e IntegrityError) Error() string {
+	return fmt.Sprintf("%s record %v (expected sha256 %q, found %q)",
+		e.Problem, filepath.Join(e.Collection, e.Resource), e.Expected, e.Actual)
+}
+
+// manifest maps collection -> resource -> hex sha256 of the record file
+type manifest map[string]map[string]string
+
+// WriteManifest hashes every record file of every collection and writes the
+// hashes to destPath as JSON, {collection: {resource: sha256hex}} with sorted
+// keys. The manifest is signed with HMAC-SHA256 using Options.ManifestKey and
+// the hex signature is written next to it, in destPath + ".sig".
+func (d *Driver) WriteManifest(destPath string) (err error) {
+	defer d.done(OpWriteManifest, "", "", time.Now(), &err)
+
+	if err := d.requireManifestKey(); err != nil {
+		return err
+	}
+
+	m, err := d.buildManifest()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	b = append(b, byte('\n'))
+
+	if err := d.writeFile(destPath+d.tmpSuffix, destPath, b); err != nil {
+		return err
+	}
+
+	sig := []byte(hex.EncodeToString(d.signManifest(b)) + "\n")
+	return d.writeFile(destPath+".sig"+d.tmpSuffix, destPath+".sig", sig)
+}
+
+// VerifyManifest checks the signature of a manifest written by WriteManifest,
+// then recomputes every hash and reports the records that were modified,
+// are missing, or aren't listed in the manifest
+func (d *Driver) VerifyManifest(manifestPath string) (problems []IntegrityError, err error) {
+	defer d.done(OpVerifyManifest, "", "", time.Now(), &err)
+
+	if err := d.requireManifestKey(); err != nil {
+		return nil, err
+	}
+
+	b, err := d.backend.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	sigHex, err := d.backend.ReadFile(manifestPath + ".sig")
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := hex.DecodeString(string(trimNewline(sigHex)))
+	if err != nil || !hmac.Equal(sig, d.signManifest(b)) {
+		return nil, ErrManifestSignature
+	}
+
+	var want manifest
+	if err := json.Unmarshal(b, &want); err != nil {
+		return nil, err
+	}
+
+	got, err := d.buildManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, collection := range sortedKeys(want) {
+		for _, resource := range sortedKeys(want[collection]) {
+			expected := want[collection][resource]
+			actual, ok := got[collection][resource]
+			switch {
+			case !ok:
+				problems = append(problems, IntegrityError{collection, resource, "missing", expected, ""})
+			case actual != expected:
+				problems = append(problems, IntegrityError{collection, resource, "modified", expected, actual})
+			}
+		}
+	}
+	for _, collection := range sortedKeys(got) {
+		for _, resource := range sortedKeys(got[collection]) {
+			if _, ok := want[collection][resource]; !ok {
+				problems = append(problems, IntegrityError{collection, resource, "unexpected", "", got[collection][resource]})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+func (d *Driver) requireManifestKey() error {
+	if len(d.manifestKey) == 0 {
+		return fmt.Errorf("missing manifest key - set Options.ManifestKey to sign manifests")
+	}
+	return d.requireFiles("manifests")
+}
+
+func (d *Driver) buildManifest() (manifest, error) {
+	collections, err := d.collectionNames()
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(manifest)
+	for _, collection := range collections {
+		names, err := d.recordNames(collection)
+		if err != nil {
+			return nil, err
+		}
+
+		hashes := make(map[string]string, len(names))
+		for _, name := range names {
+			b, err := d.backend.ReadFile(filepath.Join(d.dir, collection, name+d.ext))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(b)
+			hashes[name] = hex.EncodeToString(sum[:])
+		}
+		m[collection] = hashes
+	}
+	return m, nil
+}
+
+func (d *Driver) signManifest(b []byte) []byte {
+	mac := hmac.New(sha256.New, d.manifestKey)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func trimNewline(b []byte) []byte {
+	for len(b) > 0 && (b[len(b)-1] == '\n' || b[len(b)-1] == '\r') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
@@ -0,0 +1,426 @@
+package jsondb
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errIsDir    = errors.New("is a directory")
+	errNotDir   = errors.New("not a directory")
+	errNotEmpty = errors.New("directory not empty")
+)
+
+// Memory returns a new, empty Storage held in memory, for tests and
+// throwaway databases; see also the jsondbtest package. Every call returns a
+// separate file system, which is gone once its driver is. It follows the
+// semantics of Disk, such as atomic renames and open files outliving their
+// removal, but has no hard links, so Backup and CopyCollection copy.
+func Memory() Storage {
+	return &memoryStorage{root: &memoryNode{children: make(map[string]*memoryNode)}}
+}
+
+// memoryStorage is a tree of nodes under a single mutex, which also guards
+// the contents of every node
+type memoryStorage struct {
+	mutex sync.Mutex
+	root  *memoryNode
+}
+
+// memoryNode is a directory when children is non-nil, else a file
+type memoryNode struct {
+	name     string
+	data     []byte
+	modTime  time.Time
+	children map[string]*memoryNode
+}
+
+func (n *memoryNode) info() fs.FileInfo {
+	return memoryInfo{n.name, int64(len(n.data)), n.modTime, n.children != nil}
+}
+
+type memoryInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i memoryInfo) Name() string       { return i.name }
+func (i memoryInfo) Size() int64        { return i.size }
+func (i memoryInfo) ModTime() time.Time { return i.modTime }
+func (i memoryInfo) IsDir() bool        { return i.dir }
+func (i memoryInfo) Sys() interface{}   { return nil }
+
+func (i memoryInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// memoryPath returns the path segments of name; the root is none
+func memoryPath(name string) []string {
+	name = filepath.ToSlash(filepath.Clean(name))
+	name = strings.Trim(name, "/")
+	if name == "" || name == "." {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// lookup returns the node at name, or nil. The caller must hold the mutex.
+func (s *memoryStorage) lookup(name string) *memoryNode {
+	n := s.root
+	for _, seg := range memoryPath(name) {
+		if n.children == nil {
+			return nil
+		}
+		if n = n.children[seg]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// parent returns the directory name would be in and its base name. The
+// caller must hold the mutex.
+func (s *memoryStorage) parent(op, name string) (*memoryNode, string, error) {
+	segs := memoryPath(name)
+	if len(segs) == 0 {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	dir := s.lookup(strings.Join(segs[:len(segs)-1], "/"))
+	if dir == nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if dir.children == nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return dir, segs[len(segs)-1], nil
+}
+
+func (s *memoryStorage) Stat(name string) (fs.FileInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := s.lookup(name)
+	if n == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return n.info(), nil
+}
+
+func (s *memoryStorage) ReadDir(name string) ([]fs.DirEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := s.lookup(name)
+	if n == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.children == nil {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: errNotDir}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, child := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child.info()))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *memoryStorage) ReadFile(name string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := s.lookup(name)
+	if n == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.children != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	return append([]byte{}, n.data...), nil
+}
+
+func (s *memoryStorage) WriteFile(name string, b []byte, perm fs.FileMode) error {
+	f, err := s.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *memoryStorage) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, base, err := s.parent("open", name)
+	if err != nil {
+		return nil, err
+	}
+	n := dir.children[base]
+	switch {
+	case n == nil && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case n == nil:
+		n = &memoryNode{name: base, modTime: time.Now()}
+		dir.children[base] = n
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case n.children != nil && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+	case flag&os.O_TRUNC != 0:
+		n.data, n.modTime = nil, time.Now()
+	}
+	return &memoryFile{storage: s, node: n, name: name, flag: flag}, nil
+}
+
+func (s *memoryStorage) Rename(oldpath, newpath string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fromDir, fromBase, err := s.parent("rename", oldpath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.Unwrap(err)}
+	}
+	n := fromDir.children[fromBase]
+	if n == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	toDir, toBase, err := s.parent("rename", newpath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.Unwrap(err)}
+	}
+	if old := toDir.children[toBase]; old != nil && old != n {
+		switch {
+		case old.children != nil && n.children == nil:
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errIsDir}
+		case old.children == nil && n.children != nil:
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errNotDir}
+		case len(old.children) > 0:
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrExist}
+		}
+	}
+
+	delete(fromDir.children, fromBase)
+	n.name = toBase
+	toDir.children[toBase] = n
+	return nil
+}
+
+func (s *memoryStorage) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir, base, err := s.parent("remove", name)
+	if err != nil {
+		return err
+	}
+	n := dir.children[base]
+	if n == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(n.children) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(dir.children, base)
+	return nil
+}
+
+func (s *memoryStorage) RemoveAll(path string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(memoryPath(path)) == 0 {
+		s.root.children = make(map[string]*memoryNode)
+		return nil
+	}
+	dir, base, err := s.parent("unlinkat", path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	delete(dir.children, base)
+	return nil
+}
+
+func (s *memoryStorage) MkdirAll(path string, perm fs.FileMode) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := s.root
+	for _, seg := range memoryPath(path) {
+		child := n.children[seg]
+		if child == nil {
+			child = &memoryNode{name: seg, modTime: time.Now(), children: make(map[string]*memoryNode)}
+			n.children[seg] = child
+		}
+		if child.children == nil {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: errNotDir}
+		}
+		n = child
+	}
+	return nil
+}
+
+// memoryFile is an open file of a memoryStorage
+type memoryFile struct {
+	storage *memoryStorage
+	node    *memoryNode
+	name    string
+	flag    int
+	offset  int64
+	closed  bool
+}
+
+// check fails operations on a closed file, or writes to one opened read-only
+func (f *memoryFile) check(op string, write bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0 || !write && f.flag&os.O_WRONLY != 0 {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	if f.node.children != nil && op != "stat" && op != "close" {
+		return &fs.PathError{Op: op, Path: f.name, Err: errIsDir}
+	}
+	return nil
+}
+
+func (f *memoryFile) Read(b []byte) (int, error) {
+	f.storage.mutex.Lock()
+	defer f.storage.mutex.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	n, err := f.readAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memoryFile) ReadAt(b []byte, off int64) (int, error) {
+	f.storage.mutex.Lock()
+	defer f.storage.mutex.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	n, err := f.readAt(b, off)
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *memoryFile) readAt(b []byte, off int64) (int, error) {
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	return copy(b, f.node.data[off:]), nil
+}
+
+func (f *memoryFile) Write(b []byte) (int, error) {
+	f.storage.mutex.Lock()
+	defer f.storage.mutex.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	n := f.writeAt(b, f.offset)
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memoryFile) WriteAt(b []byte, off int64) (int, error) {
+	f.storage.mutex.Lock()
+	defer f.storage.mutex.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.writeAt(b, off), nil
+}
+
+func (f *memoryFile) writeAt(b []byte, off int64) int {
+	if end := off + int64(len(b)); end > int64(len(f.node.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	f.node.modTime = time.Now()
+	return copy(f.node.data[off:], b)
+}
+
+func (f *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	f.storage.mutex.Lock()
+	defer f.storage.mutex.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memoryFile) Stat() (fs.FileInfo, error) {
+	f.storage.mutex.Lock()
+	defer f.storage.mutex.Unlock()
+
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.node.info(), nil
+}
+
+func (f *memoryFile) Sync() error {
+	f.storage.mutex.Lock()
+	defer f.storage.mutex.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memoryFile) Close() error {
+	f.storage.mutex.Lock()
+	defer f.storage.mutex.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,114 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// metaField is the default of Options.MetaField, the reserved member of a
+// JSON object record holding its Meta
+const metaField = "_meta"
+
+// Meta is the metadata the driver keeps in a record with Options.Metadata
+type Meta struct {
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Revision  uint64    `json:"revision"` // 1 for the first write, incremented by every other
+
+	// SchemaVersion is the version of the collection's migrations the record
+	// is in, see Migrate; it's kept without Options.Metadata as well
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+}
+
+// recordMeta returns the Meta stored in an encoded record, if any
+func (d *Driver) recordMeta(b []byte) (Meta, bool) {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(b, &members) != nil {
+		return Meta{}, false
+	}
+	var meta *Meta
+	if json.Unmarshal(members[d.metaField], &meta) != nil || meta == nil {
+		return Meta{}, false
+	}
+	return *meta, true
+}
+
+// stampMeta returns b, a JSON record about to replace the one stored as
+// resource, with its meta member set: the creation time carried over from
+// the stored record, the update time set to now and the revision
+// incremented. Records that aren't JSON objects are returned unchanged. The
+// caller must hold the collection lock.
+func (d *Driver) stampMeta(collection, resource string, b []byte) ([]byte, error) {
+	if !d.metadata || !isObject(b) {
+		return b, nil
+	}
+
+	now := time.Now().UTC()
+	meta := Meta{CreatedAt: now, UpdatedAt: now, Revision: 1}
+	if old, err := d.readRaw(collection, resource); err == nil {
+		if prev, ok := d.recordMeta(old); ok {
+			meta.CreatedAt, meta.Revision = prev.CreatedAt, prev.Revision+1
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if cur, ok := d.recordMeta(b); ok {
+		meta.SchemaVersion = cur.SchemaVersion
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, fmt.Errorf("unable to add metadata to %v: %w", filepath.Join(collection, resource), err)
+	}
+	m, err := json.MarshalIndent(meta, "\t", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return d.setMeta(b, members, m)
+}
+
+// setMeta returns b, a JSON object record decoded into members, with its
+// meta member set to m
+func (d *Driver) setMeta(b []byte, members map[string]json.RawMessage, m []byte) ([]byte, error) {
+	if _, ok := members[d.metaField]; ok {
+		// replace the caller's copy; member order is lost
+		members[d.metaField] = m
+		return d.encode(members)
+	}
+
+	// splice the member in first, keeping the record as encoded
+	trimmed := bytes.TrimLeft(b, " \t\r\n")
+	rest := bytes.TrimLeft(trimmed[1:], " \t\r\n")
+	name, _ := json.Marshal(d.metaField)
+	out := append(append([]byte("{\n\t"), name...), ": "...)
+	out = append(out, m...)
+	if len(rest) > 0 && rest[0] != '}' {
+		out = append(out, ',')
+		return append(out, trimmed[1:]...), nil
+	}
+	return append(append(out, "\n}"...), rest[1:]...), nil
+}
+
+// ReadWithMeta decodes a record into v like Read and returns the metadata
+// kept with Options.Metadata. Records written without it have a zero Meta.
+func (d *Driver) ReadWithMeta(collection, resource string, v interface{}) (meta Meta, err error) {
+	defer d.done(OpReadWithMeta, collection, resource, time.Now(), &err)
+
+	if err := d.requireJSON("ReadWithMeta"); err != nil {
+		return Meta{}, err
+	}
+	var raw json.RawMessage
+	if err := d.Read(collection, resource, &raw); err != nil {
+		return Meta{}, err
+	}
+	if err := d.decode(raw, v); err != nil {
+		return Meta{}, err
+	}
+	meta, _ = d.recordMeta(raw)
+	return meta, nil
+}
@@ -0,0 +1,60 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	for _, field := range []string{"", "$db"} {
+		t.Run("MetaField "+field, func(t *testing.T) {
+			d, dir := newTestDriver(t, &Options{Metadata: true, MetaField: field})
+			want := field
+			if want == "" {
+				want = metaField
+			}
+
+			doc := map[string]interface{}{"Name": "Ada"}
+			if field != "" {
+				doc["_meta"] = "note" // the caller's own, free with another MetaField
+			}
+			if err := d.Write("users", "ada", doc); err != nil {
+				t.Fatal(err)
+			}
+			first, err := d.ReadWithMeta("users", "ada", &testUser{})
+			if err != nil || first.Revision != 1 || first.CreatedAt.IsZero() {
+				t.Fatalf("ReadWithMeta() after the first write = %+v, %v", first, err)
+			}
+			if err := d.WriteIfRevision("users", "ada", doc, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.WriteIfRevision("users", "ada", doc, 1); !errors.Is(err, ErrConflict) {
+				t.Errorf("WriteIfRevision() of a stale revision = %v, want ErrConflict", err)
+			}
+
+			var u map[string]interface{}
+			meta, err := d.ReadWithMeta("users", "ada", &u)
+			if err != nil || meta.Revision != 2 || !meta.CreatedAt.Equal(first.CreatedAt) || meta.UpdatedAt.Before(first.UpdatedAt) {
+				t.Errorf("ReadWithMeta() after the second write = %+v, %v, first %+v", meta, err, first)
+			}
+			if field != "" && u["_meta"] != "note" {
+				t.Errorf("record's own _meta field = %v, want it kept", u["_meta"])
+			}
+
+			b, err := os.ReadFile(filepath.Join(dir, "users", "ada.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var members map[string]json.RawMessage
+			if err := json.Unmarshal(b, &members); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := members[want]; !ok {
+				t.Errorf("stored record %s has no %v member", b, want)
+			}
+		})
+	}
+}
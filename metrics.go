@@ -0,0 +1,238 @@
+package jsondb
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Metrics receives the driver's instrumentation, set as Options.Metrics.
+// Its methods are called synchronously by the goroutine doing the work, so
+// they must be safe for concurrent use and must not block. Collector
+// implements it with expvar and Prometheus exports.
+type Metrics interface {
+	// ObserveOperation is called when an operation completes, with what
+	// Observe's funcs get
+	ObserveOperation(op Op, duration time.Duration, err error)
+
+	// ObserveLockWait is called when a collection lock is taken, with how
+	// long it took, file lock included
+	ObserveLockWait(collection string, wait time.Duration)
+
+	// ObserveCache is called by every read looked up in the
+	// Options.CacheSize cache
+	ObserveCache(hit bool)
+
+	// ObserveVerification is called for every read-after-write check of
+	// CollectionOptions.VerifyWrites, and with spotCheck set for every write
+	// the Options.VerifyWrites verifier re-read, as counted in Stats
+	ObserveVerification(spotCheck, ok bool)
+}
+
+// latencyBuckets are the upper bounds of the Collector histograms, in
+// seconds
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts durations in latencyBuckets
+type histogram struct {
+	buckets []uint64 // per bucket, not cumulative; the last is +Inf
+	count   uint64
+	sum     float64 // seconds
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(latencyBuckets)+1)
+	}
+	s := d.Seconds()
+	h.buckets[sort.SearchFloat64s(latencyBuckets, s)]++
+	h.count++
+	h.sum += s
+}
+
+type operationMetrics struct {
+	errors   uint64
+	duration histogram
+}
+
+// Collector is a Metrics keeping per-operation counts, error counts and
+// latency histograms, lock wait times, cache hits and verification results,
+// for Expvar and WritePrometheus to export. The zero value is ready to use, and one
+// Collector can serve several drivers, adding up their numbers.
+type Collector struct {
+	mutex       sync.Mutex
+	operations  map[Op]*operationMetrics
+	lockWaits   histogram
+	cacheHits   uint64
+	cacheMisses uint64
+
+	verifications        uint64
+	verificationFailures uint64
+	spotChecks           uint64
+	spotCheckFailures    uint64
+}
+
+// NewCollector returns an empty Collector
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+func (c *Collector) ObserveOperation(op Op, duration time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.operations == nil {
+		c.operations = make(map[Op]*operationMetrics)
+	}
+	m, ok := c.operations[op]
+	if !ok {
+		m = &operationMetrics{}
+		c.operations[op] = m
+	}
+	m.duration.observe(duration)
+	if err != nil {
+		m.errors++
+	}
+}
+
+func (c *Collector) ObserveLockWait(collection string, wait time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lockWaits.observe(wait)
+}
+
+func (c *Collector) ObserveCache(hit bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if hit {
+		c.cacheHits++
+	} else {
+		c.cacheMisses++
+	}
+}
+
+func (c *Collector) ObserveVerification(spotCheck, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if spotCheck {
+		c.spotChecks++
+		if !ok {
+			c.spotCheckFailures++
+		}
+	} else {
+		c.verifications++
+		if !ok {
+			c.verificationFailures++
+		}
+	}
+}
+
+// Expvar returns the collected metrics as an expvar.Var, to publish with
+// expvar.Publish("jsondb", c.Expvar()). Its JSON holds, per operation, the
+// count, the errors and the total and mean seconds, then the lock waits, the
+// cache hits and misses and the verifications and spot checks with their
+// failures.
+func (c *Collector) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		operations := make(map[string]interface{}, len(c.operations))
+		for op, m := range c.operations {
+			operations[string(op)] = map[string]interface{}{
+				"count":       m.duration.count,
+				"errors":      m.errors,
+				"seconds":     m.duration.sum,
+				"meanSeconds": m.duration.sum / float64(m.duration.count),
+			}
+		}
+		return map[string]interface{}{
+			"operations":      operations,
+			"lockWaits":       c.lockWaits.count,
+			"lockWaitSeconds": c.lockWaits.sum,
+			"cacheHits":       c.cacheHits,
+			"cacheMisses":     c.cacheMisses,
+
+			"verifications":        c.verifications,
+			"verificationFailures": c.verificationFailures,
+			"spotChecks":           c.spotChecks,
+			"spotCheckFailures":    c.spotCheckFailures,
+		}
+	})
+}
+
+// WritePrometheus writes the collected metrics in the Prometheus text
+// exposition format: jsondb_operations_total and
+// jsondb_operation_errors_total counters and the
+// jsondb_operation_duration_seconds histogram, labeled by op, the
+// jsondb_lock_wait_seconds histogram, the jsondb_cache_hits_total and
+// jsondb_cache_misses_total counters, and the jsondb_verifications_total,
+// jsondb_verification_failures_total, jsondb_spot_checks_total and
+// jsondb_spot_check_failures_total counters.
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ops := make([]string, 0, len(c.operations))
+	for op := range c.operations {
+		ops = append(ops, string(op))
+	}
+	sort.Strings(ops)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# HELP jsondb_operations_total Driver operations completed.\n# TYPE jsondb_operations_total counter\n")
+	for _, op := range ops {
+		fmt.Fprintf(bw, "jsondb_operations_total{op=%q} %d\n", op, c.operations[Op(op)].duration.count)
+	}
+	fmt.Fprintf(bw, "# HELP jsondb_operation_errors_total Driver operations that returned an error.\n# TYPE jsondb_operation_errors_total counter\n")
+	for _, op := range ops {
+		fmt.Fprintf(bw, "jsondb_operation_errors_total{op=%q} %d\n", op, c.operations[Op(op)].errors)
+	}
+	fmt.Fprintf(bw, "# HELP jsondb_operation_duration_seconds Duration of driver operations.\n# TYPE jsondb_operation_duration_seconds histogram\n")
+	for _, op := range ops {
+		writeHistogram(bw, "jsondb_operation_duration_seconds", fmt.Sprintf("op=%q,", op), &c.operations[Op(op)].duration)
+	}
+	fmt.Fprintf(bw, "# HELP jsondb_lock_wait_seconds Time spent waiting for collection locks.\n# TYPE jsondb_lock_wait_seconds histogram\n")
+	writeHistogram(bw, "jsondb_lock_wait_seconds", "", &c.lockWaits)
+	fmt.Fprintf(bw, "# HELP jsondb_cache_hits_total Reads answered from the record cache.\n# TYPE jsondb_cache_hits_total counter\njsondb_cache_hits_total %d\n", c.cacheHits)
+	fmt.Fprintf(bw, "# HELP jsondb_cache_misses_total Reads the record cache didn't hold.\n# TYPE jsondb_cache_misses_total counter\njsondb_cache_misses_total %d\n", c.cacheMisses)
+	fmt.Fprintf(bw, "# HELP jsondb_verifications_total Read-after-write checks of VerifyWrites.\n# TYPE jsondb_verifications_total counter\njsondb_verifications_total %d\n", c.verifications)
+	fmt.Fprintf(bw, "# HELP jsondb_verification_failures_total Read-after-write checks that didn't match, retried ones included.\n# TYPE jsondb_verification_failures_total counter\njsondb_verification_failures_total %d\n", c.verificationFailures)
+	fmt.Fprintf(bw, "# HELP jsondb_spot_checks_total Sampled writes re-read by the background verifier.\n# TYPE jsondb_spot_checks_total counter\njsondb_spot_checks_total %d\n", c.spotChecks)
+	fmt.Fprintf(bw, "# HELP jsondb_spot_check_failures_total Sampled writes that didn't read back as written.\n# TYPE jsondb_spot_check_failures_total counter\njsondb_spot_check_failures_total %d\n", c.spotCheckFailures)
+	return bw.Flush()
+}
+
+// writeHistogram writes h as Prometheus buckets; labels is empty or ends
+// in a comma
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	var cumulative uint64
+	for i, le := range latencyBuckets {
+		if h.buckets != nil {
+			cumulative += h.buckets[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	if labels != "" {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64), name, labels, h.count)
+}
+
+// PrometheusHandler returns an http.Handler serving WritePrometheus, to
+// mount as the /metrics endpoint a Prometheus server scrapes
+func (c *Collector) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := c.WritePrometheus(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCollectorVerifications(t *testing.T) {
+	c := NewCollector()
+	d, _ := newTestDriver(t, &Options{Metrics: c, Collections: map[string]CollectionOptions{"users": {VerifyWrites: true}}})
+	for _, name := range []string{"ada", "bob"} {
+		if err := d.Write("users", name, testUser{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.ObserveVerification(true, true)
+	c.ObserveVerification(true, false)
+	c.ObserveVerification(false, false)
+
+	if s := d.Stats(); s.Verifications != 2 || s.VerificationFailures != 0 {
+		t.Fatalf("Stats() = %+v, want 2 verifications without failures", s)
+	}
+
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(c.Expvar().String()), &vars); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]float64{"verifications": 3, "verificationFailures": 1, "spotChecks": 2, "spotCheckFailures": 1} {
+		if vars[name] != want {
+			t.Errorf("expvar %v = %v, want %v", name, vars[name], want)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := c.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"jsondb_verifications_total 3",
+		"jsondb_verification_failures_total 1",
+		"jsondb_spot_checks_total 2",
+		"jsondb_spot_check_failures_total 1",
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("Prometheus output lacks %q:\n%s", line, b.String())
+		}
+	}
+}
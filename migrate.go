@@ -0,0 +1,297 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// migrationsFile records the schema version MigrateAll brought every record
+// of a collection to, so reads of a migrated collection skip the check
+const migrationsFile = ".migrations"
+
+// MigrationFunc changes a decoded record from the shape of the previous
+// version to the next in place. The record's _meta member, or
+// Options.MetaField, isn't passed.
+type MigrationFunc func(doc map[string]interface{}) error
+
+type migrations struct {
+	mutex   sync.Mutex
+	steps   map[string][]migration // by collection, in version order
+	applied map[string]int         // cached migrationsFile versions, by collection
+}
+
+type migration struct {
+	version int
+	fn      MigrationFunc
+}
+
+func (d *Driver) migrationsPath(collection string) string {
+	return filepath.Join(d.dir, collection, migrationsFile)
+}
+
+// Migrate registers fn as the migration of the records of collection to
+// version, which must be greater than the versions already registered for
+// it; they are typically all registered right after New. Every record a
+// write stores is stamped with the latest version in its _meta member, and
+// reads run the migrations a record's version is missing on the decoded copy,
+// in version order. Records written before any were registered are at version
+// 0, and records that aren't JSON objects are never migrated. The stored files
+// stay as they are until MigrateAll rewrites them, so indexes and unique
+// constraints see the old shapes until then.
+func (d *Driver) Migrate(collection string, version int, fn MigrationFunc) (err error) {
+	defer d.done(OpMigrate, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to register migration", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.requireJSON("Migrate"); err != nil {
+		return err
+	}
+	if err := d.requireFiles("Migrate"); err != nil {
+		return err
+	}
+	if version < 1 {
+		return fmt.Errorf("unable to register migration of %v - version must be at least 1, got %d", collection, version)
+	}
+	if fn == nil {
+		return fmt.Errorf("unable to register migration of %v to version %d - no func", collection, version)
+	}
+
+	m := d.migrations
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	steps := m.steps[collection]
+	if len(steps) > 0 && steps[len(steps)-1].version >= version {
+		return fmt.Errorf("unable to register migration of %v to version %d - version %d is registered already", collection, version, steps[len(steps)-1].version)
+	}
+	m.steps[collection] = append(steps, migration{version, fn})
+	return nil
+}
+
+// MigrateAll rewrites every record of the collections with migrations that
+// is behind the latest version, then records the version in the collection,
+// and returns how many records it rewrote. Each collection is locked while
+// it's migrated; a migration failing stops MigrateAll with the records
+// before it rewritten.
+func (d *Driver) MigrateAll() (n int, err error) {
+	defer d.done(OpMigrateAll, "", "", time.Now(), &err)
+
+	m := d.migrations
+	m.mutex.Lock()
+	latest := make(map[string]int, len(m.steps))
+	for collection, steps := range m.steps {
+		latest[collection] = steps[len(steps)-1].version
+	}
+	m.mutex.Unlock()
+
+	collections := make([]string, 0, len(latest))
+	for collection := range latest {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		migrated, err := d.migrateCollection(collection, latest[collection])
+		n += migrated
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (d *Driver) migrateCollection(collection string, version int) (int, error) {
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	names, err := d.recordNames(collection)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, name := range names {
+		if d.expired(collection, name) {
+			continue
+		}
+		b, err := d.readFile(filepath.Join(d.dir, collection, name+d.ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		b, changed, err := d.upgrade(collection, name, b)
+		if err != nil {
+			return n, err
+		}
+		if !changed {
+			continue
+		}
+		if err := d.writeRecord(collection, name, b); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	b, err := json.Marshal(struct {
+		Version int `json:"version"`
+	}{version})
+	if err != nil {
+		return n, err
+	}
+	path := d.migrationsPath(collection)
+	if err := d.writeFile(path+d.tmpSuffix, path, b); err != nil {
+		return n, err
+	}
+
+	m := d.migrations
+	m.mutex.Lock()
+	m.applied[collection] = version
+	m.mutex.Unlock()
+	return n, nil
+}
+
+// pendingMigrations returns the migrations registered for a collection and
+// the version MigrateAll last brought it to
+func (d *Driver) pendingMigrations(collection string) ([]migration, int) {
+	m := d.migrations
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	steps := m.steps[collection]
+	if len(steps) == 0 {
+		return nil, 0
+	}
+	applied, ok := m.applied[collection]
+	if !ok {
+		var state struct {
+			Version int `json:"version"`
+		}
+		if b, err := d.backend.ReadFile(d.migrationsPath(collection)); err == nil {
+			json.Unmarshal(b, &state)
+		}
+		applied = state.Version
+		m.applied[collection] = applied
+	}
+	return steps, applied
+}
+
+// migrateRecord runs the migrations a stored record is missing on it
+func (d *Driver) migrateRecord(collection, resource string, b []byte) ([]byte, error) {
+	b, _, err := d.upgrade(collection, resource, b)
+	return b, err
+}
+
+// upgrade returns b migrated to the latest version of its collection, and
+// whether it had to be
+func (d *Driver) upgrade(collection, resource string, b []byte) ([]byte, bool, error) {
+	steps, applied := d.pendingMigrations(collection)
+	if len(steps) == 0 || applied >= steps[len(steps)-1].version || !isObject(b) {
+		return b, false, nil
+	}
+	meta, _ := d.recordMeta(b)
+	if meta.SchemaVersion >= steps[len(steps)-1].version {
+		return b, false, nil
+	}
+
+	v, err := decodeDocument(b)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to migrate %v: %w", filepath.Join(collection, resource), err)
+	}
+	doc := v.(map[string]interface{})
+	stored, _ := doc[d.metaField].(map[string]interface{})
+	delete(doc, d.metaField)
+
+	for _, step := range steps {
+		if step.version <= meta.SchemaVersion {
+			continue
+		}
+		if err := step.fn(doc); err != nil {
+			return nil, false, fmt.Errorf("unable to migrate %v to version %d: %w", filepath.Join(collection, resource), step.version, err)
+		}
+	}
+
+	if stored == nil {
+		stored = make(map[string]interface{})
+	}
+	stored["schemaVersion"] = steps[len(steps)-1].version
+	doc[d.metaField] = stored
+	b, err = d.encode(doc)
+	return b, err == nil, err
+}
+
+// stampVersion returns b, a JSON record about to be written to collection,
+// with the latest version of the collection's migrations in its meta member
+func (d *Driver) stampVersion(collection string, b []byte) ([]byte, error) {
+	steps, _ := d.pendingMigrations(collection)
+	if len(steps) == 0 || !isObject(b) {
+		return b, nil
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, fmt.Errorf("unable to stamp schema version on record of %v: %w", collection, err)
+	}
+	meta := make(map[string]json.RawMessage)
+	if stored, ok := members[d.metaField]; ok {
+		json.Unmarshal(stored, &meta)
+	}
+	meta["schemaVersion"] = json.RawMessage(fmt.Sprint(steps[len(steps)-1].version))
+	m, err := json.MarshalIndent(meta, "\t", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return d.setMeta(b, members, m)
+}
+
+// forgetMigrated drops the version MigrateAll recorded for a collection,
+// once records it didn't migrate may have been moved into it
+func (d *Driver) forgetMigrated(collection string) error {
+	m := d.migrations
+	m.mutex.Lock()
+	delete(m.applied, collection)
+	m.mutex.Unlock()
+
+	if err := d.backend.Remove(d.migrationsPath(collection)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// dropMigrated forgets the cached versions of a removed or renamed
+// collection and of the collections nested in it
+func (d *Driver) dropMigrated(collection string) {
+	m := d.migrations
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name := range m.applied {
+		if name == collection || strings.HasPrefix(name, collection+"/") {
+			delete(m.applied, name)
+		}
+	}
+}
+
+// isObject reports whether an encoded JSON record is an object
+func isObject(b []byte) bool {
+	trimmed := bytes.TrimLeft(b, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
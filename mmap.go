@@ -0,0 +1,52 @@
+//go:build linux || darwin || freebsd
+
+package jsondb
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mmapWriteFile is writeFile through a memory mapping: the temp file is sized
+// up front, b is copied into a shared mapping of it and flushed with msync
+// before the rename. b must not be empty.
+func mmapWriteFile(tempPath, finalPath string, b []byte) error {
+	f, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := mmapCopy(f, b); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, finalPath)
+}
+
+func mmapCopy(f *os.File, b []byte) error {
+	if err := f.Truncate(int64(len(b))); err != nil {
+		return err
+	}
+
+	m, err := syscall.Mmap(int(f.Fd()), 0, len(b), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	copy(m, b)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&m[0])), uintptr(len(m)), syscall.MS_SYNC)
+	if err := syscall.Munmap(m); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
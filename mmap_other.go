@@ -0,0 +1,29 @@
+//go:build !(linux || darwin || freebsd)
+
+package jsondb
+
+import "os"
+
+// mmapWriteFile falls back to writeFile where mmap isn't supported, with
+// the fsync standing in for msync
+func mmapWriteFile(tempPath, finalPath string, b []byte) error {
+	f, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, finalPath)
+}
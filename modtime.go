@@ -0,0 +1,177 @@
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LastModified returns the modification time of a record's file, without
+// reading its contents. Expired records are not found.
+func (d *Driver) LastModified(collection, resource string) (t time.Time, err error) {
+	defer d.done(OpLastModified, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return time.Time{}, fmt.Errorf("%w - unable to stat record", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return time.Time{}, fmt.Errorf("%w - unable to stat record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return time.Time{}, err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return time.Time{}, err
+	}
+	if err := d.requireFiles("LastModified"); err != nil {
+		return time.Time{}, err
+	}
+
+	fi, err := d.backend.Stat(filepath.Join(d.dir, collection, resource+d.ext))
+	if err == nil && d.expired(collection, resource) {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return time.Time{}, notFound(collection, resource, err)
+	}
+
+	return fi.ModTime(), nil
+}
+
+// CollectionLastModified returns the modification time of the most recently
+// modified record in a collection, expired records left out. An empty
+// collection reports the zero time.
+func (d *Driver) CollectionLastModified(collection string) (t time.Time, err error) {
+	defer d.done(OpCollectionLastModified, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return time.Time{}, fmt.Errorf("%w - unable to stat collection", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return time.Time{}, err
+	}
+	if err := d.requireFiles("CollectionLastModified"); err != nil {
+		return time.Time{}, err
+	}
+
+	files, err := d.backend.ReadDir(filepath.Join(d.dir, collection))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != d.ext {
+			continue
+		}
+		if d.expired(collection, strings.TrimSuffix(file.Name(), d.ext)) {
+			continue
+		}
+
+		fi, err := file.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+
+	return t, nil
+}
+
+// FindModifiedBetween returns the raw JSON of the records of a collection
+// last modified at or after start and before end. Files are filtered on
+// their modification time, so records outside the range are never read.
+// Expired records are left out, as by ReadAll.
+func (d *Driver) FindModifiedBetween(collection string, start, end time.Time) (records []string, err error) {
+	defer d.done(OpFindModifiedBetween, collection, "", time.Now(), &err)
+
+	return d.findByModTime(collection, func(t time.Time) bool {
+		return !t.Before(start) && t.Before(end)
+	})
+}
+
+// FindModifiedAfter returns the raw JSON of the records modified after t
+func (d *Driver) FindModifiedAfter(collection string, t time.Time) (records []string, err error) {
+	defer d.done(OpFindModifiedAfter, collection, "", time.Now(), &err)
+
+	return d.findByModTime(collection, func(mt time.Time) bool { return mt.After(t) })
+}
+
+// FindModifiedBefore returns the raw JSON of the records modified before t
+func (d *Driver) FindModifiedBefore(collection string, t time.Time) (records []string, err error) {
+	defer d.done(OpFindModifiedBefore, collection, "", time.Now(), &err)
+
+	return d.findByModTime(collection, func(mt time.Time) bool { return mt.Before(t) })
+}
+
+// ReadAllSince returns the raw JSON of the records modified after since, for
+// incremental syncs. It is FindModifiedAfter under the name ReadAll users
+// look for: unchanged records are only stat'ed, never read.
+func (d *Driver) ReadAllSince(collection string, since time.Time) (records []string, err error) {
+	defer d.done(OpReadAllSince, collection, "", time.Now(), &err)
+
+	return d.findByModTime(collection, func(mt time.Time) bool { return mt.After(since) })
+}
+
+func (d *Driver) findByModTime(collection string, keep func(time.Time) bool) (records []string, err error) {
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read record", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := d.requireFiles("FindModified"); err != nil {
+		return nil, err
+	}
+
+	if err := d.beforeRead(collection, ""); err != nil {
+		return nil, err
+	}
+	defer func() { d.afterRead(collection, "", &records, err) }()
+
+	dir := filepath.Join(d.dir, collection)
+	files, err := d.backend.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != d.ext {
+			continue
+		}
+		if d.expired(collection, strings.TrimSuffix(file.Name(), d.ext)) {
+			continue
+		}
+
+		fi, err := file.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !keep(fi.ModTime()) {
+			continue
+		}
+
+		b, err := d.readFile(filepath.Join(dir, file.Name()))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			b, err = d.migrateRecord(collection, strings.TrimSuffix(file.Name(), d.ext), b)
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, string(b))
+	}
+
+	return records, nil
+}
@@ -0,0 +1,157 @@
+package jsondb
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// URLSafeCollectionValidator only accepts collection names made of ASCII
+// letters, digits and the characters '_', '-', '.' and '/'.
+//
+// Collection names become directory names as-is, and characters such as ':',
+// '*', '?' or '\' are rejected by some filesystems (Windows, SMB shares) or
+// mean something else to them. Restricting names to this set keeps a data
+// directory portable between platforms.
+func URLSafeCollectionValidator(name string) error {
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_', r == '-', r == '.', r == '/':
+		default:
+			return fmt.Errorf("%w: collection %q - character %q is not allowed", ErrInvalidName, name, r)
+		}
+	}
+
+	return nil
+}
+
+// PortableNameValidator rejects collection and record names that some
+// platform can't store as a file name: the characters Windows reserves
+// (<>:"|?* and '\'), control characters, its device names such as CON or
+// LPT1, and names ending in a dot or a space. The driver applies it to every
+// name; it is exported to check names before handing them to the driver.
+func PortableNameValidator(name string) error {
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"|?*\`, r) {
+			return fmt.Errorf("%w: %q - character %q is not portable", ErrInvalidName, name, r)
+		}
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			continue
+		}
+		if strings.HasSuffix(seg, ".") || strings.HasSuffix(seg, " ") {
+			return fmt.Errorf("%w: %q - %q ends in a dot or space", ErrInvalidName, name, seg)
+		}
+		base := strings.ToUpper(seg)
+		if i := strings.IndexByte(base, '.'); i >= 0 {
+			base = base[:i]
+		}
+		if windowsDevices[base] {
+			return fmt.Errorf("%w: %q - %q is a reserved device name", ErrInvalidName, name, seg)
+		}
+	}
+	return nil
+}
+
+var windowsDevices = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// validateCollection checks a collection name against the driver's rules
+func (d *Driver) validateCollection(collection string) error {
+	return checkCollectionName(collection, d.collectionValidator)
+}
+
+// checkCollectionName rejects names that would leave the database dir, that
+// aren't portable or that the driver keeps for itself, then runs validator,
+// if any. Every error it returns wraps ErrInvalidName.
+func checkCollectionName(collection string, validator func(string) error) error {
+	if strings.IndexByte(collection, 0) >= 0 {
+		return fmt.Errorf("%w: collection %q contains a NUL byte", ErrInvalidName, collection)
+	}
+	if filepath.IsAbs(collection) || strings.HasPrefix(filepath.ToSlash(collection), "/") || filepath.VolumeName(collection) != "" {
+		return fmt.Errorf("%w: collection %q is an absolute path", ErrInvalidName, collection)
+	}
+	for _, seg := range strings.Split(filepath.ToSlash(collection), "/") {
+		if seg == ".." {
+			return fmt.Errorf("%w: collection %q leaves the database dir", ErrInvalidName, collection)
+		}
+		// "." and "a//b" name the database dir or its parent collection
+		if seg == "." || seg == "" {
+			return fmt.Errorf("%w: collection %q has an empty or . segment", ErrInvalidName, collection)
+		}
+		// the driver's own dirs, such as .indexes, .transactions and
+		// .backup-*, start with a dot, and Collections skips them
+		if strings.HasPrefix(seg, ".") {
+			return fmt.Errorf("%w: collection %q - %q starts with a dot, reserved for the driver", ErrInvalidName, collection, seg)
+		}
+	}
+	if err := PortableNameValidator(collection); err != nil {
+		return err
+	}
+	if c := filepath.ToSlash(filepath.Clean(collection)); c == trashDir || strings.HasPrefix(c, trashDir+"/") {
+		return fmt.Errorf("%w: collection %q is reserved for deleted records", ErrInvalidName, collection)
+	}
+	if c := filepath.ToSlash(filepath.Clean(collection)); c == metaDir || strings.HasPrefix(c, metaDir+"/") {
+		return fmt.Errorf("%w: collection %q is reserved for the driver's metadata", ErrInvalidName, collection)
+	}
+	if c := filepath.ToSlash(filepath.Clean(collection)); c == txDir || strings.HasPrefix(c, txDir+"/") {
+		return fmt.Errorf("%w: collection %q is reserved for transactions", ErrInvalidName, collection)
+	}
+	for _, seg := range strings.Split(filepath.ToSlash(filepath.Clean(collection)), "/") {
+		if seg == historyDir {
+			return fmt.Errorf("%w: collection %q - %s is reserved for record history", ErrInvalidName, collection, historyDir)
+		}
+	}
+
+	if validator == nil {
+		return nil
+	}
+
+	if err := validator(collection); err != nil {
+		if errors.Is(err, ErrInvalidName) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrInvalidName, err)
+	}
+	return nil
+}
+
+// validateResource checks a record name against the driver's rules
+func (d *Driver) validateResource(resource string) error {
+	return checkResourceName(resource, d.resourceValidator)
+}
+
+// checkResourceName rejects names that aren't a single portable file name
+// within the collection dir, then runs validator, if any. Every error it
+// returns wraps ErrInvalidName.
+func checkResourceName(resource string, validator func(string) error) error {
+	switch {
+	case resource == "." || resource == "..":
+		return fmt.Errorf("%w: record %q leaves the collection dir", ErrInvalidName, resource)
+	case strings.ContainsRune(resource, '/') || strings.ContainsRune(resource, filepath.Separator):
+		return fmt.Errorf("%w: record %q contains a path separator", ErrInvalidName, resource)
+	case strings.IndexByte(resource, 0) >= 0:
+		return fmt.Errorf("%w: record %q contains a NUL byte", ErrInvalidName, resource)
+	}
+	if err := PortableNameValidator(resource); err != nil {
+		return err
+	}
+
+	if validator == nil {
+		return nil
+	}
+
+	if err := validator(resource); err != nil {
+		if errors.Is(err, ErrInvalidName) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrInvalidName, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package jsondb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckCollectionName(t *testing.T) {
+	tests := []struct {
+		name    string
+		invalid bool
+	}{
+		{"users", false},
+		{"users/admins", false},
+		{"v1.2", false},
+		{".", true},
+		{"./", true},
+		{"./users", true},
+		{"users/.", true},
+		{"users/", true},
+		{"users//admins", true},
+		{"/", true},
+		{"..", true},
+		{"users/../..", true},
+		{"/etc", true},
+		{"a\x00b", true},
+		{trashDir, true},
+		{metaDir + "/x", true},
+		{txDir, true},
+		{"users/" + historyDir, true},
+		{indexDir, true},
+		{"users/" + indexDir, true},
+		{backupPrefix + "20260101", true},
+		{".hidden/users", true},
+		{"a:b", true},
+		{"a<b", true},
+		{`a\b`, true},
+		{"a?b", true},
+		{"CON", true},
+		{"users/lpt1.txt", true},
+		{"x ", true},
+		{"users.", true},
+	}
+	for _, tt := range tests {
+		err := checkCollectionName(tt.name, nil)
+		if got := errors.Is(err, ErrInvalidName); got != tt.invalid {
+			t.Errorf("checkCollectionName(%q) = %v, want invalid %v", tt.name, err, tt.invalid)
+		}
+	}
+}
+
+func TestCheckResourceName(t *testing.T) {
+	tests := []struct {
+		name    string
+		invalid bool
+	}{
+		{"ada", false},
+		{"ada.lovelace", false},
+		{"ada lovelace", false},
+		{".ada", false},
+		{".", true},
+		{"..", true},
+		{"a/b", true},
+		{"a\x00b", true},
+		{"a:b", true},
+		{"a<b", true},
+		{`a\b`, true},
+		{"a?b", true},
+		{"a\tb", true},
+		{"CON", true},
+		{"nul.txt", true},
+		{"x ", true},
+		{"x.", true},
+	}
+	for _, tt := range tests {
+		err := checkResourceName(tt.name, nil)
+		if got := errors.Is(err, ErrInvalidName); got != tt.invalid {
+			t.Errorf("checkResourceName(%q) = %v, want invalid %v", tt.name, err, tt.invalid)
+		}
+	}
+}
+
+// Delete(".", "") used to RemoveAll the database dir
+func TestDeleteDotCollection(t *testing.T) {
+	d, dir := newTestDriver(t, nil)
+	if err := d.Write("users", "a", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{".", "./", "users/..", "users//"} {
+		if err := d.Delete(c, ""); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Delete(%q, \"\") = %v, want ErrInvalidName", c, err)
+		}
+		if err := d.DropCollection(c, true); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("DropCollection(%q) = %v, want ErrInvalidName", c, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "users", "a.json")); err != nil {
+		t.Fatalf("record gone after deleting invalid collections: %v", err)
+	}
+}
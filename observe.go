@@ -0,0 +1,137 @@
+package jsondb
+
+import "time"
+
+// Op names a Driver operation reported to an Observe callback
+type Op string
+
+const (
+	OpWrite                  Op = "Write"
+	OpWriteCtx               Op = "WriteCtx"
+	OpInsert                 Op = "Insert"
+	OpWriteIfRevision        Op = "WriteIfRevision"
+	OpRead                   Op = "Read"
+	OpReadCtx                Op = "ReadCtx"
+	OpReadAll                Op = "ReadAll"
+	OpReadAllCtx             Op = "ReadAllCtx"
+	OpReadAllPaged           Op = "ReadAllPaged"
+	OpIterate                Op = "Iterate"
+	OpFind                   Op = "Find"
+	OpAggregate              Op = "Aggregate"
+	OpAggregateInto          Op = "AggregateInto"
+	OpEnableSearch           Op = "EnableSearch"
+	OpDisableSearch          Op = "DisableSearch"
+	OpSearch                 Op = "Search"
+	OpFindCtx                Op = "FindCtx"
+	OpReadAllWithOptions     Op = "ReadAllWithOptions"
+	OpFindWithOptions        Op = "FindWithOptions"
+	OpCreateIndex            Op = "CreateIndex"
+	OpDropIndex              Op = "DropIndex"
+	OpListIndexes            Op = "ListIndexes"
+	OpReindex                Op = "Reindex"
+	OpAddUniqueConstraint    Op = "AddUniqueConstraint"
+	OpDropUniqueConstraint   Op = "DropUniqueConstraint"
+	OpDelete                 Op = "Delete"
+	OpWriteAllEncoded        Op = "WriteAllEncoded"
+	OpWriteBatch             Op = "WriteBatch"
+	OpDeleteBatch            Op = "DeleteBatch"
+	OpUpdate                 Op = "Update"
+	OpUpsert                 Op = "Upsert"
+	OpIncrement              Op = "Increment"
+	OpPatch                  Op = "Patch"
+	OpReadOrDefault          Op = "ReadOrDefault"
+	OpReadWithOptions        Op = "ReadWithOptions"
+	OpReadWithMeta           Op = "ReadWithMeta"
+	OpReadPopulated          Op = "ReadPopulated"
+	OpReadJSON5              Op = "ReadJSON5"
+	OpExists                 Op = "Exists"
+	OpBulkExists             Op = "BulkExists"
+	OpCount                  Op = "Count"
+	OpKeys                   Op = "Keys"
+	OpRandSample             Op = "RandSample"
+	OpLastModified           Op = "LastModified"
+	OpCollectionLastModified Op = "CollectionLastModified"
+	OpFindModifiedBetween    Op = "FindModifiedBetween"
+	OpFindModifiedAfter      Op = "FindModifiedAfter"
+	OpFindModifiedBefore     Op = "FindModifiedBefore"
+	OpReadAllSince           Op = "ReadAllSince"
+	OpInferSchema            Op = "InferSchema"
+	OpWatchSchema            Op = "WatchSchema"
+	OpSetSchema              Op = "SetSchema"
+	OpWriteWithTTL           Op = "WriteWithTTL"
+	OpTTL                    Op = "TTL"
+	OpSetTTL                 Op = "SetTTL"
+	OpGetTTL                 Op = "GetTTL"
+	OpClearTTL               Op = "ClearTTL"
+	OpReEncrypt              Op = "ReEncrypt"
+	OpBackup                 Op = "Backup"
+	OpRestore                Op = "Restore"
+	OpExportCollection       Op = "ExportCollection"
+	OpExportParquet          Op = "ExportParquet"
+	OpImportCollection       Op = "ImportCollection"
+	OpListen                 Op = "Listen"
+	OpWatch                  Op = "Watch"
+	OpLockCollection         Op = "LockCollection"
+	OpShard                  Op = "Shard"
+	OpPartition              Op = "Partition"
+	OpCopyCollection         Op = "CopyCollection"
+	OpCollections            Op = "Collections"
+	OpDropCollection         Op = "DropCollection"
+	OpRenameCollection       Op = "RenameCollection"
+	OpRenameResource         Op = "RenameResource"
+	OpSoftDelete             Op = "SoftDelete"
+	OpUndelete               Op = "Undelete"
+	OpForceUndelete          Op = "ForceUndelete"
+	OpEmptyTrash             Op = "EmptyTrash"
+	OpPurgeTrash             Op = "PurgeTrash"
+	OpPurge                  Op = "Purge"
+	OpCompactLog             Op = "CompactLog"
+	OpCompact                Op = "Compact"
+	OpSeekRecord             Op = "SeekRecord"
+	OpReadAt                 Op = "ReadAt"
+	OpDumpAll                Op = "DumpAll"
+	OpLoadAll                Op = "LoadAll"
+	OpWriteManifest          Op = "WriteManifest"
+	OpVerifyManifest         Op = "VerifyManifest"
+	OpScanAndRepair          Op = "ScanAndRepair"
+	OpTransaction            Op = "Transaction"
+	OpHistory                Op = "History"
+	OpReadRevision           Op = "ReadRevision"
+	OpReadAllVersions        Op = "ReadAllVersions"
+	OpMigrate                Op = "Migrate"
+	OpMigrateAll             Op = "MigrateAll"
+)
+
+// Observe returns a driver sharing d's storage and locks that calls fn after
+// every operation completes, with the time it took and the error it returned.
+// resource is empty for operations on a whole collection, and both names are
+// empty for operations on the whole database. fn runs synchronously on the
+// caller's goroutine, so it must not block. Public methods used by other
+// operations are reported as well, e.g. WriteJSON5 shows up as a Write.
+func (d *Driver) Observe(fn func(op Op, collection, resource string, duration time.Duration, err error)) *Driver {
+	nd := *d
+	nd.observers = append(append([]func(Op, string, string, time.Duration, error){}, d.observers...), fn)
+	return &nd
+}
+
+// done is deferred first by every public Driver method. It turns a panic in
+// the method into a *PanicError, after the collection mutex has been released,
+// and reports the finished operation to the observers, Options.Metrics and
+// the trace log.
+func (d *Driver) done(op Op, collection, resource string, start time.Time, err *error) {
+	if v := recover(); v != nil {
+		*err = newPanicError(v)
+	}
+	if len(d.observers) == 0 && d.metrics == nil && !d.traceAll && d.traced == nil {
+		return
+	}
+
+	elapsed := time.Since(start)
+	d.trace(op, collection, resource, elapsed, *err)
+	if d.metrics != nil {
+		d.metrics.ObserveOperation(op, elapsed, *err)
+	}
+	for _, fn := range d.observers {
+		fn(op, collection, resource, elapsed, *err)
+	}
+}
@@ -0,0 +1,208 @@
+package jsondb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OptionsError lists every problem found by Options.Validate
+type OptionsError struct {
+	Problems []string
+}
+
+func (e *OptionsError) Error() string {
+	return fmt.Sprintf("invalid options - %s", strings.Join(e.Problems, "; "))
+}
+
+// Validate checks every field of o and every combination of fields known not
+// to work together. It reports all problems at once in an *OptionsError, so
+// configuration loaded from a file can be checked before calling New.
+func (o Options) Validate() error {
+	var problems []string
+
+	if o.Logger != nil && o.Slog != nil {
+		problems = append(problems, "Logger and Slog can't both be set")
+	}
+
+	if o.TrashRetention < 0 {
+		problems = append(problems, fmt.Sprintf("TrashRetention must not be negative, got %v", o.TrashRetention))
+	}
+
+	if o.Format != "" && o.Format != FormatJSON && o.Format != FormatGob {
+		problems = append(problems, fmt.Sprintf("Format must be %q or %q, got %q", FormatJSON, FormatGob, o.Format))
+	}
+	if o.Codec != nil {
+		if o.Format != "" {
+			problems = append(problems, "Format and Codec are mutually exclusive")
+		}
+		switch ext := o.Codec.Extension(); {
+		case len(ext) < 2 || ext[0] != '.' || strings.ContainsAny(ext, `/\`):
+			problems = append(problems, fmt.Sprintf("Codec extension must be a dot followed by a name, got %q", ext))
+		case ext == ".log" || ext == ".idx" || ext == ".lock" || ext == ".seq" || ext == ".tmp":
+			problems = append(problems, fmt.Sprintf("Codec extension %s is reserved", ext))
+		}
+	}
+
+	if o.CountingBloomFilter && o.BloomFilterBits == 0 {
+		problems = append(problems, "CountingBloomFilter requires BloomFilterBits")
+	}
+
+	if d := o.writeDelay(); d < 0 {
+		problems = append(problems, fmt.Sprintf("TestWriteDelay must not be negative, got %v", d))
+	}
+
+	if strings.ContainsAny(o.TmpSuffix, `/\`) {
+		problems = append(problems, fmt.Sprintf("TmpSuffix must not contain path separators, got %q", o.TmpSuffix))
+	}
+	exts := []string{".json", ".gob", ".log", ".idx"}
+	if o.Codec != nil {
+		exts = append(exts, o.Codec.Extension())
+	}
+	for _, ext := range exts {
+		if strings.HasSuffix(o.TmpSuffix, ext) {
+			problems = append(problems, fmt.Sprintf("TmpSuffix must not end in %s, got %q", ext, o.TmpSuffix))
+		}
+	}
+
+	if o.RecordPadding < 0 {
+		problems = append(problems, fmt.Sprintf("RecordPadding must not be negative, got %d", o.RecordPadding))
+	}
+	if o.RecordPadding > 0 && o.format() != FormatJSON {
+		problems = append(problems, "RecordPadding only supports the json Format")
+	}
+	if o.Metadata && o.format() != FormatJSON {
+		problems = append(problems, "Metadata only supports the json Format")
+	}
+	if !validCompression(o.Compression) {
+		problems = append(problems, fmt.Sprintf("Compression must be %q or %q, got %q", CompressionNone, CompressionGzip, o.Compression))
+	}
+	if o.Compression == CompressionGzip && o.RecordPadding > 0 {
+		problems = append(problems, "Compression is not supported with RecordPadding")
+	}
+	if o.MmapThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("MmapThreshold must not be negative, got %d", o.MmapThreshold))
+	}
+	if o.CacheSize < 0 {
+		problems = append(problems, fmt.Sprintf("CacheSize must not be negative, got %d", o.CacheSize))
+	}
+	if o.CacheSize > 0 && o.FileLocking {
+		problems = append(problems, "CacheSize is not supported with FileLocking")
+	}
+	if o.MmapThreshold > 0 && !o.onDisk() {
+		problems = append(problems, "MmapThreshold requires the Disk Backend")
+	}
+	if o.FileLocking && !o.onDisk() {
+		problems = append(problems, "FileLocking requires the Disk Backend")
+	}
+
+	if o.WALSync != WALSyncAlways && o.WALSync != WALSyncNever {
+		problems = append(problems, fmt.Sprintf("WALSync must be WALSyncAlways or WALSyncNever, got %v", o.WALSync))
+	}
+	if o.Durability < DurabilityNone || o.Durability > DurabilityStrict {
+		problems = append(problems, fmt.Sprintf("Durability must be DurabilityNone, DurabilityRelaxed or DurabilityStrict, got %v", o.Durability))
+	}
+
+	if o.History != nil {
+		for _, p := range o.History.problems() {
+			problems = append(problems, "History: "+p)
+		}
+	}
+
+	if o.ExpiryInterval < 0 {
+		problems = append(problems, fmt.Sprintf("ExpiryInterval must not be negative, got %v", o.ExpiryInterval))
+	}
+
+	if o.MaintenanceInterval < 0 {
+		problems = append(problems, fmt.Sprintf("MaintenanceInterval must not be negative, got %v", o.MaintenanceInterval))
+	}
+
+	if o.LockTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("LockTimeout must not be negative, got %v", o.LockTimeout))
+	}
+
+	switch o.Storage {
+	case "", StorageFiles:
+	case StorageAppendLog:
+		if o.format() != FormatJSON {
+			problems = append(problems, "Storage appendlog only supports the json Format")
+		}
+		if o.TrashRetention > 0 {
+			problems = append(problems, "TrashRetention is not supported with Storage appendlog")
+		}
+		if o.VerifyWrites {
+			problems = append(problems, "VerifyWrites is not supported with Storage appendlog")
+		}
+		if o.WriteAheadLog {
+			problems = append(problems, "WriteAheadLog is not supported with Storage appendlog")
+		}
+		if o.Encryption != nil {
+			problems = append(problems, "Encryption is not supported with Storage appendlog")
+		}
+		if o.Compression == CompressionGzip {
+			problems = append(problems, "Compression is not supported with Storage appendlog")
+		}
+		if o.History != nil {
+			problems = append(problems, "History is not supported with Storage appendlog")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("Storage must be %q or %q, got %q", StorageFiles, StorageAppendLog, o.Storage))
+	}
+
+	names := make([]string, 0, len(o.Collections))
+	for name := range o.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "" {
+			problems = append(problems, "Collections has an entry with an empty name")
+			continue
+		}
+		if err := checkCollectionName(name, o.CollectionNameValidator); err != nil {
+			problems = append(problems, fmt.Sprintf("Collections entry %q: %v", name, err))
+		}
+		if o.Collections[name].VerifyWrites && o.Storage == StorageAppendLog {
+			problems = append(problems, fmt.Sprintf("Collections entry %q: VerifyWrites is not supported with Storage appendlog", name))
+		}
+		if c := o.Collections[name].Compression; !validCompression(c) {
+			problems = append(problems, fmt.Sprintf("Collections entry %q: Compression must be %q or %q, got %q", name, CompressionNone, CompressionGzip, c))
+		} else if c == CompressionGzip && (o.RecordPadding > 0 || o.Storage == StorageAppendLog) {
+			problems = append(problems, fmt.Sprintf("Collections entry %q: Compression is not supported with RecordPadding or Storage appendlog", name))
+		}
+		if h := o.Collections[name].History; h != nil {
+			for _, p := range h.problems() {
+				problems = append(problems, fmt.Sprintf("Collections entry %q: History: %s", name, p))
+			}
+			if o.Storage == StorageAppendLog {
+				problems = append(problems, fmt.Sprintf("Collections entry %q: History is not supported with Storage appendlog", name))
+			}
+		}
+		if p := o.Collections[name].References; p < ReferenceIgnore || p > ReferenceCascade {
+			problems = append(problems, fmt.Sprintf("Collections entry %q: References must be ReferenceIgnore, ReferenceRestrict or ReferenceCascade, got %v", name, p))
+		} else if p != ReferenceIgnore && (o.format() != FormatJSON || o.Storage == StorageAppendLog) {
+			problems = append(problems, fmt.Sprintf("Collections entry %q: References requires the json Format and the files Storage", name))
+		}
+		if ttl := o.Collections[name].TTL; ttl < 0 {
+			problems = append(problems, fmt.Sprintf("Collections entry %q: TTL must not be negative, got %v", name, ttl))
+		} else if ttl > 0 && o.Storage == StorageAppendLog {
+			problems = append(problems, fmt.Sprintf("Collections entry %q: TTL is not supported with Storage appendlog", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &OptionsError{Problems: problems}
+	}
+	return nil
+}
+
+// format is the format New derives from Format and Codec
+func (o Options) format() string {
+	if o.Codec != nil {
+		return codecFormat(o.Codec)
+	}
+	if o.Format == "" {
+		return FormatJSON
+	}
+	return o.Format
+}
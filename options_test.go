@@ -0,0 +1,125 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jcelliott/lumber"
+)
+
+// extCodec is a JSON Codec with the extension of its value
+type extCodec string
+
+func (extCodec) Marshal(v interface{}) ([]byte, error)   { return json.Marshal(v) }
+func (extCodec) Unmarshal(b []byte, v interface{}) error { return json.Unmarshal(b, v) }
+func (c extCodec) Extension() string                     { return string(c) }
+
+func TestOptionsValidate(t *testing.T) {
+	appendLog := func(o Options) Options {
+		o.Storage = StorageAppendLog
+		return o
+	}
+	collection := func(c CollectionOptions) map[string]CollectionOptions {
+		return map[string]CollectionOptions{"users": c}
+	}
+
+	tests := []struct {
+		name    string
+		options Options
+		want    []string // nil when valid
+	}{
+		{"zero value", Options{}, nil},
+		{"valid", Options{CacheSize: 8, Durability: DurabilityStrict, Collections: collection(CollectionOptions{TTL: time.Hour})}, nil},
+		{"valid appendlog", Options{Storage: StorageAppendLog, CacheSize: 8}, nil},
+
+		{"Logger and Slog", Options{Logger: lumber.NewConsoleLogger(lumber.INFO), Slog: quietSlog}, []string{"Logger and Slog can't both be set"}},
+		{"negative TrashRetention", Options{TrashRetention: -time.Second}, []string{"TrashRetention must not be negative, got -1s"}},
+		{"unknown Format", Options{Format: "xml"}, []string{`Format must be "json" or "gob", got "xml"`}},
+		{"Format and Codec", Options{Format: FormatJSON, Codec: JSONCodec}, []string{"Format and Codec are mutually exclusive"}},
+		{"Codec extension without a dot", Options{Codec: extCodec("yaml")}, []string{`Codec extension must be a dot followed by a name, got "yaml"`}},
+		{"Codec extension with a separator", Options{Codec: extCodec(".a/b")}, []string{`Codec extension must be a dot followed by a name, got ".a/b"`}},
+		{"reserved Codec extension", Options{Codec: extCodec(".lock")}, []string{"Codec extension .lock is reserved"}},
+		{"CountingBloomFilter without bits", Options{CountingBloomFilter: true}, []string{"CountingBloomFilter requires BloomFilterBits"}},
+		{"TmpSuffix with a separator", Options{TmpSuffix: "/tmp"}, []string{`TmpSuffix must not contain path separators, got "/tmp"`}},
+		{"TmpSuffix with a record extension", Options{TmpSuffix: ".json"}, []string{`TmpSuffix must not end in .json, got ".json"`}},
+		{"TmpSuffix with the Codec extension", Options{Codec: extCodec(".yaml"), TmpSuffix: "~.yaml"}, []string{`TmpSuffix must not end in .yaml, got "~.yaml"`}},
+		{"negative RecordPadding", Options{RecordPadding: -1}, []string{"RecordPadding must not be negative, got -1"}},
+		{"RecordPadding with gob", Options{Format: FormatGob, RecordPadding: 8}, []string{"RecordPadding only supports the json Format"}},
+		{"Metadata with gob", Options{Format: FormatGob, Metadata: true}, []string{"Metadata only supports the json Format"}},
+		{"unknown Compression", Options{Compression: "zstd"}, []string{`Compression must be "none" or "gzip", got "zstd"`}},
+		{"Compression with RecordPadding", Options{Compression: CompressionGzip, RecordPadding: 8}, []string{"Compression is not supported with RecordPadding"}},
+		{"negative MmapThreshold", Options{MmapThreshold: -1}, []string{"MmapThreshold must not be negative, got -1"}},
+		{"negative CacheSize", Options{CacheSize: -1}, []string{"CacheSize must not be negative, got -1"}},
+		{"CacheSize with FileLocking", Options{CacheSize: 8, FileLocking: true}, []string{"CacheSize is not supported with FileLocking"}},
+		{"MmapThreshold in memory", Options{Backend: Memory(), MmapThreshold: 1}, []string{"MmapThreshold requires the Disk Backend"}},
+		{"FileLocking in memory", Options{Backend: Memory(), FileLocking: true}, []string{"FileLocking requires the Disk Backend"}},
+		{"unknown WALSync", Options{WALSync: 9}, []string{"WALSync must be WALSyncAlways or WALSyncNever, got WALSync(9)"}},
+		{"unknown Durability", Options{Durability: 9}, []string{"Durability must be DurabilityNone, DurabilityRelaxed or DurabilityStrict, got Durability(9)"}},
+		{"negative History", Options{History: &HistoryOptions{Keep: -1, MaxAge: -time.Second}}, []string{"History: Keep must not be negative, got -1", "History: MaxAge must not be negative, got -1s"}},
+		{"negative ExpiryInterval", Options{ExpiryInterval: -time.Second}, []string{"ExpiryInterval must not be negative, got -1s"}},
+		{"negative MaintenanceInterval", Options{MaintenanceInterval: -time.Second}, []string{"MaintenanceInterval must not be negative, got -1s"}},
+		{"negative LockTimeout", Options{LockTimeout: -time.Second}, []string{"LockTimeout must not be negative, got -1s"}},
+
+		{"appendlog with gob", appendLog(Options{Format: FormatGob}), []string{"Storage appendlog only supports the json Format"}},
+		{"appendlog with TrashRetention", appendLog(Options{TrashRetention: time.Hour}), []string{"TrashRetention is not supported with Storage appendlog"}},
+		{"appendlog with VerifyWrites", appendLog(Options{VerifyWrites: true}), []string{"VerifyWrites is not supported with Storage appendlog"}},
+		{"appendlog with WriteAheadLog", appendLog(Options{WriteAheadLog: true}), []string{"WriteAheadLog is not supported with Storage appendlog"}},
+		{"appendlog with Encryption", appendLog(Options{Encryption: StaticKey(make([]byte, 32))}), []string{"Encryption is not supported with Storage appendlog"}},
+		{"appendlog with Compression", appendLog(Options{Compression: CompressionGzip}), []string{"Compression is not supported with Storage appendlog"}},
+		{"appendlog with History", appendLog(Options{History: &HistoryOptions{Keep: 1}}), []string{"History is not supported with Storage appendlog"}},
+		{"unknown Storage", Options{Storage: "sqlite"}, []string{`Storage must be "files" or "appendlog", got "sqlite"`}},
+
+		{"Collections entry without a name", Options{Collections: map[string]CollectionOptions{"": {}}}, []string{"Collections has an entry with an empty name"}},
+		{"Collections entry with an invalid name", Options{Collections: map[string]CollectionOptions{"..": {}}}, []string{`Collections entry "..": invalid name: collection ".." leaves the database dir`}},
+		{"Collections entry VerifyWrites with appendlog", appendLog(Options{Collections: collection(CollectionOptions{VerifyWrites: true})}), []string{`Collections entry "users": VerifyWrites is not supported with Storage appendlog`}},
+		{"Collections entry unknown Compression", Options{Collections: collection(CollectionOptions{Compression: "zstd"})}, []string{`Collections entry "users": Compression must be "none" or "gzip", got "zstd"`}},
+		{"Collections entry Compression with RecordPadding", Options{RecordPadding: 8, Collections: collection(CollectionOptions{Compression: CompressionGzip})}, []string{`Collections entry "users": Compression is not supported with RecordPadding or Storage appendlog`}},
+		{"Collections entry negative History", Options{Collections: collection(CollectionOptions{History: &HistoryOptions{Keep: -1}})}, []string{`Collections entry "users": History: Keep must not be negative, got -1`}},
+		{"Collections entry History with appendlog", appendLog(Options{Collections: collection(CollectionOptions{History: &HistoryOptions{Keep: 1}})}), []string{`Collections entry "users": History is not supported with Storage appendlog`}},
+		{"Collections entry unknown References", Options{Collections: collection(CollectionOptions{References: 9})}, []string{`Collections entry "users": References must be ReferenceIgnore, ReferenceRestrict or ReferenceCascade, got ReferencePolicy(9)`}},
+		{"Collections entry References with gob", Options{Format: FormatGob, Collections: collection(CollectionOptions{References: ReferenceRestrict})}, []string{`Collections entry "users": References requires the json Format and the files Storage`}},
+		{"Collections entry negative TTL", Options{Collections: collection(CollectionOptions{TTL: -time.Second})}, []string{`Collections entry "users": TTL must not be negative, got -1s`}},
+		{"Collections entry TTL with appendlog", appendLog(Options{Collections: collection(CollectionOptions{TTL: time.Hour})}), []string{`Collections entry "users": TTL is not supported with Storage appendlog`}},
+
+		{"every problem at once", Options{
+			Logger:         lumber.NewConsoleLogger(lumber.INFO),
+			Slog:           quietSlog,
+			TrashRetention: -time.Second,
+			Format:         "xml",
+			CacheSize:      -1,
+			LockTimeout:    -time.Second,
+			Storage:        "sqlite",
+			Collections:    map[string]CollectionOptions{"": {}, "users": {TTL: -time.Second}},
+		}, []string{
+			"Logger and Slog can't both be set",
+			"TrashRetention must not be negative, got -1s",
+			`Format must be "json" or "gob", got "xml"`,
+			"CacheSize must not be negative, got -1",
+			"LockTimeout must not be negative, got -1s",
+			`Storage must be "files" or "appendlog", got "sqlite"`,
+			"Collections has an entry with an empty name",
+			`Collections entry "users": TTL must not be negative, got -1s`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var oe *OptionsError
+			if !errors.As(err, &oe) {
+				t.Fatalf("Validate() = %v, want an *OptionsError", err)
+			}
+			if !reflect.DeepEqual(oe.Problems, tt.want) {
+				t.Fatalf("Validate() problems =\n%q\nwant\n%q", oe.Problems, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+//go:build tests
+
+package jsondb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionsValidateWriteDelay(t *testing.T) {
+	var o Options
+	o.TestWriteDelay = -time.Second
+	var oe *OptionsError
+	if err := o.Validate(); !errors.As(err, &oe) {
+		t.Fatalf("Validate() = %v, want an *OptionsError", err)
+	}
+	if want := []string{"TestWriteDelay must not be negative, got -1s"}; !reflect.DeepEqual(oe.Problems, want) {
+		t.Fatalf("Validate() problems = %q, want %q", oe.Problems, want)
+	}
+}
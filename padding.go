@@ -0,0 +1,60 @@
+package jsondb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+// padRecord pads an encoded record with spaces, ahead of its trailing
+// newline, to exactly Options.RecordPadding bytes. Records already larger
+// are returned unchanged.
+func (d *Driver) padRecord(b []byte) []byte {
+	if d.recordPadding <= 0 || len(b) >= d.recordPadding {
+		return b
+	}
+
+	padded := make([]byte, 0, d.recordPadding)
+	padded = append(padded, bytes.TrimSuffix(b, []byte("\n"))...)
+	padded = append(padded, bytes.Repeat([]byte(" "), d.recordPadding-len(padded)-1)...)
+	return append(padded, '\n')
+}
+
+// storeFile writes a record file. A padded record replacing one of the same
+// size is overwritten in place, saving the temp file and rename; anything
+// else goes through the temp file so the write stays atomic, memory mapped
+// when it reaches Options.MmapThreshold.
+func (d *Driver) storeFile(tempPath, finalPath string, b []byte) error {
+	if d.recordPadding > 0 && len(b) == d.recordPadding {
+		if fi, err := d.backend.Stat(finalPath); err == nil && fi.Mode().IsRegular() && fi.Size() == int64(len(b)) {
+			return d.overwriteFile(finalPath, b)
+		}
+	}
+
+	if d.mmapThreshold > 0 && len(b) >= d.mmapThreshold {
+		if err := mmapWriteFile(tempPath, finalPath, b); err != nil {
+			return err
+		}
+		return d.syncDir(filepath.Dir(finalPath))
+	}
+	return d.writeFile(tempPath, finalPath, b)
+}
+
+func (d *Driver) overwriteFile(path string, b []byte) error {
+	f, err := d.backend.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteAt(b, 0); err != nil {
+		f.Close()
+		return err
+	}
+	if d.durability != DurabilityNone {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,63 @@
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ReadAllPaged decodes one page of a collection's records into T. Pages are
+// numbered from 1 and follow the order of the record listing (sorted by
+// resource with the files storage). total is the number of records in the
+// collection, counted from the listing without reading them; a page past the
+// last record is empty. Records deleted while the page is read are skipped.
+func ReadAllPaged[T any](d *Driver, collection string, page, pageSize int) (records []T, total int, err error) {
+	defer d.done(OpReadAllPaged, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, 0, fmt.Errorf("%w - unable to read records", ErrEmptyCollection)
+	}
+	if page < 1 {
+		return nil, 0, fmt.Errorf("invalid page %d - pages start at 1", page)
+	}
+	if pageSize < 1 {
+		return nil, 0, fmt.Errorf("invalid page size %d - must be positive", pageSize)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, 0, err
+	}
+
+	names, err := d.resourceNames(collection)
+	if err != nil {
+		return nil, 0, err
+	}
+	total = len(names)
+
+	records = []T{}
+	start := (page - 1) * pageSize
+	if start >= total {
+		return records, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	for _, name := range names[start:end] {
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, total, err
+		}
+
+		var v T
+		if err := d.decode(b, &v); err != nil {
+			return nil, total, fmt.Errorf("unable to decode %v/%v: %w", collection, name, err)
+		}
+		records = append(records, v)
+	}
+
+	return records, total, nil
+}
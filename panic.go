@@ -0,0 +1,33 @@
+package jsondb
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// ErrPanic is wrapped by every error built from a recovered panic, so callers
+// can test for it with errors.Is
+var ErrPanic = errors.New("panic recovered")
+
+// PanicError is returned by a Driver method whose body panicked. The
+// collection mutex is released before the error reaches the caller.
+type PanicError struct {
+	Value interface{} // value passed to panic
+	Stack []byte      // stack of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrPanic, e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	return ErrPanic
+}
+
+// newPanicError captures the current stack for a value returned by recover
+func newPanicError(v interface{}) *PanicError {
+	stack := make([]byte, 64<<10)
+	stack = stack[:runtime.Stack(stack, false)]
+	return &PanicError{Value: v, Stack: stack}
+}
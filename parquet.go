@@ -0,0 +1,419 @@
+package jsondb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Parquet physical types, encodings and the other enum values of the
+// parquet.thrift definitions the writer uses
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetOptional  = 1
+	parquetUTF8      = 0
+	parquetDataPage  = 0
+	parquetVersion   = 1
+	parquetCreatedBy = "github.com/JJFelix/go-json-database"
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetColumn is one flattened field of the exported records, with a value
+// per record: nil, bool, int64, float64 or string
+type parquetColumn struct {
+	name   string
+	typ    int32
+	values []interface{}
+}
+
+// ExportParquet writes every record of a collection to w as an Apache
+// Parquet file, in resource order, for loading into Spark, DuckDB or
+// BigQuery. Every record must be a JSON object. The columns are the fields
+// of the first record, which must have one, with nested objects flattened
+// to dot separated names such as "Address.City"; fields it lacks are left
+// out, and a missing field or null is a Parquet null. Strings are UTF8 byte
+// arrays, booleans booleans, numbers INT64 when every value of the column
+// is an integer and DOUBLE otherwise, and arrays their JSON text. A value
+// of another type than its column's, say a string where the first record
+// has a number, fails the export. A field that is null in the first record
+// takes its type from the first record that has a value for it.
+//
+// The file holds a single row group with one uncompressed, PLAIN encoded
+// page per column, so the whole collection is held in memory while it is
+// written.
+func (d *Driver) ExportParquet(collection string, w io.Writer) (err error) {
+	defer d.done(OpExportParquet, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to export", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.requireJSON("ExportParquet"); err != nil {
+		return err
+	}
+
+	names, err := d.resourceNames(collection)
+	if err != nil {
+		return err
+	}
+
+	var (
+		rows     []map[string]interface{}
+		resource []string
+	)
+	for _, name := range names {
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		v, err := decodeDocument(b)
+		obj, ok := v.(map[string]interface{})
+		if err != nil || !ok {
+			return fmt.Errorf("unable to export %v as Parquet - not a JSON object", filepath.Join(collection, name))
+		}
+		row := make(map[string]interface{})
+		flattenValues("", obj, row)
+		rows = append(rows, row)
+		resource = append(resource, name)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("unable to export %v as Parquet - no record to take the columns from", collection)
+	}
+
+	var columns []parquetColumn
+	for _, field := range sortedKeys(rows[0]) {
+		col, i, err := newParquetColumn(field, rows)
+		if err != nil {
+			return fmt.Errorf("unable to export %v as Parquet - %w", filepath.Join(collection, resource[i]), err)
+		}
+		columns = append(columns, col)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("unable to export %v as Parquet - %v has no fields to take the columns from", collection, filepath.Join(collection, resource[0]))
+	}
+	return writeParquet(w, columns, len(rows))
+}
+
+// flattenValues stores the fields of obj in fields, the fields of nested
+// objects under dot separated names and arrays as their JSON text
+func flattenValues(prefix string, obj map[string]interface{}, fields map[string]interface{}) {
+	for k, v := range obj {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flattenValues(prefix+k+".", v, fields)
+		case []interface{}:
+			b, _ := json.Marshal(v)
+			fields[prefix+k] = string(b)
+		default:
+			fields[prefix+k] = v
+		}
+	}
+}
+
+// newParquetColumn picks the type of a field from its values in rows and
+// converts them. On an error it returns the index of the offending row.
+func newParquetColumn(field string, rows []map[string]interface{}) (parquetColumn, int, error) {
+	col := parquetColumn{name: field, typ: -1}
+	integers := true
+	for i, row := range rows {
+		v := row[field]
+		typ := int32(-1)
+		switch v := v.(type) {
+		case nil:
+			continue
+		case bool:
+			typ = parquetBoolean
+		case string:
+			typ = parquetByteArray
+		case json.Number:
+			typ = parquetDouble
+			if _, err := strconv.ParseInt(v.String(), 10, 64); err != nil {
+				integers = false
+			}
+		}
+		if col.typ == -1 {
+			col.typ = typ
+		}
+		if typ != col.typ {
+			return col, i, fmt.Errorf("field %q is a %s, the column holds %ss", field, jsonType(v), parquetTypeName(col.typ))
+		}
+	}
+	if col.typ == -1 {
+		col.typ = parquetByteArray // null in every record
+	}
+	if col.typ == parquetDouble && integers {
+		col.typ = parquetInt64
+	}
+
+	for i, row := range rows {
+		v := row[field]
+		if n, ok := v.(json.Number); ok && col.typ == parquetInt64 {
+			v, _ = strconv.ParseInt(n.String(), 10, 64)
+		} else if ok {
+			f, err := n.Float64()
+			if err != nil {
+				return col, i, fmt.Errorf("field %q is %v, out of the range of a DOUBLE", field, n)
+			}
+			v = f
+		}
+		col.values = append(col.values, v)
+	}
+	return col, 0, nil
+}
+
+func parquetTypeName(typ int32) string {
+	switch typ {
+	case parquetBoolean:
+		return "bool"
+	case parquetByteArray:
+		return "string"
+	default:
+		return "number"
+	}
+}
+
+// page returns the data of the column's page: the definition levels, 1 for
+// a value and 0 for a null, and the PLAIN encoded values
+func (c *parquetColumn) page() []byte {
+	var levels, values bytes.Buffer
+	for i := 0; i < len(c.values); {
+		run := 1
+		for i+run < len(c.values) && (c.values[i+run] == nil) == (c.values[i] == nil) {
+			run++
+		}
+		levels.Write(binary.AppendUvarint(nil, uint64(run)<<1))
+		if c.values[i] == nil {
+			levels.WriteByte(0)
+		} else {
+			levels.WriteByte(1)
+		}
+		i += run
+	}
+
+	var bits []byte
+	n := 0
+	for _, v := range c.values {
+		switch v := v.(type) {
+		case bool:
+			if n%8 == 0 {
+				bits = append(bits, 0)
+			}
+			if v {
+				bits[n/8] |= 1 << (n % 8)
+			}
+			n++
+		case int64:
+			values.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+		case float64:
+			values.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+		case string:
+			values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(v))))
+			values.WriteString(v)
+		}
+	}
+	values.Write(bits)
+
+	page := binary.LittleEndian.AppendUint32(nil, uint32(levels.Len()))
+	page = append(page, levels.Bytes()...)
+	return append(page, values.Bytes()...)
+}
+
+// writeParquet writes a Parquet file of one row group holding columns
+func writeParquet(w io.Writer, columns []parquetColumn, rows int) error {
+	bw := bufio.NewWriter(w)
+	offset := int64(len(parquetMagic))
+	bw.Write(parquetMagic)
+
+	type chunk struct {
+		offset, size int64
+	}
+	chunks := make([]chunk, len(columns))
+	for i := range columns {
+		page := columns[i].page()
+		if len(page) > math.MaxInt32 {
+			return fmt.Errorf("unable to export column %q as Parquet - %d bytes exceed a single page", columns[i].name, len(page))
+		}
+
+		var h thriftWriter
+		h.i32(1, parquetDataPage)
+		h.i32(2, int32(len(page)))
+		h.i32(3, int32(len(page)))
+		h.begin(5)
+		h.i32(1, int32(rows))
+		h.i32(2, parquetPlain)
+		h.i32(3, parquetRLE)
+		h.i32(4, parquetRLE)
+		h.end()
+		header := h.finish()
+
+		chunks[i] = chunk{offset, int64(len(header) + len(page))}
+		bw.Write(header)
+		bw.Write(page)
+		offset += chunks[i].size
+	}
+
+	var m thriftWriter
+	m.i32(1, parquetVersion)
+	m.list(2, thriftStruct, len(columns)+1)
+	m.elem()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(columns)))
+	m.end()
+	for _, c := range columns {
+		m.elem()
+		m.i32(1, c.typ)
+		m.i32(3, parquetOptional)
+		m.binary(4, c.name)
+		if c.typ == parquetByteArray {
+			m.i32(6, parquetUTF8)
+		}
+		m.end()
+	}
+	m.i64(3, int64(rows))
+	m.list(4, thriftStruct, 1)
+	m.elem()
+	m.list(1, thriftStruct, len(columns))
+	var total int64
+	for i, c := range columns {
+		m.elem()
+		m.i64(2, chunks[i].offset)
+		m.begin(3)
+		m.i32(1, c.typ)
+		m.list(2, thriftI32, 2)
+		m.varint(parquetPlain)
+		m.varint(parquetRLE)
+		m.list(3, thriftBinary, 1)
+		m.str(c.name)
+		m.i32(4, 0) // uncompressed
+		m.i64(5, int64(rows))
+		m.i64(6, chunks[i].size)
+		m.i64(7, chunks[i].size)
+		m.i64(9, chunks[i].offset)
+		m.end()
+		m.end()
+		total += chunks[i].size
+	}
+	m.i64(2, total)
+	m.i64(3, int64(rows))
+	m.end()
+	m.binary(6, parquetCreatedBy)
+	footer := m.finish()
+
+	bw.Write(footer)
+	bw.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	bw.Write(parquetMagic)
+	return bw.Flush()
+}
+
+// Thrift compact protocol field types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes a struct in the Thrift compact protocol, which
+// Parquet uses for its page headers and footer. Fields must be written in
+// increasing id order; begin and elem open a nested struct, end closes it.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // id of the last field written in each open nested struct
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if len(t.last) == 0 {
+		t.last = []int16{0}
+	}
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint writes a zigzag varint, the encoding of every Thrift integer
+func (t *thriftWriter) varint(v int64) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(v<<1^v>>63)))
+}
+
+func (t *thriftWriter) str(s string) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.str(s)
+}
+
+// list starts a list field of n elements of typ, to be followed by the
+// elements: varint or str calls, or elem and end around each struct
+func (t *thriftWriter) list(id int16, typ byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+	t.buf.WriteByte(0xf0 | typ)
+	t.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (t *thriftWriter) begin(id int16) {
+	t.field(id, thriftStruct)
+	t.elem()
+}
+
+func (t *thriftWriter) elem() {
+	if len(t.last) == 0 {
+		t.last = []int16{0}
+	}
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// finish ends the top-level struct and returns the encoding
+func (t *thriftWriter) finish() []byte {
+	t.buf.WriteByte(0)
+	return t.buf.Bytes()
+}
@@ -0,0 +1,258 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// thriftReader decodes the Thrift compact protocol, structs as maps from
+// field id to value, for checking what writeParquet wrote
+type thriftReader struct {
+	b []byte
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		panic("truncated varint")
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := r.uvarint()
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case thriftList:
+		h := r.b[0]
+		r.b = r.b[1:]
+		n := uint64(h >> 4)
+		if n == 15 {
+			n = r.uvarint()
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(h & 0xf)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unexpected thrift type %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	m := make(map[int16]interface{})
+	var last int16
+	for {
+		h := r.b[0]
+		r.b = r.b[1:]
+		if h == 0 {
+			return m
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		m[id] = r.value(h & 0xf)
+		last = id
+	}
+}
+
+// readParquet decodes a file written by writeParquet into its column names
+// and their values by record
+func readParquet(t *testing.T, b []byte) map[string][]interface{} {
+	t.Helper()
+	if !bytes.HasPrefix(b, parquetMagic) || !bytes.HasSuffix(b, parquetMagic) {
+		t.Fatalf("file doesn't start and end with %q", parquetMagic)
+	}
+	size := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	footerAt := len(b) - 8 - size
+	meta := (&thriftReader{b[footerAt : len(b)-8]}).structure()
+
+	rows := int(meta[3].(int64))
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if root[4] != "schema" || root[5] != int64(len(schema)-1) {
+		t.Fatalf("schema root = %v", root)
+	}
+	groups := meta[4].([]interface{})
+	if len(groups) != 1 || groups[0].(map[int16]interface{})[3] != int64(rows) {
+		t.Fatalf("row groups = %v, want one of %d rows", groups, rows)
+	}
+	chunks := groups[0].(map[int16]interface{})[1].([]interface{})
+
+	columns := make(map[string][]interface{})
+	next := int64(len(parquetMagic))
+	for i, el := range schema[1:] {
+		el := el.(map[int16]interface{})
+		name, typ := el[4].(string), el[1].(int64)
+		if el[3] != int64(parquetOptional) || (typ == parquetByteArray) != (el[6] == int64(parquetUTF8)) {
+			t.Errorf("schema element of %v = %v", name, el)
+		}
+		cm := chunks[i].(map[int16]interface{})[3].(map[int16]interface{})
+		offset := cm[9].(int64)
+		if cm[1] != typ || !reflect.DeepEqual(cm[3], []interface{}{name}) || cm[5] != int64(rows) || offset != next {
+			t.Fatalf("column metadata of %v = %v", name, cm)
+		}
+		next += cm[7].(int64)
+
+		r := &thriftReader{b[offset:next]}
+		header := r.structure()
+		dph := header[5].(map[int16]interface{})
+		if header[1] != int64(parquetDataPage) || header[3] != int64(len(r.b)) || dph[1] != int64(rows) {
+			t.Fatalf("page header of %v = %v with %d bytes of page", name, header, len(r.b))
+		}
+
+		page := r.b
+		levelsEnd := 4 + int(binary.LittleEndian.Uint32(page))
+		levels := &thriftReader{page[4:levelsEnd]}
+		var defined []bool
+		for len(levels.b) > 0 {
+			h := levels.uvarint()
+			if h&1 != 0 {
+				t.Fatalf("bit-packed definition levels in %v", name)
+			}
+			v := levels.b[0] == 1
+			levels.b = levels.b[1:]
+			for j := uint64(0); j < h>>1; j++ {
+				defined = append(defined, v)
+			}
+		}
+		if len(defined) != rows {
+			t.Fatalf("%d definition levels in %v, want %d", len(defined), name, rows)
+		}
+
+		values := page[levelsEnd:]
+		var vals []interface{}
+		bit := 0
+		for _, ok := range defined {
+			if !ok {
+				vals = append(vals, nil)
+				continue
+			}
+			switch typ {
+			case parquetBoolean:
+				vals = append(vals, values[bit/8]&(1<<(bit%8)) != 0)
+				bit++
+			case parquetInt64:
+				vals = append(vals, int64(binary.LittleEndian.Uint64(values)))
+				values = values[8:]
+			case parquetDouble:
+				vals = append(vals, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+				values = values[8:]
+			case parquetByteArray:
+				n := binary.LittleEndian.Uint32(values)
+				vals = append(vals, string(values[4:4+n]))
+				values = values[4+n:]
+			}
+		}
+		columns[name] = vals
+	}
+	if next != int64(footerAt) {
+		t.Fatalf("column chunks end at %d, footer starts at %d", next, footerAt)
+	}
+	return columns
+}
+
+func TestExportParquet(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	for r, doc := range map[string]string{
+		"ada": `{"Name": "Ada", "Age": 36, "Admin": true, "Score": 1.5, "Address": {"City": "London", "Zip": "N1"}, "Tags": ["a", "b"], "Boss": null}`,
+		"bob": `{"Name": "Bob", "Age": 41, "Admin": false, "Score": 2, "Address": {"City": null}, "Boss": "Ada", "Note": "dropped"}`,
+		"cy":  `{"Name": "Cy", "Age": null, "Score": 3}`,
+	} {
+		if err := d.Write("users", r, json.RawMessage(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := d.ExportParquet("users", &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]interface{}{
+		"Address.City": {"London", nil, nil},
+		"Address.Zip":  {"N1", nil, nil},
+		"Admin":        {true, false, nil},
+		"Age":          {int64(36), int64(41), nil},
+		"Boss":         {nil, "Ada", nil},
+		"Name":         {"Ada", "Bob", "Cy"},
+		"Score":        {1.5, 2.0, 3.0},
+		"Tags":         {`["a","b"]`, nil, nil},
+	}
+	if got := readParquet(t, buf.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExportParquet() columns =\n%v\nwant\n%v", got, want)
+	}
+
+	t.Run("many records", func(t *testing.T) {
+		d, _ := newTestDriver(t, nil)
+		want := map[string][]interface{}{"B": nil, "N": nil}
+		for i := 0; i < 40; i++ {
+			var b interface{} = i%3 == 0
+			if i%7 == 0 {
+				b = nil
+			}
+			if err := d.Write("nums", fmt.Sprintf("%02d", i), map[string]interface{}{"N": i, "B": b}); err != nil {
+				t.Fatal(err)
+			}
+			want["B"] = append(want["B"], b)
+			want["N"] = append(want["N"], int64(i))
+		}
+		var buf bytes.Buffer
+		if err := d.ExportParquet("nums", &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := readParquet(t, buf.Bytes()); !reflect.DeepEqual(got, want) {
+			t.Errorf("ExportParquet() columns =\n%v\nwant\n%v", got, want)
+		}
+	})
+
+	for name, tt := range map[string]struct {
+		docs map[string]string
+		want string
+	}{
+		"type mismatch": {map[string]string{"ada": `{"Age": 36}`, "bob": `{"Age": "41"}`}, `users/bob as Parquet - field "Age" is a string, the column holds numbers`},
+		"not an object": {map[string]string{"ada": `[1]`}, "users/ada as Parquet - not a JSON object"},
+		"no records":    {nil, "users as Parquet - no record"},
+		"no fields":     {map[string]string{"ada": `{"Address": {}}`, "bob": `{"Age": 1}`}, "users/ada has no fields"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d, _ := newTestDriver(t, nil)
+			if err := d.Write("users", "gone", json.RawMessage(`{}`)); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Delete("users", "gone"); err != nil {
+				t.Fatal(err)
+			}
+			for r, doc := range tt.docs {
+				if err := d.Write("users", r, json.RawMessage(doc)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := d.ExportParquet("users", &bytes.Buffer{})
+			if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("ExportParquet() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Partition splits the records of collection into two new collections:
+// those for which predicate returns true go to trueCollection, the rest to
+// falseCollection. Neither destination may exist yet. The source collection
+// is left intact. It returns the number of records in each partition.
+func (d *Driver) Partition(collection, trueCollection, falseCollection string, predicate func(raw string) bool) (nTrue, nFalse int, err error) {
+	defer d.done(OpPartition, collection, "", time.Now(), &err)
+
+	if collection == "" || trueCollection == "" || falseCollection == "" {
+		return 0, 0, fmt.Errorf("%w - unable to partition", ErrEmptyCollection)
+	}
+	if trueCollection == falseCollection {
+		return 0, 0, fmt.Errorf("unable to partition %v - both partitions are named %v", collection, trueCollection)
+	}
+	if predicate == nil {
+		return 0, 0, fmt.Errorf("missing predicate - unable to partition")
+	}
+	for _, c := range []string{collection, trueCollection, falseCollection} {
+		if err := d.validateCollection(c); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := d.requireFiles("Partition"); err != nil {
+		return 0, 0, err
+	}
+
+	for _, c := range []string{trueCollection, falseCollection} {
+		if _, err := d.backend.Stat(filepath.Join(d.dir, c)); err == nil {
+			return 0, 0, fmt.Errorf("unable to partition into %v - collection already exists", c)
+		}
+	}
+
+	names, err := d.recordNames(collection)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, name := range names {
+		b, err := d.readFile(filepath.Join(d.dir, collection, name+d.ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			b, err = d.migrateRecord(collection, name, b)
+		}
+		if err != nil {
+			return nTrue, nFalse, err
+		}
+
+		dest := falseCollection
+		if predicate(string(b)) {
+			dest = trueCollection
+		}
+		if err := d.writeRaw(dest, name, b); err != nil {
+			return nTrue, nFalse, err
+		}
+
+		if dest == trueCollection {
+			nTrue++
+		} else {
+			nFalse++
+		}
+	}
+
+	return nTrue, nFalse, nil
+}
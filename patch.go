@@ -0,0 +1,374 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPatchTestFailed is wrapped by the error of Patch when a JSON Patch
+	// test operation doesn't match the record
+	ErrPatchTestFailed = errors.New("JSON patch test failed")
+
+	// ErrInvalidPatch is wrapped by the error of Patch when a JSON Patch
+	// operation is malformed or can't be applied to the record, such as an
+	// unknown op or a path the record doesn't hold
+	ErrInvalidPatch = errors.New("invalid JSON patch")
+)
+
+// PatchMode selects how Patch interprets its patch document
+type PatchMode int
+
+const (
+	// JSONPatch is an RFC 6902 list of add, remove, replace, move, copy and
+	// test operations. If one fails, none is applied.
+	JSONPatch PatchMode = iota
+
+	// MergePatch is an RFC 7386 document merged into the record: its
+	// members replace the record's, nulls remove them
+	MergePatch
+)
+
+func (m PatchMode) String() string {
+	switch m {
+	case JSONPatch:
+		return "json patch"
+	case MergePatch:
+		return "merge patch"
+	}
+	return fmt.Sprintf("PatchMode(%d)", int(m))
+}
+
+// patchOp is one operation of a JSON Patch. Value is nil when the member is
+// missing and holds "null" for a null value, which a *json.RawMessage would
+// decode to nil as well.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Patch changes part of a record with a JSON Patch or a JSON Merge Patch,
+// applied under the collection mutex like Update. The record must exist.
+func (d *Driver) Patch(collection, resource string, patch []byte, mode PatchMode) (err error) {
+	defer d.done(OpPatch, collection, resource, time.Now(), &err)
+
+	var apply func(doc interface{}) (interface{}, error)
+	switch mode {
+	case JSONPatch:
+		var ops []patchOp
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return fmt.Errorf("invalid JSON patch: %w", err)
+		}
+		apply = func(doc interface{}) (interface{}, error) {
+			doc, err := applyJSONPatch(doc, ops)
+			if err != nil && !errors.Is(err, ErrPatchTestFailed) {
+				err = fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+			}
+			return doc, err
+		}
+	case MergePatch:
+		p, err := decodeDocument(patch)
+		if err != nil {
+			return fmt.Errorf("invalid merge patch: %w", err)
+		}
+		apply = func(doc interface{}) (interface{}, error) { return mergePatch(doc, p), nil }
+	default:
+		return fmt.Errorf("unknown patch mode %v", mode)
+	}
+
+	return d.update(collection, resource, func(current json.RawMessage, found bool) (interface{}, error) {
+		if !found {
+			return nil, notFound(collection, resource, fs.ErrNotExist)
+		}
+		doc, err := decodeDocument(current)
+		if err != nil {
+			return nil, err
+		}
+		return apply(doc)
+	})
+}
+
+// mergePatch applies an RFC 7386 merge patch to doc
+func mergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	target, ok := doc.(map[string]interface{})
+	if !ok {
+		target = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(target, k)
+		} else {
+			target[k] = mergePatch(target[k], v)
+		}
+	}
+	return target
+}
+
+// applyJSONPatch applies the operations of an RFC 6902 patch to doc in
+// order, returning the patched document
+func applyJSONPatch(doc interface{}, ops []patchOp) (interface{}, error) {
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, fmt.Errorf("invalid JSON patch operation %d - missing path", i)
+		}
+		path, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("invalid JSON patch operation %d - %s needs a value", i, op.Op)
+			}
+			if value, err = decodeDocument(op.Value); err != nil {
+				return nil, err
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, fmt.Errorf("invalid JSON patch operation %d - %s needs from", i, op.Op)
+			}
+			from, err := parsePointer(*op.From)
+			if err != nil {
+				return nil, err
+			}
+			if value, err = pointerGet(doc, from); err != nil {
+				return nil, err
+			}
+			if op.Op == "copy" {
+				value = deepCopy(value)
+			} else {
+				if isPrefix(from, path) && len(from) < len(path) {
+					return nil, fmt.Errorf("unable to move %s into itself", *op.From)
+				}
+				if doc, err = pointerRemove(doc, from); err != nil {
+					return nil, err
+				}
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("invalid JSON patch operation %d - unknown op %q", i, op.Op)
+		}
+
+		switch op.Op {
+		case "add", "move", "copy":
+			doc, err = pointerAdd(doc, path, value)
+		case "remove":
+			doc, err = pointerRemove(doc, path)
+		case "replace":
+			if len(path) == 0 {
+				doc = value
+			} else if doc, err = pointerRemove(doc, path); err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "test":
+			var actual interface{}
+			if actual, err = pointerGet(doc, path); err == nil && !jsonEqual(actual, value) {
+				err = fmt.Errorf("%w at %s", ErrPatchTestFailed, *op.Path)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q - must start with /", p)
+	}
+
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses an array index token; "-" and n == len are only valid
+// when adding
+func arrayIndex(token string, n int, adding bool) (int, error) {
+	if token == "-" && adding {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (i == n && !adding) || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q for an array of %d", token, n)
+	}
+	return i, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("unable to find member %q", t)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("unable to find %q in a %s", t, jsonType(doc))
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd adds v at path and returns the new document, which differs
+// from doc when the root or an array is replaced
+func pointerAdd(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	t, rest := path[0], path[1:]
+
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			c[t] = v
+			return c, nil
+		}
+		child, ok := c[t]
+		if !ok {
+			return nil, fmt.Errorf("unable to find member %q", t)
+		}
+		child, err := pointerAdd(child, rest, v)
+		c[t] = child
+		return c, err
+
+	case []interface{}:
+		i, err := arrayIndex(t, len(c), len(rest) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = v
+			return c, nil
+		}
+		child, err := pointerAdd(c[i], rest, v)
+		c[i] = child
+		return c, err
+	}
+	return nil, fmt.Errorf("unable to add %q to a %s", t, jsonType(doc))
+}
+
+// pointerRemove removes the value at path and returns the new document
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("unable to remove the whole document")
+	}
+	t, rest := path[0], path[1:]
+
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		child, ok := c[t]
+		if !ok {
+			return nil, fmt.Errorf("unable to find member %q", t)
+		}
+		if len(rest) == 0 {
+			delete(c, t)
+			return c, nil
+		}
+		child, err := pointerRemove(child, rest)
+		c[t] = child
+		return c, err
+
+	case []interface{}:
+		i, err := arrayIndex(t, len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			return append(c[:i], c[i+1:]...), nil
+		}
+		child, err := pointerRemove(c[i], rest)
+		c[i] = child
+		return c, err
+	}
+	return nil, fmt.Errorf("unable to remove %q from a %s", t, jsonType(doc))
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(c))
+		for k, child := range c {
+			out[k] = deepCopy(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(c))
+		for i, child := range c {
+			out[i] = deepCopy(child)
+		}
+		return out
+	}
+	return v
+}
+
+// jsonEqual compares decoded JSON values, numbers by value
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return equalValues(a, b)
+}
@@ -0,0 +1,98 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	const doc = `{"name": "Ada", "tags": ["math", "engines"], "address": {"city": "London"}, "age": 36}`
+
+	tests := []struct {
+		name    string
+		mode    PatchMode
+		patch   string
+		want    string // the whole record when the patch applies
+		wantErr error
+	}{
+		{"add member", JSONPatch, `[{"op": "add", "path": "/nickname", "value": "ada"}]`,
+			`{"name": "Ada", "tags": ["math", "engines"], "address": {"city": "London"}, "age": 36, "nickname": "ada"}`, nil},
+		{"add array element", JSONPatch, `[{"op": "add", "path": "/tags/1", "value": "poetry"}]`,
+			`{"name": "Ada", "tags": ["math", "poetry", "engines"], "address": {"city": "London"}, "age": 36}`, nil},
+		{"append array element", JSONPatch, `[{"op": "add", "path": "/tags/-", "value": "poetry"}]`,
+			`{"name": "Ada", "tags": ["math", "engines", "poetry"], "address": {"city": "London"}, "age": 36}`, nil},
+		{"add null", JSONPatch, `[{"op": "add", "path": "/nickname", "value": null}]`,
+			`{"name": "Ada", "tags": ["math", "engines"], "address": {"city": "London"}, "age": 36, "nickname": null}`, nil},
+		{"replace with null", JSONPatch, `[{"op": "replace", "path": "/address", "value": null}]`,
+			`{"name": "Ada", "tags": ["math", "engines"], "address": null, "age": 36}`, nil},
+		{"test null", JSONPatch, `[{"op": "add", "path": "/x", "value": null}, {"op": "test", "path": "/x", "value": null}, {"op": "remove", "path": "/x"}]`,
+			doc, nil},
+		{"remove", JSONPatch, `[{"op": "remove", "path": "/tags/0"}, {"op": "remove", "path": "/age"}]`,
+			`{"name": "Ada", "tags": ["engines"], "address": {"city": "London"}}`, nil},
+		{"replace nested", JSONPatch, `[{"op": "replace", "path": "/address/city", "value": "Paris"}]`,
+			`{"name": "Ada", "tags": ["math", "engines"], "address": {"city": "Paris"}, "age": 36}`, nil},
+		{"move", JSONPatch, `[{"op": "move", "from": "/address/city", "path": "/city"}]`,
+			`{"name": "Ada", "tags": ["math", "engines"], "address": {}, "age": 36, "city": "London"}`, nil},
+		{"copy", JSONPatch, `[{"op": "copy", "from": "/address", "path": "/home"}, {"op": "replace", "path": "/home/city", "value": "Paris"}]`,
+			`{"name": "Ada", "tags": ["math", "engines"], "address": {"city": "London"}, "age": 36, "home": {"city": "Paris"}}`, nil},
+		{"test numbers by value", JSONPatch, `[{"op": "test", "path": "/age", "value": 36.0}]`, doc, nil},
+		{"escaped pointer", JSONPatch, `[{"op": "add", "path": "/a~1b~0c", "value": 1}]`,
+			`{"name": "Ada", "tags": ["math", "engines"], "address": {"city": "London"}, "age": 36, "a/b~c": 1}`, nil},
+
+		{"failed test applies nothing", JSONPatch, `[{"op": "remove", "path": "/age"}, {"op": "test", "path": "/name", "value": "Bob"}]`, "", ErrPatchTestFailed},
+		{"missing value", JSONPatch, `[{"op": "add", "path": "/x"}]`, "", ErrInvalidPatch},
+		{"missing path", JSONPatch, `[{"op": "remove"}]`, "", ErrInvalidPatch},
+		{"missing from", JSONPatch, `[{"op": "move", "path": "/x"}]`, "", ErrInvalidPatch},
+		{"unknown op", JSONPatch, `[{"op": "frob", "path": "/x"}]`, "", ErrInvalidPatch},
+		{"missing member", JSONPatch, `[{"op": "replace", "path": "/nickname", "value": 1}]`, "", ErrInvalidPatch},
+		{"array index out of range", JSONPatch, `[{"op": "add", "path": "/tags/3", "value": 1}]`, "", ErrInvalidPatch},
+		{"leading zero index", JSONPatch, `[{"op": "remove", "path": "/tags/01"}]`, "", ErrInvalidPatch},
+		{"move into itself", JSONPatch, `[{"op": "move", "from": "/address", "path": "/address/old"}]`, "", ErrInvalidPatch},
+		{"pointer without a slash", JSONPatch, `[{"op": "remove", "path": "age"}]`, "", ErrInvalidPatch},
+
+		{"merge", MergePatch, `{"age": 37, "address": {"zip": "N1"}, "tags": null}`,
+			`{"name": "Ada", "address": {"city": "London", "zip": "N1"}, "age": 37}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDriver(t, nil)
+			if err := d.Write("users", "ada", json.RawMessage(doc)); err != nil {
+				t.Fatal(err)
+			}
+
+			err := d.Patch("users", "ada", []byte(tt.patch), tt.mode)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Patch() = %v, want %v", err, tt.wantErr)
+			}
+			want := tt.want
+			if tt.wantErr != nil {
+				want = doc
+			}
+
+			var got json.RawMessage
+			if err := d.Read("users", "ada", &got); err != nil {
+				t.Fatal(err)
+			}
+			g, err := decodeDocument(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, err := decodeDocument([]byte(want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(g, w) {
+				t.Errorf("record after Patch() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+
+	t.Run("missing record", func(t *testing.T) {
+		d, _ := newTestDriver(t, nil)
+		err := d.Patch("users", "ada", []byte(`[{"op": "remove", "path": "/age"}]`), JSONPatch)
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Patch() of a missing record = %v, want ErrNotFound", err)
+		}
+	})
+}
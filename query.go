@@ -0,0 +1,268 @@
+package jsondb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Operator compares a record field with a Condition value
+type Operator string
+
+const (
+	Eq  Operator = "=="
+	Ne  Operator = "!="
+	Lt  Operator = "<"
+	Lte Operator = "<="
+	Gt  Operator = ">"
+	Gte Operator = ">="
+	In  Operator = "in" // Value is a slice; matches any element
+)
+
+// Condition matches records whose field at the dotted path Field compares
+// to Value with Op. Numbers compare numerically and strings lexically;
+// values of different JSON types are never ordered, so only Ne matches them.
+// A record missing the field matches no condition.
+type Condition struct {
+	Field string
+	Op    Operator
+	Value interface{}
+}
+
+// Query selects the records matching all of its conditions; the empty Query
+// matches every record. Build one with Where and And, or as a literal.
+type Query struct {
+	Conditions []Condition
+}
+
+// Where starts a query with a single condition
+func Where(field string, op Operator, value interface{}) Query {
+	return Query{}.And(field, op, value)
+}
+
+// And returns q with one more condition
+func (q Query) And(field string, op Operator, value interface{}) Query {
+	conds := append(append([]Condition(nil), q.Conditions...), Condition{field, op, value})
+	return Query{Conditions: conds}
+}
+
+// conditionOperators are tried longest first, so "<=" isn't read as "<"
+var conditionOperators = []Operator{Eq, Ne, Lte, Gte, Lt, Gt}
+
+// ParseCondition parses a condition written as a field, an operator and a
+// value, such as "Age>=30" or `Tag in ["a","b"]` (in needs spaces around
+// it). The value is parsed as JSON when it is valid JSON, and taken as a
+// string otherwise, so Name==Ann and Name=="Ann" are the same condition.
+func ParseCondition(s string) (Condition, error) {
+	if field, value, ok := strings.Cut(s, " "+string(In)+" "); ok {
+		return parsedCondition(field, In, value)
+	}
+
+	op, at := Operator(""), -1
+	for _, o := range conditionOperators {
+		if i := strings.Index(s, string(o)); i > 0 && (at < 0 || i < at) {
+			op, at = o, i
+		}
+	}
+	if at < 0 {
+		return Condition{}, fmt.Errorf("invalid condition %q - expected a field, an operator and a value", s)
+	}
+	return parsedCondition(s[:at], op, s[at+len(op):])
+}
+
+func parsedCondition(field string, op Operator, value string) (Condition, error) {
+	field, value = strings.TrimSpace(field), strings.TrimSpace(value)
+	if field == "" {
+		return Condition{}, fmt.Errorf("invalid condition - missing field")
+	}
+
+	var v interface{} = value
+	if json.Valid([]byte(value)) {
+		v = json.RawMessage(value)
+	}
+	return Condition{field, op, v}, nil
+}
+
+// Find returns the records of a collection matching query, in listing
+// order. When a condition is Eq or In on an indexed field (see CreateIndex)
+// only the records the index names are read; otherwise every record is.
+// Records are decoded one at a time, so only the matches are held in memory.
+// A missing collection has no matches.
+func (d *Driver) Find(collection string, query Query) (records []json.RawMessage, err error) {
+	defer d.done(OpFind, collection, "", time.Now(), &err)
+	return d.find(context.Background(), collection, query)
+}
+
+func (d *Driver) find(ctx context.Context, collection string, query Query) (records []json.RawMessage, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to find records", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := d.requireJSON("Find"); err != nil {
+		return nil, err
+	}
+
+	if err := d.beforeRead(collection, ""); err != nil {
+		return nil, err
+	}
+	defer func() { d.afterRead(collection, "", &records, err) }()
+
+	conds, err := normalizeConditions(query.Conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	names, indexed, err := d.indexedCandidates(collection, conds)
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		if names, err = d.resourceNames(collection); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue // deleted since the listing
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %v/%v: %w", collection, name, err)
+		}
+		if matchConditions(doc, conds) {
+			records = append(records, json.RawMessage(b))
+		}
+	}
+
+	return records, nil
+}
+
+// normalizeConditions checks the conditions and round-trips their values
+// through JSON, so they compare like the decoded record fields
+func normalizeConditions(conds []Condition) ([]Condition, error) {
+	out := make([]Condition, len(conds))
+	for i, c := range conds {
+		if c.Field == "" {
+			return nil, fmt.Errorf("missing field - unable to query (condition %d)", i)
+		}
+		switch c.Op {
+		case Eq, Ne, Lt, Lte, Gt, Gte, In:
+		default:
+			return nil, fmt.Errorf("unknown operator %q in condition on %v", c.Op, c.Field)
+		}
+
+		b, err := json.Marshal(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode value of condition on %v: %w", c.Field, err)
+		}
+		v, err := decodeDocument(b)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.([]interface{}); c.Op == In && !ok {
+			return nil, fmt.Errorf("invalid value of condition on %v - %s needs a slice, got %T", c.Field, In, c.Value)
+		}
+
+		out[i] = Condition{c.Field, c.Op, v}
+	}
+	return out, nil
+}
+
+func matchConditions(doc interface{}, conds []Condition) bool {
+	for _, c := range conds {
+		v, ok := lookupPath(doc, c.Field)
+		if !ok || !matchCondition(v, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchCondition(v interface{}, c Condition) bool {
+	switch c.Op {
+	case Eq:
+		return equalValues(v, c.Value)
+	case Ne:
+		return !equalValues(v, c.Value)
+	case In:
+		for _, elem := range c.Value.([]interface{}) {
+			if equalValues(v, elem) {
+				return true
+			}
+		}
+		return false
+	}
+
+	cmp, ok := compareValues(v, c.Value)
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case Lt:
+		return cmp < 0
+	case Lte:
+		return cmp <= 0
+	case Gt:
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func equalValues(a, b interface{}) bool {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues orders two numbers or two strings; other pairs aren't
+// ordered
+func compareValues(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		if errA != nil || errB != nil {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	}
+	return 0, false
+}
@@ -0,0 +1,315 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// refField is the only member of a reference to another record
+const refField = "$ref"
+
+// ErrReferenced is wrapped by the error of a Delete or SoftDelete refused by
+// ReferenceRestrict
+var ErrReferenced = errors.New("record is referenced")
+
+// Ref is a field value referencing a record, stored as
+// {"$ref": "companies/google"}: the collection, which may be nested, and
+// the resource joined by a slash. ReadPopulated replaces references with the
+// records they name.
+type Ref struct {
+	Ref string `json:"$ref"`
+}
+
+// NewRef returns the reference to a record
+func NewRef(collection, resource string) Ref {
+	return Ref{Ref: collection + "/" + resource}
+}
+
+// Target splits a reference into the collection and resource it names
+func (r Ref) Target() (collection, resource string) {
+	return path.Dir(r.Ref), path.Base(r.Ref)
+}
+
+// ReferencePolicy selects what deleting a record other records reference
+// does, set per referenced collection in CollectionOptions.References
+type ReferencePolicy int
+
+const (
+	// ReferenceIgnore deletes the record, leaving the references to it
+	// dangling
+	ReferenceIgnore ReferencePolicy = iota
+
+	// ReferenceRestrict fails the delete with ErrReferenced while any record
+	// references it
+	ReferenceRestrict
+
+	// ReferenceCascade deletes the referencing records first, as their own
+	// collection's policy allows
+	ReferenceCascade
+)
+
+func (p ReferencePolicy) String() string {
+	switch p {
+	case ReferenceIgnore:
+		return "ignore"
+	case ReferenceRestrict:
+		return "restrict"
+	case ReferenceCascade:
+		return "cascade"
+	}
+	return fmt.Sprintf("ReferencePolicy(%d)", int(p))
+}
+
+// PopulateOptions tune ReadPopulated
+type PopulateOptions struct {
+	// Depth is how many levels of references are resolved: 1 replaces the
+	// references of the record, 2 those of the records it references too.
+	// Zero means 1. Deeper references are left as they are, which also ends
+	// reference cycles.
+	Depth int
+
+	// IgnoreMissing leaves references to missing records as they are,
+	// instead of failing the read
+	IgnoreMissing bool
+}
+
+// ReadPopulated decodes a record into v like Read, with every reference in
+// it, however deeply nested, replaced by the record it names, so v's field
+// for a reference has the referenced record's type. It requires the json
+// Format.
+func (d *Driver) ReadPopulated(collection, resource string, v interface{}, opts PopulateOptions) (err error) {
+	defer d.done(OpReadPopulated, collection, resource, time.Now(), &err)
+
+	if err := d.requireJSON("ReadPopulated"); err != nil {
+		return err
+	}
+	if opts.Depth < 0 {
+		return fmt.Errorf("invalid depth %d - must not be negative", opts.Depth)
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 1
+	}
+
+	var raw json.RawMessage
+	if err := d.Read(collection, resource, &raw); err != nil {
+		return err
+	}
+	doc, err := decodeDocument(raw)
+	if err != nil {
+		return fmt.Errorf("unable to decode %v/%v: %w", collection, resource, err)
+	}
+	if doc, err = d.populate(doc, opts.Depth, opts); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return d.decode(b, v)
+}
+
+// populate replaces the references in a decoded value with their records,
+// depth levels deep
+func (d *Driver) populate(v interface{}, depth int, opts PopulateOptions) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := asRef(v); ok {
+			collection, resource := ref.Target()
+			b, err := d.readRef(collection, resource)
+			if errors.Is(err, os.ErrNotExist) && opts.IgnoreMissing {
+				return v, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("unable to populate %s: %w", ref.Ref, notFound(collection, resource, err))
+			}
+			target, err := decodeDocument(b)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode %s: %w", ref.Ref, err)
+			}
+			if depth == 1 {
+				return target, nil
+			}
+			return d.populate(target, depth-1, opts)
+		}
+		for k, child := range v {
+			child, err := d.populate(child, depth, opts)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = child
+		}
+	case []interface{}:
+		for i, child := range v {
+			child, err := d.populate(child, depth, opts)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = child
+		}
+	}
+	return v, nil
+}
+
+// readRef reads the record a reference names, which must be a valid name
+func (d *Driver) readRef(collection, resource string) ([]byte, error) {
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return nil, err
+	}
+	return d.readRaw(collection, resource)
+}
+
+// asRef reports whether a decoded object is a reference
+func asRef(obj map[string]interface{}) (Ref, bool) {
+	if len(obj) != 1 {
+		return Ref{}, false
+	}
+	s, ok := obj[refField].(string)
+	if !ok || path.Dir(s) == "." {
+		return Ref{}, false
+	}
+	return Ref{Ref: s}, true
+}
+
+// hasRef reports whether a decoded value holds a reference to target
+func hasRef(v interface{}, target string) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := asRef(v); ok {
+			return ref.Ref == target
+		}
+		for _, child := range v {
+			if hasRef(child, target) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if hasRef(child, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// referrers returns the records of the database holding a reference to a
+// record, as collection/resource paths. It reads every record.
+func (d *Driver) referrers(collection, resource string) ([]string, error) {
+	collections, err := d.Collections()
+	if err != nil {
+		return nil, err
+	}
+
+	target := collection + "/" + resource
+	var found []string
+	for _, c := range collections {
+		names, err := d.resourceNames(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if c == collection && name == resource {
+				continue
+			}
+			b, err := d.readRaw(c, name)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			doc, err := decodeDocument(b)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode %v/%v: %w", c, name, err)
+			}
+			if hasRef(doc, target) {
+				found = append(found, c+"/"+name)
+			}
+		}
+	}
+	return found, nil
+}
+
+// releaseReferences applies the References policy of a collection before
+// one of its records is deleted: it fails if the record is still referenced
+// under ReferenceRestrict, and deletes the referencing records under
+// ReferenceCascade, all or none of them going by their own policies. It
+// must be called without holding any collection mutex.
+func (d *Driver) releaseReferences(collection, resource string, trash bool) error {
+	if d.collections[collection].References == ReferenceIgnore {
+		return nil
+	}
+	if _, err := d.backend.Stat(filepath.Join(d.dir, collection, resource+d.ext)); err != nil {
+		return nil // the delete reports it
+	}
+	var cascade []string
+	if err := d.planDelete(collection, resource, map[string]bool{collection + "/" + resource: true}, &cascade); err != nil {
+		return err
+	}
+
+	for _, p := range cascade {
+		c, r := Ref{Ref: p}.Target()
+		if err := d.deleteReferrer(c, r, trash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planDelete adds the records deleting a record cascades to, those deleted
+// first ahead of the ones they reference, to cascade
+func (d *Driver) planDelete(collection, resource string, seen map[string]bool, cascade *[]string) error {
+	policy := d.collections[collection].References
+	if policy == ReferenceIgnore {
+		return nil
+	}
+
+	referrers, err := d.referrers(collection, resource)
+	if err != nil {
+		return err
+	}
+	for _, p := range referrers {
+		if seen[p] {
+			continue
+		}
+		if policy == ReferenceRestrict {
+			return fmt.Errorf("%w: unable to delete %v/%v - %v references it", ErrReferenced, collection, resource, p)
+		}
+		seen[p] = true
+		c, r := Ref{Ref: p}.Target()
+		if err := d.planDelete(c, r, seen, cascade); err != nil {
+			return err
+		}
+		*cascade = append(*cascade, p)
+	}
+	return nil
+}
+
+// deleteReferrer deletes a record as part of a cascade, with the delete
+// hooks but no policy checks of its own
+func (d *Driver) deleteReferrer(collection, resource string, trash bool) (err error) {
+	if err := d.beforeDelete(collection, resource); err != nil {
+		return err
+	}
+	defer func() { d.afterDelete(collection, resource, err) }()
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := d.backend.Stat(filepath.Join(d.dir, collection, resource+d.ext)); err != nil {
+		return nil // deleted since the plan
+	}
+	return d.deleteRecord(collection, resource, trash)
+}
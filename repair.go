@@ -0,0 +1,219 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// corruptedDir is the subdirectory of a collection that ScanAndRepair moves
+// unreadable records into. Like every directory it is skipped by ReadAll.
+const corruptedDir = ".corrupted"
+
+// RepairKind says what ScanAndRepair did about a problem
+type RepairKind int
+
+const (
+	RemovedTempFile RepairKind = iota
+	QuarantinedRecord
+	PrunedIndexEntry
+)
+
+func (k RepairKind) String() string {
+	switch k {
+	case RemovedTempFile:
+		return "removed temp file"
+	case QuarantinedRecord:
+		return "quarantined record"
+	case PrunedIndexEntry:
+		return "pruned index entry"
+	}
+	return fmt.Sprintf("RepairKind(%d)", int(k))
+}
+
+// RepairAction is one fix made by ScanAndRepair
+type RepairAction struct {
+	Kind     RepairKind
+	Path     string // file removed, moved or rewritten
+	Resource string // empty for temp files
+	Problem  string
+}
+
+// RepairReport lists every fix made by ScanAndRepair, in the order they were
+// made; it is empty when the collection was consistent
+type RepairReport struct {
+	Collection string
+	Actions    []RepairAction
+}
+
+// ScanAndRepair checks a collection for the leftovers of interrupted or
+// corrupted operations and fixes them: temp files of writes that never
+// completed are removed, records that aren't valid JSON are moved into the
+// collection's .corrupted subdirectory, and append-log index entries that
+// don't match the log are pruned by rewriting the index. Records are only
+// validated with the JSON format. The collection is locked throughout.
+func (d *Driver) ScanAndRepair(collection string) (_ *RepairReport, err error) {
+	defer d.done(OpScanAndRepair, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to repair", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	report := &RepairReport{Collection: collection}
+	if d.storage == StorageAppendLog {
+		return report, d.repairLog(collection, report)
+	}
+	return report, d.repairFiles(collection, report)
+}
+
+// repairFiles fixes the record files of a collection. The caller must hold
+// the collection mutex.
+func (d *Driver) repairFiles(collection string, report *RepairReport) error {
+	dir := filepath.Join(d.dir, collection)
+	files, err := d.backend.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		name := file.Name()
+		path := filepath.Join(dir, name)
+
+		if strings.HasSuffix(name, d.ext+d.tmpSuffix) {
+			if err := d.backend.Remove(path); err != nil {
+				return err
+			}
+			report.Actions = append(report.Actions, RepairAction{
+				Kind:    RemovedTempFile,
+				Path:    path,
+				Problem: "write never completed",
+			})
+			continue
+		}
+
+		if d.format != FormatJSON || filepath.Ext(name) != d.ext {
+			continue
+		}
+
+		problem := "invalid JSON"
+		b, err := d.readFile(path)
+		if errors.Is(err, ErrDecrypt) {
+			problem = "unable to decrypt"
+		} else if errors.Is(err, errDecompress) {
+			problem = "unable to decompress"
+		} else if err != nil {
+			return err
+		} else if json.Valid(b) {
+			continue
+		}
+
+		resource := strings.TrimSuffix(name, d.ext)
+		dst := filepath.Join(dir, corruptedDir, name)
+		if err := d.backend.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := d.backend.Rename(path, dst); err != nil {
+			return err
+		}
+		d.blooms.removed(collection, resource)
+		d.indexRecord(collection, resource, nil)
+		d.changed(Deleted, collection, resource, nil)
+		report.Actions = append(report.Actions, RepairAction{
+			Kind:     QuarantinedRecord,
+			Path:     dst,
+			Resource: resource,
+			Problem:  problem,
+		})
+	}
+
+	return nil
+}
+
+// repairLog fixes the log and index files of an append-log collection. The
+// log itself needs no repair: scanLog already ignores a torn last entry. The
+// caller must hold the collection mutex.
+func (d *Driver) repairLog(collection string, report *RepairReport) error {
+	for _, path := range []string{d.logPath(collection), d.idxPath(collection)} {
+		tmp := path + d.tmpSuffix
+		err := d.backend.Remove(tmp)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		report.Actions = append(report.Actions, RepairAction{
+			Kind:    RemovedTempFile,
+			Path:    tmp,
+			Problem: "write never completed",
+		})
+	}
+
+	stored, err := d.readIdxFile(d.idxPath(collection))
+	if os.IsNotExist(err) {
+		return nil // built from the log on the next seek
+	}
+	if err != nil {
+		return err
+	}
+
+	actual := make(map[string]int64)
+	err = d.scanLog(collection, func(off int64, e logEntry) error {
+		if e.Deleted {
+			delete(actual, e.Key)
+		} else {
+			actual[e.Key] = off
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	pruned := false
+	for _, resource := range sortedKeys(stored) {
+		offset, ok := actual[resource]
+		if ok && offset == stored[resource] {
+			continue
+		}
+		problem := "record does not exist"
+		if ok {
+			problem = fmt.Sprintf("offset %d is not the latest entry", stored[resource])
+		}
+		report.Actions = append(report.Actions, RepairAction{
+			Kind:     PrunedIndexEntry,
+			Path:     d.idxPath(collection),
+			Resource: resource,
+			Problem:  problem,
+		})
+		pruned = true
+	}
+	if !pruned {
+		return nil
+	}
+
+	if err := d.dropLogIndex(collection); err != nil {
+		return err
+	}
+	_, err = d.loadLogIndex(collection)
+	return err
+}
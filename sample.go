@@ -0,0 +1,59 @@
+package jsondb
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// RandSample returns min(n, count) records of a collection chosen uniformly
+// at random, using Vitter's reservoir sampling (algorithm R) over the sorted
+// record list. A record is only read when it enters the reservoir, so no
+// more than n records are held in memory at once.
+func (d *Driver) RandSample(collection string, n int) (sample []string, err error) {
+	defer d.done(OpRandSample, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to sample records", ErrEmptyCollection)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("invalid sample size %d - must not be negative", n)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, err
+	}
+
+	names, err := d.resourceNames(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := 0
+	for _, name := range names {
+		slot := seen
+		if seen >= n {
+			if slot = rand.Intn(seen + 1); slot >= n {
+				seen++
+				continue
+			}
+		}
+
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue // deleted since the listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		seen++
+
+		if slot < len(sample) {
+			sample[slot] = string(b)
+		} else {
+			sample = append(sample, string(b))
+		}
+	}
+
+	return sample, nil
+}
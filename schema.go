@@ -0,0 +1,222 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SchemaChange is sent by WatchSchema when a written record introduces a new
+// field or changes the type of a field already seen in the collection.
+// OldType is empty for new fields.
+type SchemaChange struct {
+	Collection string
+	Resource   string
+	Field      string
+	OldType    string
+	NewType    string
+}
+
+// schemaWatchers keeps the last-seen schema of every watched collection
+// together with the channels subscribed to it
+type schemaWatchers struct {
+	mutex    sync.Mutex
+	next     int
+	watchers map[string]map[int]chan SchemaChange
+	known    map[string]map[string]string
+}
+
+func newSchemaWatchers() *schemaWatchers {
+	return &schemaWatchers{
+		watchers: make(map[string]map[int]chan SchemaChange),
+		known:    make(map[string]map[string]string),
+	}
+}
+
+// WatchSchema emits a SchemaChange whenever a Write to collection carries a
+// field that wasn't seen before or whose type differs from the last-seen one.
+// The baseline schema is inferred from the records already in the collection.
+// Call the returned func to stop watching; it closes the channel.
+func (d *Driver) WatchSchema(collection string) (_ <-chan SchemaChange, _ func(), err error) {
+	defer d.done(OpWatchSchema, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, nil, fmt.Errorf("%w - unable to watch schema", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, nil, err
+	}
+	if err := d.requireJSON("WatchSchema"); err != nil {
+		return nil, nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	s := d.schemas
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.known[collection]; !ok {
+		known, err := d.collectionSchema(collection)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.known[collection] = known
+		s.watchers[collection] = make(map[int]chan SchemaChange)
+	}
+
+	id := s.next
+	s.next++
+	ch := make(chan SchemaChange, 16)
+	s.watchers[collection][id] = ch
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			delete(s.watchers[collection], id)
+			close(ch)
+			if len(s.watchers[collection]) == 0 {
+				delete(s.watchers, collection)
+				delete(s.known, collection)
+			}
+		})
+	}
+
+	return ch, stop, nil
+}
+
+// collectionSchema unions the fields of every record currently stored in the
+// collection; a missing collection simply has an empty schema
+func (d *Driver) collectionSchema(collection string) (map[string]string, error) {
+	known := make(map[string]string)
+
+	records, err := d.ReadAll(collection)
+	if errors.Is(err, fs.ErrNotExist) {
+		return known, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		fields, err := inferFields([]byte(record))
+		if err != nil {
+			return nil, err
+		}
+		for field, typ := range fields {
+			known[field] = typ
+		}
+	}
+
+	return known, nil
+}
+
+// observe compares a freshly written record against the last-seen schema and
+// notifies the watchers of every difference. It never blocks the writer: if a
+// watcher isn't keeping up the event is dropped.
+func (s *schemaWatchers) observe(log *slog.Logger, collection, resource string, b []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	known, ok := s.known[collection]
+	if !ok {
+		return
+	}
+
+	fields, err := inferFields(b)
+	if err != nil {
+		log.Warn("Unable to infer schema", "collection", collection, "resource", resource, "error", err)
+		return
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	for _, field := range names {
+		typ := fields[field]
+		old, seen := known[field]
+		if seen && old == typ {
+			continue
+		}
+		known[field] = typ
+
+		change := SchemaChange{
+			Collection: collection,
+			Resource:   resource,
+			Field:      field,
+			OldType:    old,
+			NewType:    typ,
+		}
+		for _, ch := range s.watchers[collection] {
+			select {
+			case ch <- change:
+			default:
+				log.Warn("Dropped schema change, watcher is full", "collection", collection, "field", field)
+			}
+		}
+	}
+}
+
+// inferFields flattens a JSON document into dotted field paths mapped to their
+// JSON type. null values carry no type information and are left out.
+func inferFields(b []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string)
+	flattenFields("", v, fields)
+	return fields, nil
+}
+
+func flattenFields(prefix string, v interface{}, fields map[string]string) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		if typ := jsonType(v); prefix != "" && typ != "null" {
+			fields[prefix] = typ
+		}
+		return
+	}
+
+	if prefix != "" {
+		fields[prefix] = "object"
+		prefix += "."
+	}
+	for k, child := range obj {
+		flattenFields(prefix+k, child, fields)
+	}
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
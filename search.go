@@ -0,0 +1,380 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// searchFile is the full-text index of a collection in its indexDir. The
+// first line is the JSON array of the searched fields, every other line
+// "<resource>\t<tokens>" with the record's tokens separated by spaces, as
+// often as they occur. A line without tokens records that the resource was
+// deleted. The last line of a resource wins, as in the .idx files.
+const searchFile = "search.fts"
+
+// searchIndex maps the tokens of the searched fields of a collection's
+// records to the resources holding them
+type searchIndex struct {
+	fields    []string
+	postings  map[string]map[string]int // token -> resource -> occurrences
+	resources map[string][]string       // resource -> its distinct tokens
+	sorted    []string                  // the tokens in order, nil when stale
+}
+
+func newSearchIndex(fields []string) *searchIndex {
+	return &searchIndex{
+		fields:    fields,
+		postings:  make(map[string]map[string]int),
+		resources: make(map[string][]string),
+	}
+}
+
+// set replaces the tokens of a resource; none removes it
+func (x *searchIndex) set(resource string, tokens []string) {
+	for _, t := range x.resources[resource] {
+		delete(x.postings[t], resource)
+		if len(x.postings[t]) == 0 {
+			delete(x.postings, t)
+			x.sorted = nil
+		}
+	}
+	delete(x.resources, resource)
+	if len(tokens) == 0 {
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, t := range tokens {
+		counts[t]++
+	}
+	for t, n := range counts {
+		if x.postings[t] == nil {
+			x.postings[t] = make(map[string]int)
+			x.sorted = nil
+		}
+		x.postings[t][resource] = n
+	}
+	x.resources[resource] = sortedKeys(counts)
+}
+
+// withPrefix returns the tokens starting with prefix
+func (x *searchIndex) withPrefix(prefix string) []string {
+	if x.sorted == nil {
+		x.sorted = sortedKeys(x.postings)
+	}
+	i := sort.SearchStrings(x.sorted, prefix)
+	j := i
+	for j < len(x.sorted) && strings.HasPrefix(x.sorted[j], prefix) {
+		j++
+	}
+	return x.sorted[i:j]
+}
+
+// searchIndexes caches the full-text indexes of the collections, loaded from
+// disk on first use; a loaded collection without one maps to nil. The map is
+// guarded by mutex; each index is only read or changed under its collection
+// mutex.
+type searchIndexes struct {
+	mutex       sync.Mutex
+	collections map[string]*searchIndex
+}
+
+func (d *Driver) searchPath(collection string) string {
+	return filepath.Join(d.dir, collection, indexDir, searchFile)
+}
+
+// tokenize splits text into lowercase runs of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// recordTokens returns the tokens of the strings a record holds at the
+// searched fields, directly or in an array
+func recordTokens(doc interface{}, fields []string) []string {
+	var tokens []string
+	for _, field := range fields {
+		v, ok := lookupPath(doc, field)
+		if !ok {
+			continue
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				tokens = append(tokens, tokenize(s)...)
+			}
+		}
+	}
+	return tokens
+}
+
+// EnableSearch builds a full-text index of a collection over the strings at
+// the dotted field paths, replacing the one it may have, for Search. The
+// index is kept up to date by every write and delete of the collection.
+// The index file holds the words of the records in the clear, so it fails
+// when Options.Encryption is set.
+func (d *Driver) EnableSearch(collection string, fields []string) (err error) {
+	defer d.done(OpEnableSearch, collection, "", time.Now(), &err)
+
+	if err := d.checkSearch(collection); err != nil {
+		return err
+	}
+	if err := d.requirePlain("search indexes"); err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("missing fields - unable to enable search on %v", collection)
+	}
+	for _, f := range fields {
+		if f == "" {
+			return fmt.Errorf("missing field - unable to enable search on %v", collection)
+		}
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	x, err := d.buildSearch(collection, append([]string(nil), fields...))
+	if err != nil {
+		return err
+	}
+	d.searches.mutex.Lock()
+	d.searches.collections[collection] = x
+	d.searches.mutex.Unlock()
+	return nil
+}
+
+// DisableSearch removes the full-text index of a collection
+func (d *Driver) DisableSearch(collection string) (err error) {
+	defer d.done(OpDisableSearch, collection, "", time.Now(), &err)
+
+	if err := d.checkSearch(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.backend.Remove(d.searchPath(collection)); err != nil {
+		return fmt.Errorf("unable to find search index of %v: %w", collection, err)
+	}
+	d.searches.mutex.Lock()
+	d.searches.collections[collection] = nil
+	d.searches.mutex.Unlock()
+	return nil
+}
+
+// Search returns the resources of a collection holding every word of query
+// in the fields EnableSearch indexed, best match first. Words are compared
+// case-insensitively and each matches the words it is a prefix of, so
+// "goog" finds "Google". Matches rank by how often the words occur, with rare
+// words weighing more than common ones and whole words more than prefixes;
+// ties are in name order. An empty query matches nothing.
+func (d *Driver) Search(collection, query string) (resources []string, err error) {
+	defer d.done(OpSearch, collection, "", time.Now(), &err)
+
+	if err := d.checkSearch(collection); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	x, err := d.loadSearch(collection)
+	if err != nil {
+		return nil, err
+	}
+	if x == nil {
+		return nil, fmt.Errorf("unable to search %v - search is not enabled, see EnableSearch", collection)
+	}
+
+	words := tokenize(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	var scores map[string]float64
+	total := float64(len(x.resources))
+	for _, word := range words {
+		found := make(map[string]float64)
+		for _, token := range x.withPrefix(word) {
+			postings := x.postings[token]
+			weight := math.Log(1 + total/float64(len(postings)))
+			if token != word {
+				weight /= 2
+			}
+			for resource, n := range postings {
+				found[resource] += float64(n) * weight
+			}
+		}
+
+		if scores == nil {
+			scores = found
+			continue
+		}
+		for resource := range scores {
+			if s, ok := found[resource]; ok {
+				scores[resource] += s
+			} else {
+				delete(scores, resource)
+			}
+		}
+	}
+
+	resources = sortedKeys(scores)
+	sort.SliceStable(resources, func(i, j int) bool { return scores[resources[i]] > scores[resources[j]] })
+	return resources, nil
+}
+
+func (d *Driver) checkSearch(collection string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to search", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.requireJSON("search"); err != nil {
+		return err
+	}
+	return d.requireFiles("search")
+}
+
+// loadSearch returns the full-text index of a collection, nil if it has
+// none, reading it from disk the first time. The caller must hold the
+// collection mutex.
+func (d *Driver) loadSearch(collection string) (*searchIndex, error) {
+	c := d.searches
+	c.mutex.Lock()
+	x, ok := c.collections[collection]
+	c.mutex.Unlock()
+	if ok {
+		return x, nil
+	}
+
+	b, err := d.backend.ReadFile(d.searchPath(collection))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		lines := bytes.Split(b, []byte("\n"))
+		var fields []string
+		if err := json.Unmarshal(lines[0], &fields); err != nil {
+			return nil, fmt.Errorf("unable to read search index of %v: %w", collection, err)
+		}
+		x = newSearchIndex(fields)
+		for _, line := range lines[1:] {
+			resource, tokens, ok := strings.Cut(string(line), "\t")
+			if !ok || resource == "" {
+				continue // blank or torn last line
+			}
+			x.set(resource, strings.Fields(tokens))
+		}
+	}
+
+	c.mutex.Lock()
+	c.collections[collection] = x
+	c.mutex.Unlock()
+	return x, nil
+}
+
+// buildSearch indexes every record of a collection on fields and writes the
+// index file. The caller must hold the collection mutex.
+func (d *Driver) buildSearch(collection string, fields []string) (*searchIndex, error) {
+	names, err := d.resourceNames(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	x := newSearchIndex(fields)
+	for _, name := range names {
+		b, err := d.readRaw(collection, name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %v/%v: %w", collection, name, err)
+		}
+		x.set(name, recordTokens(doc, fields))
+	}
+	return x, d.writeSearchFile(collection, x)
+}
+
+// writeSearchFile writes x as the index file, one line per resource
+func (d *Driver) writeSearchFile(collection string, x *searchIndex) error {
+	b, err := json.Marshal(x.fields)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	for _, resource := range sortedKeys(x.resources) {
+		var tokens []string
+		for _, t := range x.resources[resource] {
+			for n := x.postings[t][resource]; n > 0; n-- {
+				tokens = append(tokens, t)
+			}
+		}
+		b = append(b, resource+"\t"+strings.Join(tokens, " ")+"\n"...)
+	}
+
+	path := d.searchPath(collection)
+	if err := d.backend.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return d.writeFile(path+d.tmpSuffix, path, b)
+}
+
+// searchRecord updates x, the full-text index of a collection, for a written
+// record, or for a deleted one when doc is nil. The caller must hold the
+// collection mutex.
+func (d *Driver) searchRecord(collection, resource string, x *searchIndex, doc interface{}) {
+	var tokens []string
+	if doc != nil {
+		tokens = recordTokens(doc, x.fields)
+	}
+	if _, ok := x.resources[resource]; !ok && len(tokens) == 0 {
+		return
+	}
+	x.set(resource, tokens)
+
+	if err := d.appendIndexLine(d.searchPath(collection), resource, strings.Join(tokens, " ")); err != nil {
+		d.log.Warn("Unable to update search index", "collection", collection, "error", err)
+	}
+}
+
+// dropSearches forgets the cached full-text indexes of a removed collection
+// and of the collections nested in it, along with dropIndexes
+func (d *Driver) dropSearches(collection string) {
+	c := d.searches
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for name := range c.collections {
+		if name == collection || strings.HasPrefix(name, collection+"/") {
+			delete(c.collections, name)
+		}
+	}
+}
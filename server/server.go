@@ -0,0 +1,270 @@
+// Package server exposes a jsondb database over HTTP as a small REST
+// document store:
+//
+//	GET    /collections                    collection names
+//	GET    /collections/{c}                records, see below
+//	GET    /collections/{c}/{resource}     one record
+//	PUT    /collections/{c}/{resource}     write the JSON body as the record
+//	PATCH  /collections/{c}/{resource}     patch the record with the body
+//	DELETE /collections/{c}/{resource}     delete the record
+//	DELETE /collections/{c}                delete the collection
+//
+// Listing a collection takes the query parameters where (repeatable, such as
+// where=Age>=30 or where=Tag in ["a","b"], the value parsed as JSON when it
+// is valid JSON and as a string otherwise), sort ("Age desc, Name"), offset,
+// limit and fields (comma separated). PATCH bodies are JSON Merge Patches,
+// or JSON Patches with the Content-Type application/json-patch+json. Nested
+// collections are addressed with an escaped slash, a%2Fb.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jsondb "github.com/JJFelix/go-json-database"
+)
+
+// defaultMaxBody bounds request bodies unless Options.MaxBodyBytes is set
+const defaultMaxBody = 10 << 20
+
+// Options are the settings of a Server. The zero value serves every request
+// without authentication.
+type Options struct {
+	// APIKey, when set, must be presented by every request, as
+	// "Authorization: Bearer <key>" or in an X-API-Key header. Requests
+	// without it are answered 401.
+	APIKey string
+
+	// MaxBodyBytes bounds the size of PUT and PATCH bodies; it defaults to
+	// 10 MiB. Larger bodies are answered 413.
+	MaxBodyBytes int64
+}
+
+// Server is an http.Handler serving a database
+type Server struct {
+	db      *jsondb.Driver
+	apiKey  string
+	maxBody int64
+	mux     *http.ServeMux
+}
+
+// New returns a Server for db. opts may be nil.
+func New(db *jsondb.Driver, opts *Options) *Server {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	s := &Server{db: db, apiKey: o.APIKey, maxBody: o.MaxBodyBytes, mux: http.NewServeMux()}
+	if s.maxBody <= 0 {
+		s.maxBody = defaultMaxBody
+	}
+
+	s.mux.HandleFunc("GET /collections", s.collections)
+	s.mux.HandleFunc("GET /collections/{c}", s.list)
+	s.mux.HandleFunc("DELETE /collections/{c}", s.dropCollection)
+	s.mux.HandleFunc("GET /collections/{c}/{resource}", s.read)
+	s.mux.HandleFunc("PUT /collections/{c}/{resource}", s.write)
+	s.mux.HandleFunc("PATCH /collections/{c}/{resource}", s.patch)
+	s.mux.HandleFunc("DELETE /collections/{c}/{resource}", s.delete)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.apiKey != "" && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="jsondb"`)
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid API key"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	key := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		key = bearer
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(s.apiKey)) == 1
+}
+
+func (s *Server) collections(w http.ResponseWriter, r *http.Request) {
+	names, err := s.db.Collections()
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var query jsondb.Query
+	for _, where := range params["where"] {
+		c, err := jsondb.ParseCondition(where)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		query.Conditions = append(query.Conditions, c)
+	}
+
+	opts := jsondb.ListOptions{Sort: params.Get("sort")}
+	for _, p := range []struct {
+		name string
+		n    *int
+	}{{"offset", &opts.Offset}, {"limit", &opts.Limit}} {
+		v := params.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q - must be a non-negative integer", p.name, v))
+			return
+		}
+		*p.n = n
+	}
+	if fields := params.Get("fields"); fields != "" {
+		for _, f := range strings.Split(fields, ",") {
+			opts.Fields = append(opts.Fields, strings.TrimSpace(f))
+		}
+	}
+
+	records, err := s.db.FindWithOptions(r.PathValue("c"), query, opts)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if records == nil {
+		records = []json.RawMessage{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (s *Server) read(w http.ResponseWriter, r *http.Request) {
+	var record json.RawMessage
+	if err := s.db.Read(r.PathValue("c"), r.PathValue("resource"), &record); err != nil {
+		fail(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(record)
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.body(w, r)
+	if !ok {
+		return
+	}
+	if !json.Valid(body) {
+		writeError(w, http.StatusBadRequest, errors.New("request body is not valid JSON"))
+		return
+	}
+	if err := s.db.Write(r.PathValue("c"), r.PathValue("resource"), json.RawMessage(body)); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) patch(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.body(w, r)
+	if !ok {
+		return
+	}
+	mode := jsondb.MergePatch
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json-patch+json") {
+		mode = jsondb.JSONPatch
+	}
+	if err := s.db.Patch(r.PathValue("c"), r.PathValue("resource"), body, mode); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.Delete(r.PathValue("c"), r.PathValue("resource")); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) dropCollection(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.Delete(r.PathValue("c"), ""); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// body reads a request body of at most maxBody bytes, answering the request
+// itself when it can't
+func (s *Server) body(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBody))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return b, true
+}
+
+// Status returns the HTTP status a driver error is answered with: 404 for a
+// missing record, 400 for invalid names, bodies and list parameters, 422 for
+// a JSON Patch that can't be applied, 409 for conflicts and failed patch
+// tests, 403 on a read-only database, 503 on a locked or closed one, and 500
+// for anything else.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, jsondb.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, jsondb.ErrEmptyCollection), errors.Is(err, jsondb.ErrEmptyResource),
+		errors.Is(err, jsondb.ErrInvalidName), errors.Is(err, jsondb.ErrSchemaViolation),
+		errors.Is(err, jsondb.ErrInvalidListOptions):
+		return http.StatusBadRequest
+	case errors.Is(err, jsondb.ErrInvalidPatch):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, jsondb.ErrConflict), errors.Is(err, jsondb.ErrDuplicate),
+		errors.Is(err, jsondb.ErrPatchTestFailed):
+		return http.StatusConflict
+	case errors.Is(err, jsondb.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, jsondb.ErrLocked), errors.Is(err, jsondb.ErrClosed):
+		return http.StatusServiceUnavailable
+	}
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	if errors.As(err, &syntax) || errors.As(err, &typ) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func fail(w http.ResponseWriter, err error) {
+	writeError(w, Status(err), err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jsondb "github.com/JJFelix/go-json-database"
+	"github.com/JJFelix/go-json-database/jsondbtest"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&jsondb.NotFoundError{Collection: "users", Resource: "a"}, http.StatusNotFound},
+		{fmt.Errorf("%w: x", jsondb.ErrInvalidName), http.StatusBadRequest},
+		{fmt.Errorf("%w: x", jsondb.ErrInvalidListOptions), http.StatusBadRequest},
+		{fmt.Errorf("%w: x", jsondb.ErrInvalidPatch), http.StatusUnprocessableEntity},
+		{fmt.Errorf("%w at /a", jsondb.ErrPatchTestFailed), http.StatusConflict},
+		{fmt.Errorf("%w - x", jsondb.ErrReadOnly), http.StatusForbidden},
+		{fmt.Errorf("%w - x", jsondb.ErrClosed), http.StatusServiceUnavailable},
+		{fmt.Errorf("disk on fire"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := Status(tt.err); got != tt.want {
+			t.Errorf("Status(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorStatuses(t *testing.T) {
+	db := jsondbtest.New(t)
+	if err := db.Write("users", "a", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	s := New(db, nil)
+
+	tests := []struct {
+		name        string
+		method, url string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"merge patch of a missing record", "PATCH", "/collections/users/b", "", `{"n":2}`, http.StatusNotFound},
+		{"json patch of a missing record", "PATCH", "/collections/users/b", "application/json-patch+json", `[]`, http.StatusNotFound},
+		{"failed test op", "PATCH", "/collections/users/a", "application/json-patch+json", `[{"op":"test","path":"/n","value":2}]`, http.StatusConflict},
+		{"unknown op", "PATCH", "/collections/users/a", "application/json-patch+json", `[{"op":"frob","path":"/n"}]`, http.StatusUnprocessableEntity},
+		{"missing member", "PATCH", "/collections/users/a", "application/json-patch+json", `[{"op":"remove","path":"/m"}]`, http.StatusUnprocessableEntity},
+		{"malformed patch", "PATCH", "/collections/users/a", "application/json-patch+json", `[`, http.StatusBadRequest},
+		{"invalid sort", "GET", "/collections/users?sort=n+sideways", "", "", http.StatusBadRequest},
+		{"dot collection", "DELETE", "/collections/%2E", "", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.url, w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
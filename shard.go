@@ -0,0 +1,164 @@
+package jsondb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shard copies every record of sourceCollection into n collections named
+// <sourceCollection>_0 … <sourceCollection>_<n-1>, picking the shard of each
+// record with keyFn(resource) % n. The source collection is left intact. It
+// returns the names of the shard collections.
+func (d *Driver) Shard(sourceCollection string, n int, keyFn func(resource string) int) (shards []string, err error) {
+	defer d.done(OpShard, sourceCollection, "", time.Now(), &err)
+
+	if sourceCollection == "" {
+		return nil, fmt.Errorf("%w - unable to shard", ErrEmptyCollection)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid shard count %d - must be positive", n)
+	}
+	if keyFn == nil {
+		return nil, fmt.Errorf("missing key function - unable to shard")
+	}
+	if err := d.validateCollection(sourceCollection); err != nil {
+		return nil, err
+	}
+	if err := d.requireFiles("Shard"); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < n; i++ {
+		shard := fmt.Sprintf("%s_%d", sourceCollection, i)
+		if err := d.validateCollection(shard); err != nil {
+			return nil, err
+		}
+		shards = append(shards, shard)
+	}
+
+	names, err := d.recordNames(sourceCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		b, err := d.readFile(filepath.Join(d.dir, sourceCollection, name+d.ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			b, err = d.migrateRecord(sourceCollection, name, b)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		i := keyFn(name) % n
+		if i < 0 {
+			i += n
+		}
+		if err := d.writeRaw(shards[i], name, b); err != nil {
+			return nil, err
+		}
+	}
+
+	return shards, nil
+}
+
+// BatchError reports the failures of an operation run against several
+// drivers, keyed by the index of the driver. Results from the drivers that
+// succeeded are still returned alongside it.
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	idx := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+
+	msgs := make([]string, len(idx))
+	for n, i := range idx {
+		msgs[n] = fmt.Sprintf("shard %d: %v", i, e.Errors[i])
+	}
+	return fmt.Sprintf("%d shards failed - %s", len(idx), strings.Join(msgs, "; "))
+}
+
+// Unwrap lets errors.Is and errors.As look at every shard's error
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// ShardedReadAll runs ReadAll for collection on every driver in parallel and
+// returns the union of the records, deduplicated and sorted. If some drivers
+// fail, the records of the others are returned with a *BatchError.
+func ShardedReadAll(drivers []*Driver, collection string) ([]string, error) {
+	type result struct {
+		shard   int
+		records []string
+		err     error
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(drivers) {
+		workers = len(drivers)
+	}
+
+	jobs := make(chan int)
+	results := make(chan result)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				records, err := drivers[i].ReadAll(collection)
+				results <- result{i, records, err}
+			}
+		}()
+	}
+	go func() {
+		for i := range drivers {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	seen := make(map[string]bool)
+	var records []string
+	batch := &BatchError{Errors: make(map[int]error)}
+
+	for r := range results {
+		if r.err != nil {
+			batch.Errors[r.shard] = r.err
+			continue
+		}
+		for _, record := range r.records {
+			if !seen[record] {
+				seen[record] = true
+				records = append(records, record)
+			}
+		}
+	}
+	sort.Strings(records)
+
+	if len(batch.Errors) > 0 {
+		return records, batch
+	}
+	return records, nil
+}
@@ -0,0 +1,188 @@
+package jsondb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// socketRequest is one line of the ServeUnixSocket protocol
+type socketRequest struct {
+	Op         string          `json:"op"`
+	Collection string          `json:"collection"`
+	Resource   string          `json:"resource"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+// socketResponse answers exactly one socketRequest, on its own line
+type socketResponse struct {
+	OK    bool        `json:"ok"`
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// ServeUnixSocket listens on a Unix domain socket at path and serves a
+// line-oriented JSON protocol so that other processes can use the database.
+// Each request line is {"op", "collection", "resource", "payload"} and is
+// answered by one {"ok", "data", "error"} line; see the README for the ops.
+// Call the returned func to stop: it closes the listener and every open
+// connection, waits for in-flight requests and removes the socket file.
+func (d *Driver) ServeUnixSocket(path string) (func(), error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing path - unable to serve socket")
+	}
+	if err := d.requireJSON("ServeUnixSocket"); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mutex  sync.Mutex
+		conns  = make(map[net.Conn]struct{})
+		closed bool
+		wg     sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				d.log.Error("Unable to accept", "socket", path, "error", err)
+				continue
+			}
+
+			mutex.Lock()
+			if closed {
+				mutex.Unlock()
+				conn.Close()
+				return
+			}
+			conns[conn] = struct{}{}
+			wg.Add(1)
+			mutex.Unlock()
+
+			go func() {
+				defer wg.Done()
+				d.serveSocketConn(conn)
+
+				mutex.Lock()
+				delete(conns, conn)
+				mutex.Unlock()
+				conn.Close()
+			}()
+		}
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			mutex.Lock()
+			closed = true
+			ln.Close()
+			for conn := range conns {
+				conn.Close()
+			}
+			mutex.Unlock()
+
+			wg.Wait()
+			os.Remove(path)
+		})
+	}
+
+	return stop, nil
+}
+
+// maxSocketRequest bounds a request line, so a client can't make the
+// driver buffer an endless one
+const maxSocketRequest = 64 << 20
+
+// serveSocketConn answers the requests of one connection until the client
+// hangs up. A line that isn't valid JSON gets an error response; the
+// connection stays open. A line longer than maxSocketRequest gets an error
+// response and closes the connection, as the rest of it can't be skipped
+// reliably.
+func (d *Driver) serveSocketConn(conn net.Conn) {
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(nil, maxSocketRequest)
+	w := bufio.NewWriter(conn)
+	enc := json.NewEncoder(w)
+
+	respond := func(resp socketResponse) bool {
+		return enc.Encode(resp) == nil && w.Flush() == nil
+	}
+	for sc.Scan() {
+		var resp socketResponse
+		var req socketRequest
+		if jerr := json.Unmarshal(sc.Bytes(), &req); jerr != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", jerr)
+		} else if data, oerr := d.socketOp(req); oerr != nil {
+			resp.Error = oerr.Error()
+		} else {
+			resp.OK, resp.Data = true, data
+		}
+		if !respond(resp) {
+			return
+		}
+	}
+
+	err := sc.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		respond(socketResponse{Error: fmt.Sprintf("invalid request: longer than %d bytes", maxSocketRequest)})
+		return
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		d.log.Error("Unable to read socket request", "error", err)
+	}
+}
+
+// socketOp runs one protocol request against the driver
+func (d *Driver) socketOp(req socketRequest) (interface{}, error) {
+	switch req.Op {
+	case "read":
+		var record json.RawMessage
+		if err := d.Read(req.Collection, req.Resource, &record); err != nil {
+			return nil, err
+		}
+		return record, nil
+
+	case "readAll":
+		records, err := d.ReadAll(req.Collection)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]json.RawMessage, len(records))
+		for i, record := range records {
+			data[i] = json.RawMessage(record)
+		}
+		return data, nil
+
+	case "write":
+		if len(req.Payload) == 0 {
+			return nil, fmt.Errorf("missing payload - unable to save record")
+		}
+		return nil, d.Write(req.Collection, req.Resource, req.Payload)
+
+	case "delete":
+		return nil, d.Delete(req.Collection, req.Resource)
+
+	case "exists":
+		return d.Exists(req.Collection, req.Resource)
+
+	case "":
+		return nil, fmt.Errorf("missing op - unable to handle request")
+	}
+	return nil, fmt.Errorf("unknown op %q - must be one of read, readAll, write, delete, exists", req.Op)
+}
@@ -0,0 +1,59 @@
+package jsondb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeUnixSocket(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	path := filepath.Join(t.TempDir(), "db.sock")
+	stop, err := d.ServeUnixSocket(path)
+	if err != nil {
+		t.Skipf("unable to serve a Unix socket: %v", err)
+	}
+	defer stop()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	roundTrip := func(line []byte) socketResponse {
+		t.Helper()
+		go conn.Write(line)
+		b, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("reading the response to %.40q: %v", line, err)
+		}
+		var resp socketResponse
+		if err := json.Unmarshal(b, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := roundTrip([]byte(`{"op":"write","collection":"users","resource":"ada","payload":{"Name":"Ada"}}` + "\n")); !resp.OK {
+		t.Fatalf("write response = %+v", resp)
+	}
+	if resp := roundTrip([]byte("not json\n")); resp.OK || !strings.HasPrefix(resp.Error, "invalid request") {
+		t.Errorf("response to an invalid line = %+v, want an invalid request error", resp)
+	}
+	if resp := roundTrip([]byte(`{"op":"read","collection":"users","resource":"ada"}` + "\n")); !resp.OK {
+		t.Errorf("read response after an invalid line = %+v, want the connection kept", resp)
+	}
+
+	long := append(bytes.Repeat([]byte("x"), maxSocketRequest+1), '\n')
+	if resp := roundTrip(long); resp.OK || !strings.Contains(resp.Error, "longer than") {
+		t.Errorf("response to an overlong line = %+v, want an error", resp)
+	}
+	if _, err := r.ReadBytes('\n'); err == nil {
+		t.Error("connection still open after an overlong line")
+	}
+}
@@ -0,0 +1,140 @@
+package jsondb
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Storage is the file system a Driver keeps the database in, Disk by default
+// or Memory. Not to be confused with Options.Storage, the layout of the files
+// within it. Paths are OS paths under the database dir, and errors must
+// satisfy os.IsNotExist and os.IsExist as the os package's do. A Storage may
+// also have a Link(oldname, newname string) error method, used where Backup
+// and CopyCollection would otherwise copy a file.
+type Storage interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, b []byte, perm fs.FileMode) error
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	MkdirAll(path string, perm fs.FileMode) error
+}
+
+// File is an open file of a Storage, as *os.File is one of Disk
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	io.Seeker
+	io.Closer
+	Stat() (fs.FileInfo, error)
+	Sync() error
+}
+
+// Disk returns the Storage of the operating system's file system
+func Disk() Storage {
+	return diskStorage{}
+}
+
+type diskStorage struct{}
+
+func (diskStorage) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (diskStorage) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (diskStorage) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (diskStorage) Rename(oldpath, newpath string) error       { return os.Rename(oldpath, newpath) }
+func (diskStorage) Remove(name string) error                   { return os.Remove(name) }
+func (diskStorage) RemoveAll(path string) error                { return os.RemoveAll(path) }
+func (diskStorage) Link(oldname, newname string) error         { return os.Link(oldname, newname) }
+
+func (diskStorage) WriteFile(name string, b []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, b, perm)
+}
+
+func (diskStorage) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (diskStorage) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// onDisk reports whether the driver works on the operating system's files,
+// which file locks and memory mapping need
+func (o Options) onDisk() bool {
+	_, disk := o.Backend.(diskStorage)
+	return o.Backend == nil || disk
+}
+
+// openFile opens a file of the driver's Storage for reading
+func (d *Driver) openFile(name string) (File, error) {
+	return d.backend.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// createFile creates or truncates a file of the driver's Storage
+func (d *Driver) createFile(name string) (File, error) {
+	return d.backend.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// link hard links a file where the Storage supports it, and fails otherwise
+// so the caller copies it instead
+func (d *Driver) link(oldname, newname string) error {
+	l, ok := d.backend.(interface{ Link(string, string) error })
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	return l.Link(oldname, newname)
+}
+
+// walkDir is filepath.WalkDir over the driver's Storage
+func (d *Driver) walkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := d.backend.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = d.walk(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (d *Driver) walk(path string, e fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, e, nil); err != nil || !e.IsDir() {
+		if err == filepath.SkipDir && e.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := d.backend.ReadDir(path)
+	if err != nil {
+		// a second call with the error, as filepath.WalkDir makes
+		if err = fn(path, e, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		if err := d.walk(filepath.Join(path, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
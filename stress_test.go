@@ -0,0 +1,152 @@
+package jsondb
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentDriver runs the whole API on one driver from many goroutines
+// and closes it while they are still going; run it with -race. It takes
+// stressDuration, a tenth of it with -short.
+func TestConcurrentDriver(t *testing.T) {
+	const stressDuration = 2 * time.Second
+	duration := stressDuration
+	if testing.Short() {
+		duration /= 10
+	}
+
+	d, _ := newTestDriver(t, &Options{
+		CacheSize:           16,
+		VerifyWrites:        true,
+		TrashRetention:      time.Hour,
+		MaintenanceInterval: 10 * time.Millisecond,
+		Collections: map[string]CollectionOptions{
+			"sessions": {TTL: 5 * time.Millisecond},
+		},
+	})
+	if err := d.CreateIndex("users", "Age"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EnableSearch("users", []string{"Name"}); err != nil {
+		t.Fatal(err)
+	}
+
+	collections := []string{"users", "users/admins", "sessions", "scratch"}
+	ops := []func(r *rand.Rand, c, resource string) error{
+		func(r *rand.Rand, c, resource string) error {
+			return d.Write(c, resource, testUser{Name: resource, Age: r.Intn(100)})
+		},
+		func(r *rand.Rand, c, resource string) error { return d.Read(c, resource, &testUser{}) },
+		func(r *rand.Rand, c, resource string) error { _, err := d.ReadAll(c); return err },
+		func(r *rand.Rand, c, resource string) error { return d.Delete(c, resource) },
+		func(r *rand.Rand, c, resource string) error {
+			_, err := d.Find(c, Query{Conditions: []Condition{{Field: "Age", Op: Gt, Value: 50}}})
+			return err
+		},
+		func(r *rand.Rand, c, resource string) error {
+			_, err := d.Increment(c, resource, "Age", 1)
+			return err
+		},
+		func(r *rand.Rand, c, resource string) error {
+			return d.Patch(c, resource, []byte(`{"Name":"patched"}`), MergePatch)
+		},
+		func(r *rand.Rand, c, resource string) error { _, err := d.Exists(c, resource); return err },
+		func(r *rand.Rand, c, resource string) error { _, err := d.Search("users", resource); return err },
+		func(r *rand.Rand, c, resource string) error { _, err := d.Collections(); return err },
+		func(r *rand.Rand, c, resource string) error { return d.DropCollection("scratch", true) },
+		func(r *rand.Rand, c, resource string) error { return d.SoftDelete(c, resource) },
+		func(r *rand.Rand, c, resource string) error { return d.Undelete(c, resource) },
+		func(r *rand.Rand, c, resource string) error { _, err := d.Compact(); return err },
+		func(r *rand.Rand, c, resource string) error { _ = d.Stats(); return nil },
+		func(r *rand.Rand, c, resource string) error {
+			return d.Transaction(func(tx *Tx) error {
+				return tx.Write(c, resource, testUser{Name: resource})
+			})
+		},
+		func(r *rand.Rand, c, resource string) error {
+			events, stop, err := d.Watch(c)
+			if err != nil {
+				return err
+			}
+			defer stop()
+			select {
+			case <-events:
+			case <-time.After(time.Millisecond):
+			}
+			return nil
+		},
+		func(r *rand.Rand, c, resource string) error {
+			unlock, err := d.LockCollection(c)
+			if err == nil {
+				unlock()
+			}
+			return err
+		},
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c := collections[r.Intn(len(collections))]
+				resource := fmt.Sprintf("r%d", r.Intn(8))
+				// errors are expected, records come and go; only races and
+				// panics fail the test
+				_ = ops[r.Intn(len(ops))](r, c, resource)
+			}
+		}(int64(g))
+	}
+
+	// a watcher that keeps up until Close closes its channel
+	events, _, err := d.Watch("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for range events {
+		}
+	}()
+
+	time.Sleep(duration)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch channel still open after Close")
+	}
+
+	// the goroutines still running now only see ErrClosed
+	after := make(chan error, 1)
+	go func() {
+		r := rand.New(rand.NewSource(0))
+		for i, op := range ops {
+			if err := op(r, "users", "r0"); err != nil && !errors.Is(err, ErrClosed) {
+				after <- fmt.Errorf("op %d after Close = %v, want ErrClosed", i, err)
+				return
+			}
+		}
+		after <- nil
+	}()
+	if err := <-after; err != nil {
+		t.Error(err)
+	}
+	close(stop)
+	wg.Wait()
+}
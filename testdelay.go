@@ -0,0 +1,12 @@
+//go:build !tests
+
+package jsondb
+
+import "time"
+
+// testOptions holds options only available in builds with the tests tag
+type testOptions struct{}
+
+func (testOptions) writeDelay() time.Duration {
+	return 0
+}
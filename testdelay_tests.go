@@ -0,0 +1,19 @@
+//go:build tests
+
+package jsondb
+
+import "time"
+
+// testOptions holds options only available in builds with the tests tag, so
+// they can't be set by accident in production code
+type testOptions struct {
+	// TestWriteDelay makes Write sleep for the duration while it holds the
+	// collection mutex, widening race windows so concurrency bugs reproduce
+	// reliably. Being promoted, it's set with opts.TestWriteDelay = d rather
+	// than in an Options literal.
+	TestWriteDelay time.Duration
+}
+
+func (o testOptions) writeDelay() time.Duration {
+	return o.TestWriteDelay
+}
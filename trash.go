@@ -0,0 +1,329 @@
+package jsondb
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashDir is the area under the database dir that deleted records are moved
+// into when Options.TrashRetention is set. It can't be used as a collection.
+const trashDir = "_trash"
+
+// trashRecord moves the record at <dir>/<rel>.json into the trash, stamped
+// with the deletion time
+func (d *Driver) trashRecord(rel string) error {
+	d.trash.Lock()
+	defer d.trash.Unlock()
+
+	src := filepath.Join(d.dir, rel+d.ext)
+	dst := filepath.Join(d.dir, trashDir, rel+"."+strconv.FormatInt(time.Now().UnixNano(), 10)+d.ext)
+
+	if err := d.backend.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	return d.backend.Rename(src, dst)
+}
+
+// trashCollection moves every record of a collection (and of the collections
+// nested in it) into the trash, then removes what's left of its directory
+func (d *Driver) trashCollection(rel string) error {
+	dir := filepath.Join(d.dir, rel)
+
+	err := d.walkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() && e.Name() == historyDir {
+			return filepath.SkipDir // removed with the dir
+		}
+		if e.IsDir() || filepath.Ext(path) != d.ext {
+			return nil
+		}
+
+		r, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+		return d.trashRecord(strings.TrimSuffix(r, d.ext))
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.backend.RemoveAll(dir)
+}
+
+// SoftDelete moves a record into the trash, whether or not
+// Options.TrashRetention is set, so reads no longer see it but Undelete can
+// bring it back. Without TrashRetention it stays there until Purge or
+// EmptyTrash removes it. It requires the files storage.
+func (d *Driver) SoftDelete(collection, resource string) (err error) {
+	defer d.done(OpSoftDelete, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to delete", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to delete record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+	if err := d.requireFiles("SoftDelete"); err != nil {
+		return err
+	}
+
+	if err := d.beforeDelete(collection, resource); err != nil {
+		return err
+	}
+	defer func() { d.afterDelete(collection, resource, err) }()
+
+	if err := d.releaseReferences(collection, resource, true); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := d.backend.Stat(filepath.Join(d.dir, collection, resource+d.ext)); err != nil || d.expired(collection, resource) {
+		if err == nil {
+			err = os.ErrNotExist
+		}
+		return notFound(collection, resource, err)
+	}
+	return d.deleteRecord(collection, resource, true)
+}
+
+// Undelete restores the most recently deleted copy of a record from the
+// trash. It fails if a record has been written under the same name since.
+func (d *Driver) Undelete(collection, resource string) (err error) {
+	defer d.done(OpUndelete, collection, resource, time.Now(), &err)
+
+	return d.undelete(collection, resource, false)
+}
+
+// ForceUndelete is like Undelete but overwrites a record written under the
+// same name since the deletion
+func (d *Driver) ForceUndelete(collection, resource string) (err error) {
+	defer d.done(OpForceUndelete, collection, resource, time.Now(), &err)
+
+	return d.undelete(collection, resource, true)
+}
+
+func (d *Driver) undelete(collection, resource string, force bool) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to undelete record", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to undelete record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	d.trash.Lock()
+	defer d.trash.Unlock()
+
+	finalPath := filepath.Join(d.dir, collection, resource+d.ext)
+	if !force {
+		if _, err := d.backend.Stat(finalPath); err == nil {
+			return fmt.Errorf("unable to undelete %v - a record with that name exists", filepath.Join(collection, resource))
+		}
+	}
+
+	trashPath := filepath.Join(d.dir, trashDir, collection)
+	entries, err := d.backend.ReadDir(trashPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	latest, found := int64(0), ""
+	for _, e := range entries {
+		name, deletedAt, ok := parseTrashName(e.Name(), d.ext)
+		if !ok || name != resource || deletedAt < latest {
+			continue
+		}
+		latest, found = deletedAt, e.Name()
+	}
+	if found == "" {
+		return fmt.Errorf("unable to find deleted record named %v: %w", filepath.Join(collection, resource), os.ErrNotExist)
+	}
+
+	if err := d.backend.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		return err
+	}
+
+	existed := d.recordExists(collection, resource)
+	if err := d.backend.Rename(filepath.Join(trashPath, found), finalPath); err != nil {
+		return err
+	}
+	if err := d.forgetMigrated(collection); err != nil {
+		return err
+	}
+
+	d.blooms.added(collection, resource)
+	if b, err := d.readFile(finalPath); err == nil {
+		if d.format == FormatJSON {
+			d.indexRecord(collection, resource, b)
+		}
+		d.written(collection, resource, existed, b)
+	}
+	return nil
+}
+
+// EmptyTrash permanently removes every deleted record held in the trash
+func (d *Driver) EmptyTrash() (err error) {
+	defer d.done(OpEmptyTrash, "", "", time.Now(), &err)
+
+	d.trash.Lock()
+	defer d.trash.Unlock()
+
+	return d.backend.RemoveAll(filepath.Join(d.dir, trashDir))
+}
+
+// PurgeTrash permanently removes deleted records older than
+// Options.TrashRetention and returns how many were removed. It runs
+// periodically in the background while trash is enabled.
+func (d *Driver) PurgeTrash() (n int, err error) {
+	defer d.done(OpPurgeTrash, "", "", time.Now(), &err)
+
+	if d.trashRetention <= 0 {
+		return 0, nil
+	}
+
+	d.trash.Lock()
+	defer d.trash.Unlock()
+
+	cutoff := time.Now().Add(-d.trashRetention).UnixNano()
+	root := filepath.Join(d.dir, trashDir)
+
+	err = d.walkDir(root, func(path string, e fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			return nil
+		}
+
+		if _, deletedAt, ok := parseTrashName(e.Name(), d.ext); ok && deletedAt < cutoff {
+			if err := d.backend.Remove(path); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+
+	return n, err
+}
+
+// Purge permanently removes the deleted records of a collection that have
+// been in the trash for longer than olderThan, all of them when it's zero,
+// and returns how many were removed. Records of nested collections are left
+// alone.
+func (d *Driver) Purge(collection string, olderThan time.Duration) (n int, err error) {
+	defer d.done(OpPurge, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to purge", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return 0, err
+	}
+
+	d.trash.Lock()
+	defer d.trash.Unlock()
+
+	dir := filepath.Join(d.dir, trashDir, collection)
+	entries, err := d.backend.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan).UnixNano()
+	for _, e := range entries {
+		if _, deletedAt, ok := parseTrashName(e.Name(), d.ext); !ok || e.IsDir() || deletedAt >= cutoff && olderThan > 0 {
+			continue
+		}
+		if err := d.backend.Remove(filepath.Join(dir, e.Name())); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// purgeTrashPeriodically is the maintenance chore started by New when trash
+// is enabled
+func (d *Driver) purgeTrashPeriodically() {
+	interval := d.trashRetention / 2
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.life.stop:
+			return
+		case <-ticker.C:
+		}
+		if n, err := d.PurgeTrash(); err != nil {
+			d.log.Error("Unable to purge trash", "error", err)
+		} else if n > 0 {
+			d.log.Debug("Purged records from the trash", "records", n)
+		}
+	}
+}
+
+// parseTrashName splits "<resource>.<unix nanos><ext>" into its parts
+func parseTrashName(name, ext string) (resource string, deletedAt int64, ok bool) {
+	name, ok = strings.CutSuffix(name, ext)
+	if !ok {
+		return "", 0, false
+	}
+
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return "", 0, false
+	}
+
+	deletedAt, err := strconv.ParseInt(name[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return name[:i], deletedAt, true
+}
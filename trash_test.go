@@ -0,0 +1,43 @@
+package jsondb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUndelete(t *testing.T) {
+	d, _ := newTestDriver(t, &Options{TrashRetention: time.Hour})
+	for _, age := range []int{35, 36} {
+		if err := d.Write("users", "ada", testUser{"Ada", age}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Delete("users", "ada"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.Undelete("users", "ada"); err != nil {
+		t.Fatal(err)
+	}
+	var u testUser
+	if err := d.Read("users", "ada", &u); err != nil || u != (testUser{"Ada", 36}) {
+		t.Fatalf("Read() after Undelete() = %+v, %v, want the latest copy", u, err)
+	}
+	if err := d.Undelete("users", "ada"); err == nil || !strings.Contains(err.Error(), "exists") {
+		t.Errorf("Undelete() over a stored record = %v, want an error", err)
+	}
+	if err := d.ForceUndelete("users", "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("users", "ada", &u); err != nil || u != (testUser{"Ada", 35}) {
+		t.Errorf("Read() after ForceUndelete() = %+v, %v, want the older copy", u, err)
+	}
+
+	err := d.Undelete("users", "bob")
+	if !errors.Is(err, os.ErrNotExist) || strings.HasSuffix(err.Error(), "\n") {
+		t.Errorf("Undelete() of a record never deleted = %q, want os.ErrNotExist", err)
+	}
+}
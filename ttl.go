@@ -0,0 +1,449 @@
+package jsondb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryFile lists the expiry times of a collection's records,
+// <dir>/<collection>/.expiry. Like an index file it is an append-only list of
+// "<resource>\t<unix nanos>\n" lines, where an empty time clears the expiry;
+// the last line of a resource wins.
+const expiryFile = ".expiry"
+
+// expiries caches the expiry times of the collections, loaded from disk on
+// first use. The map is guarded by mutex; each collection's times are only
+// changed under its collection mutex.
+type expiries struct {
+	mutex       sync.Mutex
+	collections map[string]map[string]time.Time
+	janitor     sync.Once
+}
+
+func (d *Driver) expiryPath(collection string) string {
+	return filepath.Join(d.dir, collection, expiryFile)
+}
+
+// WriteWithTTL writes v like Write, then has the record expire after ttl:
+// reads treat it as missing from then on, and the janitor removes it, see
+// Options.ExpiryInterval, until Close. Writing the record again with Write
+// makes it permanent, or gives it the collection's CollectionOptions.TTL.
+// TTLs require the files storage.
+func (d *Driver) WriteWithTTL(collection, resource string, v interface{}, ttl time.Duration) (err error) {
+	defer d.done(OpWriteWithTTL, collection, resource, time.Now(), &err)
+
+	if ttl <= 0 {
+		return fmt.Errorf("invalid ttl %v - must be positive", ttl)
+	}
+	if err := d.requireFiles("WriteWithTTL"); err != nil {
+		return err
+	}
+	if collection == "" {
+		return fmt.Errorf("%w - no place to save record", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+
+	if v, err = d.beforeWrite(collection, resource, v); err != nil {
+		return err
+	}
+	defer func() { d.afterWrite(collection, resource, v, err) }()
+
+	b, err := d.encode(v)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.writeRecord(collection, resource, b); err != nil {
+		return err
+	}
+	d.startJanitor()
+	return d.setExpiry(collection, resource, time.Now().Add(ttl))
+}
+
+// TTL returns when a record expires, or the zero time for a record that
+// doesn't or isn't stored; see GetTTL
+func (d *Driver) TTL(collection, resource string) (expiresAt time.Time, err error) {
+	defer d.done(OpTTL, collection, resource, time.Now(), &err)
+
+	if collection == "" {
+		return time.Time{}, fmt.Errorf("%w - unable to read expiry", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return time.Time{}, fmt.Errorf("%w - unable to read expiry (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return time.Time{}, err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return time.Time{}, err
+	}
+	if d.storage != StorageFiles {
+		return time.Time{}, nil
+	}
+	return d.expiresAt(collection, resource)
+}
+
+// SetTTL has a stored record expire after ttl, counted from now, replacing
+// any expiry it had, without rewriting the record. It fails with an error
+// matching ErrNotFound if the record doesn't exist or has already expired.
+func (d *Driver) SetTTL(collection, resource string, ttl time.Duration) (err error) {
+	defer d.done(OpSetTTL, collection, resource, time.Now(), &err)
+
+	if ttl <= 0 {
+		return fmt.Errorf("invalid ttl %v - must be positive", ttl)
+	}
+	if err := d.requireFiles("SetTTL"); err != nil {
+		return err
+	}
+	return d.changeExpiry(collection, resource, time.Now().Add(ttl))
+}
+
+// ClearTTL makes a stored record permanent, until a write gives it the
+// collection's CollectionOptions.TTL again. It fails like SetTTL.
+func (d *Driver) ClearTTL(collection, resource string) (err error) {
+	defer d.done(OpClearTTL, collection, resource, time.Now(), &err)
+
+	if err := d.requireFiles("ClearTTL"); err != nil {
+		return err
+	}
+	return d.changeExpiry(collection, resource, time.Time{})
+}
+
+// GetTTL returns when a stored record expires and whether it has a TTL at
+// all. Unlike TTL it fails with an error matching ErrNotFound if the record
+// doesn't exist or has already expired.
+func (d *Driver) GetTTL(collection, resource string) (expiresAt time.Time, ok bool, err error) {
+	defer d.done(OpGetTTL, collection, resource, time.Now(), &err)
+
+	if err := d.requireFiles("GetTTL"); err != nil {
+		return time.Time{}, false, err
+	}
+	if err := d.checkExpiryRecord(collection, resource); err != nil {
+		return time.Time{}, false, err
+	}
+	at, err := d.expiresAt(collection, resource)
+	return at, err == nil && !at.IsZero(), err
+}
+
+// changeExpiry sets the expiry time of a stored record, the zero time
+// clearing it
+func (d *Driver) changeExpiry(collection, resource string, at time.Time) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to change expiry", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to change expiry (no name)", ErrEmptyResource)
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.checkExpiryRecord(collection, resource); err != nil {
+		return err
+	}
+	if !at.IsZero() {
+		d.startJanitor()
+	}
+	return d.setExpiry(collection, resource, at)
+}
+
+// checkExpiryRecord fails unless a record is stored and hasn't expired
+func (d *Driver) checkExpiryRecord(collection, resource string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to read expiry", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to read expiry (no name)", ErrEmptyResource)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+
+	_, err := d.backend.Stat(filepath.Join(d.dir, collection, resource+d.ext))
+	if err == nil && d.expired(collection, resource) {
+		err = os.ErrNotExist
+	}
+	return notFound(collection, resource, err)
+}
+
+// expiresAt returns when a record expires, or the zero time
+func (d *Driver) expiresAt(collection, resource string) (time.Time, error) {
+	times, err := d.loadExpiries(collection)
+	if err != nil {
+		return time.Time{}, err
+	}
+	d.expiries.mutex.Lock()
+	defer d.expiries.mutex.Unlock()
+	return times[resource], nil
+}
+
+// loadExpiries returns the expiry times of a collection, reading them from
+// disk the first time. The map must only be read under expiries.mutex.
+func (d *Driver) loadExpiries(collection string) (map[string]time.Time, error) {
+	e := d.expiries
+	e.mutex.Lock()
+	times, ok := e.collections[collection]
+	e.mutex.Unlock()
+	if ok {
+		return times, nil
+	}
+
+	times = make(map[string]time.Time)
+	b, err := d.backend.ReadFile(d.expiryPath(collection))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		resource, at, ok := strings.Cut(string(line), "\t")
+		if !ok || resource == "" {
+			continue // blank or torn last line
+		}
+		if at == "" {
+			delete(times, resource)
+			continue
+		}
+		if n, err := strconv.ParseInt(at, 10, 64); err == nil {
+			times[resource] = time.Unix(0, n)
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if loaded, ok := e.collections[collection]; ok {
+		return loaded, nil // loaded concurrently by a reader
+	}
+	e.collections[collection] = times
+	return times, nil
+}
+
+// expired reports whether a record's expiry time has passed
+func (d *Driver) expired(collection, resource string) bool {
+	at, err := d.expiresAt(collection, resource)
+	if err != nil {
+		d.log.Error("Unable to load expiry times", "collection", collection, "error", err)
+		return false
+	}
+	return !at.IsZero() && !time.Now().Before(at)
+}
+
+// setExpiry records when a record expires; the zero time clears its expiry.
+// The caller must hold the collection mutex.
+func (d *Driver) setExpiry(collection, resource string, at time.Time) error {
+	times, err := d.loadExpiries(collection)
+	if err != nil {
+		return err
+	}
+
+	d.expiries.mutex.Lock()
+	old, had := times[resource]
+	if at.IsZero() {
+		delete(times, resource)
+	} else {
+		times[resource] = at
+	}
+	d.expiries.mutex.Unlock()
+
+	if (at.IsZero() && !had) || at.Equal(old) {
+		return nil
+	}
+	line := resource + "\t"
+	if !at.IsZero() {
+		line += strconv.FormatInt(at.UnixNano(), 10)
+	}
+
+	f, err := d.backend.OpenFile(d.expiryPath(collection), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(line + "\n")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// resetExpiry gives a record just written the collection's TTL, or no expiry
+// at all. The caller must hold the collection mutex.
+func (d *Driver) resetExpiry(collection, resource string) error {
+	if d.storage != StorageFiles {
+		return nil
+	}
+	var at time.Time
+	if ttl := d.collections[collection].TTL; ttl > 0 {
+		at = time.Now().Add(ttl)
+	}
+	return d.setExpiry(collection, resource, at)
+}
+
+// dropExpiries forgets the cached expiry times of a removed collection and
+// of the collections nested in it
+func (d *Driver) dropExpiries(collection string) {
+	e := d.expiries
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for name := range e.collections {
+		if name == collection || strings.HasPrefix(name, collection+"/") {
+			delete(e.collections, name)
+		}
+	}
+}
+
+// startJanitor starts the goroutine removing expired records, once
+func (d *Driver) startJanitor() {
+	d.expiries.janitor.Do(func() { d.startWorker(d.removeExpiredPeriodically) })
+}
+
+// removeExpiredPeriodically is the maintenance chore started for TTLs
+func (d *Driver) removeExpiredPeriodically() {
+	ticker := time.NewTicker(d.expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.life.stop:
+			return
+		case <-ticker.C:
+		}
+		if n, err := d.removeExpired(); err != nil && !errors.Is(err, ErrClosed) {
+			d.log.Error("Unable to remove expired records", "error", err)
+		} else if n > 0 {
+			d.log.Debug("Removed expired records", "records", n)
+		}
+	}
+}
+
+// removeExpired deletes the expired records of every collection with expiry
+// times and compacts their expiry files, returning the number removed
+func (d *Driver) removeExpired() (int, error) {
+	var collections []string
+	err := d.walkDir(d.dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == d.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if rel != "." && (rel == trashDir || rel == metaDir || e.Name() == historyDir || strings.HasPrefix(e.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if e.Name() == expiryFile && filepath.Dir(rel) != "." {
+			collections = append(collections, filepath.ToSlash(filepath.Dir(rel)))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, c := range collections {
+		removed, err := d.removeExpiredIn(c)
+		n += removed
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (d *Driver) removeExpiredIn(collection string) (int, error) {
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	return d.removeExpiredLocked(collection)
+}
+
+// removeExpiredLocked is removeExpiredIn for a caller holding the collection
+// mutex
+func (d *Driver) removeExpiredLocked(collection string) (int, error) {
+	times, err := d.loadExpiries(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	d.expiries.mutex.Lock()
+	var due []string
+	for resource, at := range times {
+		if !now.Before(at) {
+			due = append(due, resource)
+		}
+	}
+	d.expiries.mutex.Unlock()
+
+	n := 0
+	for _, resource := range due {
+		err := d.backend.Remove(filepath.Join(d.dir, collection, resource+d.ext))
+		if err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		if err == nil {
+			n++
+			d.blooms.removed(collection, resource)
+			if d.format == FormatJSON {
+				d.indexRecord(collection, resource, nil)
+			}
+			d.changed(Deleted, collection, resource, nil)
+		}
+		d.expiries.mutex.Lock()
+		delete(times, resource)
+		d.expiries.mutex.Unlock()
+	}
+
+	// compact the file down to the live expiry times
+	var b []byte
+	d.expiries.mutex.Lock()
+	for _, resource := range sortedKeys(times) {
+		b = append(b, resource+"\t"+strconv.FormatInt(times[resource].UnixNano(), 10)+"\n"...)
+	}
+	d.expiries.mutex.Unlock()
+	path := d.expiryPath(collection)
+	if len(b) == 0 {
+		if err := d.backend.Remove(path); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		return n, nil
+	}
+	return n, d.writeFile(path+d.tmpSuffix, path, b)
+}
@@ -0,0 +1,128 @@
+package jsondb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// writeExpired writes a record with a TTL and waits for it to pass; the
+// janitor, running every ExpiryInterval, hasn't removed it yet
+func writeExpired(t *testing.T, d *Driver, collection, resource string, v interface{}) {
+	t.Helper()
+	if err := d.WriteWithTTL(collection, resource, v, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+}
+
+func TestExpiredRecordsReleaseUniqueValues(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	if err := d.AddUniqueConstraint("users", "Name"); err != nil {
+		t.Fatal(err)
+	}
+	writeExpired(t, d, "users", "a", testUser{Name: "Ada"})
+
+	if err := d.Write("users", "b", testUser{Name: "Ada"}); err != nil {
+		t.Fatalf("Write() of an expired record's unique value = %v", err)
+	}
+	if err := d.Write("users", "c", testUser{Name: "Ada"}); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("Write() of a live record's unique value = %v, want ErrDuplicate", err)
+	}
+}
+
+func TestExpiredRecordsHaveNoModTime(t *testing.T) {
+	d, _ := newTestDriver(t, nil)
+	start := time.Now().Add(-time.Second)
+	if err := d.Write("users", "live", testUser{Name: "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	writeExpired(t, d, "users", "gone", testUser{Name: "Ada"})
+
+	if _, err := d.LastModified("users", "gone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LastModified() of an expired record = %v, want ErrNotFound", err)
+	}
+	live, err := d.LastModified("users", "live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.CollectionLastModified("users"); err != nil || !got.Equal(live) {
+		t.Errorf("CollectionLastModified() = %v, %v, want %v", got, err, live)
+	}
+
+	for name, find := range map[string]func() ([]string, error){
+		"FindModifiedAfter":   func() ([]string, error) { return d.FindModifiedAfter("users", start) },
+		"FindModifiedBefore":  func() ([]string, error) { return d.FindModifiedBefore("users", time.Now().Add(time.Second)) },
+		"FindModifiedBetween": func() ([]string, error) { return d.FindModifiedBetween("users", start, time.Now().Add(time.Second)) },
+		"ReadAllSince":        func() ([]string, error) { return d.ReadAllSince("users", start) },
+	} {
+		records, err := find()
+		if err != nil || len(records) != 1 {
+			t.Errorf("%v() = %q, %v, want the live record only", name, records, err)
+		}
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	d, dir := newTestDriver(t, nil)
+	if err := d.Write("users", "ada", testUser{"Ada", 36}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := d.GetTTL("users", "ada"); err != nil || ok {
+		t.Errorf("GetTTL() of a permanent record = %v, %v, want no TTL", ok, err)
+	}
+
+	before := time.Now()
+	if err := d.SetTTL("users", "ada", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	at, ok, err := d.GetTTL("users", "ada")
+	if err != nil || !ok || at.Before(before.Add(time.Hour)) || at.After(time.Now().Add(time.Hour)) {
+		t.Errorf("GetTTL() after SetTTL(1h) = %v, %v, %v", at, ok, err)
+	}
+	var u testUser
+	if err := d.Read("users", "ada", &u); err != nil || u.Age != 36 {
+		t.Errorf("Read() after SetTTL() = %+v, %v, want the record unchanged", u, err)
+	}
+
+	// the expiry survives a restart
+	reopened, err := New(dir, &Options{Slog: quietSlog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got, ok, err := reopened.GetTTL("users", "ada"); err != nil || !ok || !got.Equal(at) {
+		t.Errorf("GetTTL() after reopening = %v, %v, %v, want %v", got, ok, err, at)
+	}
+
+	if err := d.ClearTTL("users", "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := d.GetTTL("users", "ada"); err != nil || ok {
+		t.Errorf("GetTTL() after ClearTTL() = %v, %v, want no TTL", ok, err)
+	}
+
+	if err := d.SetTTL("users", "ada", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := d.Read("users", "ada", &u); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() after the TTL passed = %v, want ErrNotFound", err)
+	}
+
+	for name, call := range map[string]func() error{
+		"SetTTL of an expired record":   func() error { return d.SetTTL("users", "ada", time.Hour) },
+		"ClearTTL of an expired record": func() error { return d.ClearTTL("users", "ada") },
+		"GetTTL of a missing record": func() error {
+			_, _, err := d.GetTTL("users", "bob")
+			return err
+		},
+	} {
+		if err := call(); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s = %v, want ErrNotFound", name, err)
+		}
+	}
+	if err := d.SetTTL("users", "ada", 0); err == nil {
+		t.Error("SetTTL(0) = nil, want an error")
+	}
+}
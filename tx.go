@@ -0,0 +1,364 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// txDir is the area under the database dir where transactions stage their
+// records until they are renamed into place. It can't be used as a
+// collection.
+const txDir = ".transactions"
+
+// txJournal is written into a transaction's staging dir once every record is
+// staged; its presence marks the transaction committed. New replays the
+// journals left behind by a crash and discards staging dirs without one.
+const txJournal = "journal.json"
+
+// Tx stages the writes and deletes of a Transaction. It must not be used
+// after the transaction function returns.
+type Tx struct {
+	d      *Driver
+	ops    []txOp
+	staged map[[2]string]int // collection, resource -> index in ops
+	done   bool
+}
+
+// txOp is one staged change, as recorded in the journal
+type txOp struct {
+	Collection string `json:"collection"`
+	Resource   string `json:"resource"`
+	Staged     string `json:"staged,omitempty"` // file holding the record, empty for a delete
+	Deleted    bool   `json:"deleted,omitempty"`
+
+	b []byte
+	v interface{} // the value written, for AfterWrite hooks
+}
+
+// Transaction runs fn and applies the writes and deletes it stages on tx
+// all together if it returns nil, or discards them if it returns an error
+// or panics. Staged records are written to a staging area first, then a
+// journal marks the transaction committed and the records are renamed into
+// place, so a crash leaves either none of the changes or, once New has
+// replayed the journal, all of them. Transactions run one at a time and
+// lock the collections they touch while committing; plain Write and Delete
+// calls aren't held back while fn runs. Transactions require the files
+// storage.
+func (d *Driver) Transaction(fn func(tx *Tx) error) (err error) {
+	defer d.done(OpTransaction, "", "", time.Now(), &err)
+
+	if fn == nil {
+		return fmt.Errorf("missing function - unable to run transaction")
+	}
+	if err := d.requireFiles("Transaction"); err != nil {
+		return err
+	}
+
+	d.tx.Lock()
+	defer d.tx.Unlock()
+
+	tx := &Tx{d: d, staged: make(map[[2]string]int)}
+	defer func() { tx.done = true }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return d.commit(tx)
+}
+
+// Write stages v to be stored under resource when the transaction commits
+func (tx *Tx) Write(collection, resource string, v interface{}) error {
+	if err := tx.check(collection, resource, "save"); err != nil {
+		return err
+	}
+	v, err := tx.d.beforeWrite(collection, resource, v)
+	if err != nil {
+		return err
+	}
+
+	b, err := tx.d.encode(v)
+	if err != nil {
+		return err
+	}
+
+	tx.stage(txOp{Collection: collection, Resource: resource, b: b, v: v})
+	return nil
+}
+
+// Delete stages the removal of a record. The commit fails if the record
+// doesn't exist by then.
+func (tx *Tx) Delete(collection, resource string) error {
+	if err := tx.check(collection, resource, "delete"); err != nil {
+		return err
+	}
+	if err := tx.d.beforeDelete(collection, resource); err != nil {
+		return err
+	}
+
+	tx.stage(txOp{Collection: collection, Resource: resource, Deleted: true})
+	return nil
+}
+
+// Read decodes a record into v, seeing the writes and deletes already staged
+// on tx
+func (tx *Tx) Read(collection, resource string, v interface{}) error {
+	if err := tx.check(collection, resource, "read"); err != nil {
+		return err
+	}
+
+	i, ok := tx.staged[[2]string{collection, resource}]
+	if !ok {
+		return tx.d.Read(collection, resource, v)
+	}
+	if tx.ops[i].Deleted {
+		return fmt.Errorf("unable to read %v - deleted in this transaction: %w", filepath.Join(collection, resource), os.ErrNotExist)
+	}
+	return tx.d.decode(tx.ops[i].b, v)
+}
+
+func (tx *Tx) check(collection, resource, action string) error {
+	if tx.done {
+		return fmt.Errorf("transaction is finished - unable to %s record", action)
+	}
+	if collection == "" {
+		return fmt.Errorf("%w - unable to %s record", ErrEmptyCollection, action)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to %s record (no name)", ErrEmptyResource, action)
+	}
+	if err := tx.d.validateCollection(collection); err != nil {
+		return err
+	}
+	return tx.d.validateResource(resource)
+}
+
+// stage records op, replacing an earlier change to the same record
+func (tx *Tx) stage(op txOp) {
+	key := [2]string{op.Collection, op.Resource}
+	if i, ok := tx.staged[key]; ok {
+		tx.ops[i] = op
+		return
+	}
+	tx.staged[key] = len(tx.ops)
+	tx.ops = append(tx.ops, op)
+}
+
+// commit stages the records of tx, writes the journal and applies it, then
+// runs the after hooks of its changes
+func (d *Driver) commit(tx *Tx) (err error) {
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	defer func() {
+		for _, op := range tx.ops {
+			if op.Deleted {
+				d.afterDelete(op.Collection, op.Resource, err)
+			} else {
+				d.afterWrite(op.Collection, op.Resource, op.v, err)
+			}
+		}
+	}()
+
+	var collections []string
+	for _, op := range tx.ops {
+		collections = append(collections, op.Collection)
+	}
+	sort.Strings(collections)
+	for i, c := range collections {
+		if i > 0 && c == collections[i-1] {
+			continue
+		}
+		unlock, err := d.lockCollection(c)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	for _, op := range tx.ops {
+		if !op.Deleted {
+			continue
+		}
+		if _, err := d.backend.Stat(filepath.Join(d.dir, op.Collection, op.Resource+d.ext)); err != nil {
+			return fmt.Errorf("unable to delete %v in transaction: %w", filepath.Join(op.Collection, op.Resource), err)
+		}
+	}
+
+	changes := make(map[string]map[string][]byte)
+	for _, op := range tx.ops {
+		if changes[op.Collection] == nil {
+			changes[op.Collection] = make(map[string][]byte)
+		}
+		changes[op.Collection][op.Resource] = op.b
+	}
+	for _, c := range sortedKeys(changes) {
+		if err := d.checkUnique(c, changes[c]); err != nil {
+			return err
+		}
+	}
+
+	// with DurabilityStrict the staging dir is synced into .transactions, or
+	// a power loss could lose the journal along with it
+	dir := filepath.Join(d.dir, txDir, strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := d.mkdirAll(dir); err != nil {
+		return err
+	}
+
+	for i := range tx.ops {
+		op := &tx.ops[i]
+		if op.Deleted {
+			continue
+		}
+		if err := d.checkSchema(op.Collection, op.Resource, op.b); err != nil {
+			d.backend.RemoveAll(dir)
+			return err
+		}
+		b, err := d.stampVersion(op.Collection, op.b)
+		if err == nil {
+			b, err = d.stampMeta(op.Collection, op.Resource, b)
+		}
+		if err != nil {
+			d.backend.RemoveAll(dir)
+			return err
+		}
+		op.b = d.padRecord(b)
+		stored, err := d.pack(op.Collection, op.b)
+		if err != nil {
+			d.backend.RemoveAll(dir)
+			return err
+		}
+		op.Staged = strconv.Itoa(i) + d.ext
+		if err := d.writeNew(filepath.Join(dir, op.Staged), stored); err != nil {
+			d.backend.RemoveAll(dir)
+			return err
+		}
+	}
+
+	journal, err := json.Marshal(tx.ops)
+	if err != nil {
+		d.backend.RemoveAll(dir)
+		return err
+	}
+	if err := d.writeFile(filepath.Join(dir, txJournal+d.tmpSuffix), filepath.Join(dir, txJournal), journal); err != nil {
+		d.backend.RemoveAll(dir)
+		return err
+	}
+
+	return d.applyJournal(dir, tx.ops)
+}
+
+// applyJournal moves the staged records of a committed transaction into
+// place and removes its staging dir. It is idempotent, so a journal
+// interrupted halfway can be applied again. The caller must hold the
+// mutexes of the collections involved.
+func (d *Driver) applyJournal(dir string, ops []txOp) error {
+	moved := make(map[string]bool)
+	for _, op := range ops {
+		path := filepath.Join(op.Collection, op.Resource)
+		finalPath := filepath.Join(d.dir, path+d.ext)
+
+		if op.Deleted {
+			var err error
+			if d.trashRetention > 0 {
+				err = d.trashRecord(path)
+			} else {
+				err = d.backend.Remove(finalPath)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			d.blooms.removed(op.Collection, op.Resource)
+			d.indexRecord(op.Collection, op.Resource, nil)
+			if err == nil {
+				d.changed(Deleted, op.Collection, op.Resource, nil)
+			}
+			if err := d.setExpiry(op.Collection, op.Resource, time.Time{}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := d.mkdirAll(filepath.Dir(finalPath)); err != nil {
+			return err
+		}
+		if _, err := d.backend.Stat(filepath.Join(dir, op.Staged)); err == nil {
+			if err := d.archiveRecord(op.Collection, op.Resource); err != nil {
+				return err
+			}
+		}
+		existed := d.recordExists(op.Collection, op.Resource)
+		err := d.backend.Rename(filepath.Join(dir, op.Staged), finalPath)
+		if os.IsNotExist(err) {
+			continue // moved before the interruption
+		}
+		if err != nil {
+			return err
+		}
+		moved[filepath.Dir(finalPath)] = true
+		if err := d.resetExpiry(op.Collection, op.Resource); err != nil {
+			return err
+		}
+
+		d.blooms.added(op.Collection, op.Resource)
+		d.written(op.Collection, op.Resource, existed, op.b) // b is only known at commit, when watchers can exist
+		if d.format == FormatJSON {
+			if b, err := d.readFile(finalPath); err == nil {
+				d.schemas.observe(d.log, op.Collection, op.Resource, b)
+				d.indexRecord(op.Collection, op.Resource, b)
+			}
+		}
+	}
+
+	// the renames must be on stable storage before the journal is gone
+	for recordDir := range moved {
+		if err := d.syncDir(recordDir); err != nil {
+			return err
+		}
+	}
+	return d.backend.RemoveAll(dir)
+}
+
+// recoverTransactions finishes the transactions that committed before a
+// crash and discards the ones that didn't. It runs from New, before the
+// driver is shared.
+func (d *Driver) recoverTransactions() error {
+	root := filepath.Join(d.dir, txDir)
+	entries, err := d.backend.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		dir := filepath.Join(root, e.Name())
+
+		b, err := d.backend.ReadFile(filepath.Join(dir, txJournal))
+		if os.IsNotExist(err) {
+			d.log.Warn("Discarding uncommitted transaction", "transaction", e.Name())
+			if err := d.backend.RemoveAll(dir); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var ops []txOp
+		if err := json.Unmarshal(b, &ops); err != nil {
+			return fmt.Errorf("corrupt transaction journal %v: %w", dir, err)
+		}
+		d.log.Info("Replaying committed transaction", "transaction", e.Name())
+		if err := d.applyJournal(dir, ops); err != nil {
+			return err
+		}
+	}
+	return nil
+}
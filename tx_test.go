@@ -0,0 +1,144 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	for _, durability := range []Durability{DurabilityNone, DurabilityStrict} {
+		t.Run(durability.String(), func(t *testing.T) {
+			d, dir := newTestDriver(t, &Options{Durability: durability})
+			if err := d.Write("users", "bob", testUser{"Bob", 41}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := d.Transaction(func(tx *Tx) error {
+				if err := tx.Write("users", "ada", testUser{"Ada", 36}); err != nil {
+					return err
+				}
+				if err := tx.Write("users/admins", "cy", testUser{"Cy", 30}); err != nil {
+					return err
+				}
+				var u testUser
+				if err := tx.Read("users", "ada", &u); err != nil || u.Name != "Ada" {
+					t.Errorf("tx.Read() of a staged write = %+v, %v", u, err)
+				}
+				return tx.Delete("users", "bob")
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range []struct{ c, r string }{{"users", "ada"}, {"users/admins", "cy"}} {
+				if err := d.Read(r.c, r.r, &testUser{}); err != nil {
+					t.Errorf("Read(%v, %v) after commit = %v", r.c, r.r, err)
+				}
+			}
+			if err := d.Read("users", "bob", &testUser{}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read() of a record deleted in the transaction = %v, want ErrNotFound", err)
+			}
+			if entries, err := os.ReadDir(filepath.Join(dir, txDir)); err != nil || len(entries) != 0 {
+				t.Errorf("staging dirs left after commit: %v, %v", entries, err)
+			}
+		})
+	}
+
+	t.Run("nothing applied on failure", func(t *testing.T) {
+		d, _ := newTestDriver(t, nil)
+		errAbort := errors.New("abort")
+		for name, fn := range map[string]func(tx *Tx) error{
+			"fn fails": func(tx *Tx) error {
+				tx.Write("users", "ada", testUser{"Ada", 36})
+				return errAbort
+			},
+			"delete of a missing record": func(tx *Tx) error {
+				tx.Write("users", "ada", testUser{"Ada", 36})
+				return tx.Delete("users", "nobody")
+			},
+		} {
+			if err := d.Transaction(fn); err == nil {
+				t.Errorf("%v: Transaction() succeeded", name)
+			}
+			if err := d.Read("users", "ada", &testUser{}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("%v: Read() = %v, want ErrNotFound", name, err)
+			}
+		}
+	})
+}
+
+// TestRecoverTransactions leaves staging dirs behind as a crash would and
+// checks New finishes the committed ones and discards the others
+func TestRecoverTransactions(t *testing.T) {
+	d, dir := newTestDriver(t, nil)
+	for _, name := range []string{"bob", "dan"} {
+		if err := d.Write("users", name, testUser{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	stage := func(name string, files map[string]string, ops []txOp) {
+		t.Helper()
+		staging := filepath.Join(dir, txDir, name)
+		if err := os.MkdirAll(staging, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for file, doc := range files {
+			if err := os.WriteFile(filepath.Join(staging, file), []byte(doc), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if ops == nil {
+			return
+		}
+		journal, err := json.Marshal(ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(staging, txJournal), journal, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// committed: ada written, bob deleted, and cy already moved into place
+	// before the crash
+	stage("1", map[string]string{"0.json": `{"Name":"Ada","Age":36}`}, []txOp{
+		{Collection: "users", Resource: "ada", Staged: "0.json"},
+		{Collection: "users", Resource: "bob", Deleted: true},
+		{Collection: "users/admins", Resource: "cy", Staged: "2.json"},
+	})
+	if err := os.MkdirAll(filepath.Join(dir, "users", "admins"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users", "admins", "cy.json"), []byte(`{"Name":"Cy","Age":30}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// uncommitted: no journal, so dan is left alone
+	stage("2", map[string]string{"0.json": `{"Name":"Dan","Age":99}`}, nil)
+
+	d, err := New(dir, &Options{Slog: quietSlog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	var ada, cy, dan testUser
+	if err := d.Read("users", "ada", &ada); err != nil || ada != (testUser{"Ada", 36}) {
+		t.Errorf("recovered write of ada = %+v, %v", ada, err)
+	}
+	if err := d.Read("users/admins", "cy", &cy); err != nil || cy != (testUser{"Cy", 30}) {
+		t.Errorf("record moved before the crash = %+v, %v", cy, err)
+	}
+	if err := d.Read("users", "bob", &testUser{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() of recovered delete = %v, want ErrNotFound", err)
+	}
+	if err := d.Read("users", "dan", &dan); err != nil || dan != (testUser{Name: "dan"}) {
+		t.Errorf("record of an uncommitted transaction = %+v, %v, want it unchanged", dan, err)
+	}
+	if entries, err := os.ReadDir(filepath.Join(dir, txDir)); err != nil || len(entries) != 0 {
+		t.Errorf("staging dirs left after recovery: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,172 @@
+package jsondb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrDuplicate is returned when a write would give two records of a
+// collection the same value of a field with a unique constraint
+var ErrDuplicate = errors.New("duplicate value")
+
+// uniqueMarker is created next to the index file of a field with a unique
+// constraint, <field>.unique in the collection's indexes dir
+const uniqueMarker = ".unique"
+
+// AddUniqueConstraint makes every write to a collection that would give two
+// records the same value of field fail with an error wrapping ErrDuplicate.
+// It is enforced through the secondary index on field (see CreateIndex),
+// which it creates if needed, and persisted with it. Records missing the
+// field, or holding null or an object or array there, never conflict. It
+// fails if the stored records already hold duplicates, and, as CreateIndex
+// does, when Options.Encryption is set.
+func (d *Driver) AddUniqueConstraint(collection, field string) (err error) {
+	defer d.done(OpAddUniqueConstraint, collection, "", time.Now(), &err)
+
+	if err := d.checkIndex(collection, field); err != nil {
+		return err
+	}
+	if err := d.requirePlain("unique constraints"); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+	x, ok := indexes[field]
+	if !ok {
+		if x, err = d.buildIndex(collection, field); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range sortedKeys(x.values) {
+		if key == "null" || len(x.values[key]) < 2 {
+			continue
+		}
+		if !ok {
+			d.backend.Remove(d.indexPath(collection, field))
+		}
+		holders := sortedKeys(x.values[key])
+		return fmt.Errorf("%w: unable to add unique constraint on %v of %v - %s is held by %v", ErrDuplicate, field, collection, key, holders)
+	}
+
+	if err := d.backend.WriteFile(d.indexPath(collection, field)+uniqueMarker, nil, 0644); err != nil {
+		return err
+	}
+	x.unique = true
+	indexes[field] = x
+	return nil
+}
+
+// DropUniqueConstraint removes the unique constraint on field of a
+// collection, keeping its index
+func (d *Driver) DropUniqueConstraint(collection, field string) (err error) {
+	defer d.done(OpDropUniqueConstraint, collection, "", time.Now(), &err)
+
+	if err := d.checkIndex(collection, field); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+	x, ok := indexes[field]
+	if !ok || !x.unique {
+		return fmt.Errorf("unable to find unique constraint on %v of %v: %w", field, collection, os.ErrNotExist)
+	}
+
+	if err := d.backend.Remove(d.indexPath(collection, field) + uniqueMarker); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	x.unique = false
+	return nil
+}
+
+// checkUnique fails with ErrDuplicate if writing the records of changes, by
+// resource, with nil deleting one, would break a unique constraint of the
+// collection. Expired records don't count. The caller must hold the
+// collection lock.
+func (d *Driver) checkUnique(collection string, changes map[string][]byte) error {
+	if d.format != FormatJSON || d.storage != StorageFiles {
+		return nil
+	}
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+
+	var docs map[string]interface{}
+	for _, field := range sortedKeys(indexes) {
+		x := indexes[field]
+		if !x.unique {
+			continue
+		}
+
+		if docs == nil {
+			docs = make(map[string]interface{}, len(changes))
+			for resource, b := range changes {
+				if b == nil {
+					docs[resource] = nil
+				} else if docs[resource], err = decodeDocument(b); err != nil {
+					return fmt.Errorf("unable to decode %v/%v: %w", collection, resource, err)
+				}
+			}
+		}
+
+		keys := make(map[string]string, len(changes)) // resource -> new key
+		for resource, doc := range docs {
+			if doc != nil {
+				keys[resource] = recordIndexKey(doc, field)
+			}
+		}
+
+		for _, resource := range sortedKeys(keys) {
+			key := keys[resource]
+			if key == "" || key == "null" {
+				continue
+			}
+			var holders []string
+			for r := range x.values[key] {
+				// an expired record no longer holds its value, although the
+				// janitor may not have removed it yet
+				if _, changed := changes[r]; !changed && !d.expired(collection, r) {
+					holders = append(holders, r)
+				}
+			}
+			for r, k := range keys {
+				if k == key && r != resource {
+					holders = append(holders, r)
+				}
+			}
+			if len(holders) > 0 {
+				sort.Strings(holders)
+				return fmt.Errorf("%w: %v of %v in %v is %s, already held by %v", ErrDuplicate, field, resource, collection, key, holders[0])
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Driver) isUniqueMarker(dir, field string) bool {
+	_, err := d.backend.Stat(filepath.Join(dir, field+".idx"+uniqueMarker))
+	return err == nil
+}
@@ -0,0 +1,148 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"strings"
+	"time"
+)
+
+// Update replaces a record with what fn returns for its current JSON, all
+// under the collection mutex, so concurrent updates of the record can't
+// overwrite each other. If fn returns an error the record is left unchanged
+// and the error is returned. Updating a missing record fails, see Upsert.
+// fn must not call other Driver methods on the same collection.
+func (d *Driver) Update(collection, resource string, fn func(current json.RawMessage) (interface{}, error)) (err error) {
+	defer d.done(OpUpdate, collection, resource, time.Now(), &err)
+
+	return d.update(collection, resource, func(current json.RawMessage, found bool) (interface{}, error) {
+		if !found {
+			return nil, notFound(collection, resource, fs.ErrNotExist)
+		}
+		return fn(current)
+	})
+}
+
+// Upsert is Update that also accepts a missing record: fn is then called
+// with a nil current and found set to false, and what it returns is written
+// as a new record
+func (d *Driver) Upsert(collection, resource string, fn func(current json.RawMessage, found bool) (interface{}, error)) (err error) {
+	defer d.done(OpUpsert, collection, resource, time.Now(), &err)
+
+	return d.update(collection, resource, fn)
+}
+
+// Increment adds delta to the integer at a dotted field path of a record and
+// returns the new value, all under the collection mutex like Update. A
+// missing record is created as an object holding just the field, and a
+// missing field counts as 0. It fails if the field, or an object on the way
+// to it, holds something else, or if the sum overflows an int64.
+func (d *Driver) Increment(collection, resource, fieldPath string, delta int64) (n int64, err error) {
+	defer d.done(OpIncrement, collection, resource, time.Now(), &err)
+
+	if fieldPath == "" {
+		return 0, fmt.Errorf("missing field path - unable to increment record")
+	}
+	err = d.update(collection, resource, func(current json.RawMessage, found bool) (interface{}, error) {
+		doc := map[string]interface{}{}
+		if found {
+			v, err := decodeDocument(current)
+			if err != nil {
+				return nil, err
+			}
+			var ok bool
+			if doc, ok = v.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("unable to increment %v of %v/%v - record is not a JSON object", fieldPath, collection, resource)
+			}
+		}
+
+		parts := strings.Split(fieldPath, ".")
+		for i := 1; i < len(parts); i++ {
+			if v, ok := lookupPath(doc, strings.Join(parts[:i], ".")); ok {
+				if _, ok := v.(map[string]interface{}); !ok {
+					return nil, fmt.Errorf("unable to increment %v of %v/%v - %v is not an object", fieldPath, collection, resource, strings.Join(parts[:i], "."))
+				}
+			}
+		}
+
+		n = 0
+		if v, ok := lookupPath(doc, fieldPath); ok {
+			num, isNum := v.(json.Number)
+			i, err := num.Int64()
+			if !isNum || err != nil {
+				return nil, fmt.Errorf("unable to increment %v of %v/%v - not an integer: %v", fieldPath, collection, resource, v)
+			}
+			n = i
+		}
+		if delta > 0 && n > math.MaxInt64-delta || delta < 0 && n < math.MinInt64-delta {
+			return nil, fmt.Errorf("unable to increment %v of %v/%v - %d%+d overflows an int64", fieldPath, collection, resource, n, delta)
+		}
+		n += delta
+
+		setPath(doc, fieldPath, n)
+		return doc, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (d *Driver) update(collection, resource string, fn func(json.RawMessage, bool) (interface{}, error)) (err error) {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to update record", ErrEmptyCollection)
+	}
+	if resource == "" {
+		return fmt.Errorf("%w - unable to update record (no name)", ErrEmptyResource)
+	}
+	if fn == nil {
+		return fmt.Errorf("missing function - unable to update record")
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return err
+	}
+	if err := d.validateResource(resource); err != nil {
+		return err
+	}
+	if err := d.requireJSON("Update"); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := d.readRaw(collection, resource)
+	found := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	v, err := fn(current, found)
+	if err != nil {
+		return err
+	}
+	if v, err = d.beforeWrite(collection, resource, v); err != nil {
+		return err
+	}
+	defer func() { d.afterWrite(collection, resource, v, err) }()
+
+	if d.storage == StorageAppendLog {
+		doc, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return d.writeLogDoc(collection, resource, doc)
+	}
+
+	b, err := d.encode(v)
+	if err != nil {
+		return err
+	}
+	return d.writeRecord(collection, resource, b)
+}
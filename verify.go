@@ -0,0 +1,199 @@
+package jsondb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// ErrWriteVerificationFailed is wrapped by the error returned when a record
+// written to a collection with VerifyWrites doesn't read back as written
+var ErrWriteVerificationFailed = errors.New("write verification failed")
+
+// VerificationError carries the hash of what was written and of what was
+// found on disk when read-after-write verification fails
+type VerificationError struct {
+	Collection string
+	Resource   string
+	Expected   string // sha256 of the marshalled record
+	Actual     string // sha256 of the file read back
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%v for '%s/%s' - expected sha256 %s, found %s",
+		ErrWriteVerificationFailed, e.Collection, e.Resource, e.Expected, e.Actual)
+}
+
+func (e *VerificationError) Unwrap() error {
+	return ErrWriteVerificationFailed
+}
+
+// Stats holds counters accumulated since the Driver was created
+type Stats struct {
+	Verifications        uint64 // read-after-write checks performed
+	VerificationFailures uint64 // checks that didn't match, including retried ones
+	SpotChecks           uint64 // sampled writes re-read by the background verifier
+	SpotCheckFailures    uint64 // sampled writes that didn't read back as written
+	CacheHits            uint64 // reads answered from the Options.CacheSize cache
+	CacheMisses          uint64 // reads the cache didn't hold, when it's enabled
+}
+
+type stats struct {
+	verifications        atomic.Uint64
+	verificationFailures atomic.Uint64
+	spotChecks           atomic.Uint64
+	spotCheckFailures    atomic.Uint64
+	cacheHits            atomic.Uint64
+	cacheMisses          atomic.Uint64
+}
+
+// Stats returns a snapshot of the driver's counters
+func (d *Driver) Stats() Stats {
+	return Stats{
+		Verifications:        d.stats.verifications.Load(),
+		VerificationFailures: d.stats.verificationFailures.Load(),
+		SpotChecks:           d.stats.spotChecks.Load(),
+		SpotCheckFailures:    d.stats.spotCheckFailures.Load(),
+		CacheHits:            d.stats.cacheHits.Load(),
+		CacheMisses:          d.stats.cacheMisses.Load(),
+	}
+}
+
+// verifyRecord re-reads path straight from disk and checks it holds exactly b,
+// both byte for byte and once decoded. It returns the hex sha256 of b and of
+// the file contents.
+func (d *Driver) verifyRecord(path string, b []byte) (expected, actual string, ok bool) {
+	defer func() { d.verified(false, ok) }()
+
+	sum := sha256.Sum256(b)
+	expected = hex.EncodeToString(sum[:])
+
+	got, err := d.backend.ReadFile(path)
+	if err != nil {
+		return expected, "", false
+	}
+	sum = sha256.Sum256(got)
+	actual = hex.EncodeToString(sum[:])
+
+	if expected != actual || (d.format == FormatJSON && d.keys == nil && !bytes.HasPrefix(b, gzipMagic) && !sameDocument(b, got)) {
+		return expected, actual, false
+	}
+
+	return expected, actual, true
+}
+
+// verified counts a read-after-write check, or a spot check, in Stats and
+// Options.Metrics
+func (d *Driver) verified(spotCheck, ok bool) {
+	if spotCheck {
+		d.stats.spotChecks.Add(1)
+		if !ok {
+			d.stats.spotCheckFailures.Add(1)
+		}
+	} else {
+		d.stats.verifications.Add(1)
+		if !ok {
+			d.stats.verificationFailures.Add(1)
+		}
+	}
+	if d.metrics != nil {
+		d.metrics.ObserveVerification(spotCheck, ok)
+	}
+}
+
+// sameDocument reports whether two JSON documents decode to equal values
+func sameDocument(a, b []byte) bool {
+	var va, vb interface{}
+
+	da := json.NewDecoder(bytes.NewReader(a))
+	da.UseNumber()
+	if err := da.Decode(&va); err != nil {
+		return false
+	}
+
+	db := json.NewDecoder(bytes.NewReader(b))
+	db.UseNumber()
+	if err := db.Decode(&vb); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(va, vb)
+}
+
+// spotCheckRate is the share of writes re-read by the background verifier
+const spotCheckRate = 0.01
+
+// spotCheck is a write queued for background verification
+type spotCheck struct {
+	collection string
+	path       string
+	sum        [sha256.Size]byte
+	modTime    time.Time
+}
+
+// queueSpotCheck samples writes for the background verifier. It never blocks
+// the writer; samples are dropped while the verifier is behind.
+func (d *Driver) queueSpotCheck(collection, path string, b []byte) {
+	if d.spotChecks == nil || rand.Float64() >= spotCheckRate {
+		return
+	}
+
+	fi, err := d.backend.Stat(path)
+	if err != nil {
+		return
+	}
+
+	select {
+	case d.spotChecks <- spotCheck{collection, path, sha256.Sum256(b), fi.ModTime()}:
+	default:
+	}
+}
+
+// runSpotChecks is the background verifier started by New when
+// Options.VerifyWrites is set. Stopped by Close, it runs the checks still
+// queued first.
+func (d *Driver) runSpotChecks() {
+	for {
+		select {
+		case c := <-d.spotChecks:
+			d.runSpotCheck(c)
+		case <-d.life.stop:
+			for len(d.spotChecks) > 0 {
+				d.runSpotCheck(<-d.spotChecks)
+			}
+			return
+		}
+	}
+}
+
+func (d *Driver) runSpotCheck(c spotCheck) {
+	mutex := d.getOrCreateMutex(c.collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// a record rewritten or deleted since the sample has nothing left to check
+	fi, err := d.backend.Stat(c.path)
+	if err != nil || !fi.ModTime().Equal(c.modTime) {
+		return
+	}
+
+	b, err := d.backend.ReadFile(c.path)
+	if err != nil {
+		d.verified(true, false)
+		d.log.Error("Spot check failed", "collection", c.collection, "path", c.path, "error", err)
+		return
+	}
+
+	sum := sha256.Sum256(b)
+	d.verified(true, sum == c.sum)
+	if sum != c.sum {
+		d.log.Error("Spot check failed", "collection", c.collection, "path", c.path, "expected", fmt.Sprintf("%x", c.sum), "found", fmt.Sprintf("%x", sum))
+	}
+}
@@ -0,0 +1,186 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WALSync selects when the write-ahead log is flushed to stable storage
+type WALSync int
+
+const (
+	// WALSyncAlways fsyncs every log entry and the collection dir before the
+	// record file is touched, and the record file and dir before the entry
+	// is removed, so an acknowledged write survives a power loss whatever
+	// the Durability
+	WALSyncAlways WALSync = iota
+
+	// WALSyncNever leaves flushing the log to the OS. The log still
+	// recovers from a crash of the process, but not of the machine.
+	WALSyncNever
+)
+
+func (s WALSync) String() string {
+	switch s {
+	case WALSyncAlways:
+		return "always"
+	case WALSyncNever:
+		return "never"
+	}
+	return fmt.Sprintf("WALSync(%d)", int(s))
+}
+
+// walFile is the write-ahead log of a collection, <dir>/<collection>/.wal.
+// It holds one JSON line per mutation in progress and is removed once the
+// mutation has been applied, so it only outlives a crash.
+const walFile = ".wal"
+
+// walEntry is a line of the write-ahead log
+type walEntry struct {
+	Resource string `json:"resource"`
+	Record   []byte `json:"record,omitempty"` // encoded record, nil for a delete
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+func (d *Driver) walPath(collection string) string {
+	return filepath.Join(d.dir, collection, walFile)
+}
+
+// logWAL appends e to the collection's write-ahead log, when enabled. The
+// returned func removes the log again once e is applied; call it whether the
+// mutation succeeded or not. With WALSyncAlways it first fsyncs the record,
+// and keeps the log for New to replay if that fails. The caller must hold
+// the collection mutex.
+func (d *Driver) logWAL(collection string, e walEntry) (func(), error) {
+	if !d.wal {
+		return func() {}, nil
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	path := d.walPath(collection)
+	dir := filepath.Dir(path)
+	_, statErr := d.backend.Stat(dir)
+	if err := d.backend.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := d.backend.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if err == nil && d.walSync == WALSyncAlways {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && d.walSync == WALSyncAlways {
+		// the log's dir entry, and those of the dirs MkdirAll created
+		err = d.fsync(dir)
+		for parent := dir; err == nil && statErr != nil && parent != filepath.Clean(d.dir) && parent != filepath.Dir(parent); {
+			parent = filepath.Dir(parent)
+			err = d.fsync(parent)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to log write of %v/%v: %w", collection, e.Resource, err)
+	}
+
+	return func() {
+		if d.walSync == WALSyncAlways {
+			err := d.fsync(filepath.Join(dir, e.Resource+d.ext))
+			if os.IsNotExist(err) {
+				err = nil // deleted, or a write that failed
+			}
+			if err == nil {
+				err = d.fsync(dir)
+			}
+			if err != nil {
+				d.log.Error("Unable to sync record, keeping write-ahead log", "collection", collection, "resource", e.Resource, "error", err)
+				return
+			}
+		}
+		if err := d.backend.Remove(path); err != nil && !os.IsNotExist(err) {
+			d.log.Error("Unable to clear write-ahead log", "collection", collection, "error", err)
+		}
+	}, nil
+}
+
+// replayWAL applies the mutations left in write-ahead logs by a crash. It
+// runs from New, before the driver is shared.
+func (d *Driver) replayWAL() error {
+	err := d.walkDir(d.dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == d.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if rel != "." && (rel == trashDir || rel == metaDir || e.Name() == historyDir || strings.HasPrefix(e.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if e.Name() != walFile || filepath.Dir(rel) == "." {
+			return nil
+		}
+
+		return d.replayCollectionWAL(filepath.ToSlash(filepath.Dir(rel)))
+	})
+	return err
+}
+
+func (d *Driver) replayCollectionWAL(collection string) error {
+	path := d.walPath(collection)
+	b, err := d.backend.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		var e walEntry
+		if len(line) == 0 || json.Unmarshal(line, &e) != nil || e.Resource == "" {
+			continue // blank or torn last line, never applied
+		}
+		d.log.Info("Replaying write-ahead log entry", "collection", collection, "resource", e.Resource)
+
+		rel := filepath.Join(collection, e.Resource)
+		finalPath := filepath.Join(d.dir, rel+d.ext)
+		switch {
+		case !e.Deleted:
+			err = d.writeFile(finalPath+d.tmpSuffix, finalPath, e.Record)
+		case d.trashRetention > 0:
+			err = d.trashRecord(rel)
+		default:
+			err = d.backend.Remove(finalPath)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to replay write-ahead log of %v: %w", collection, err)
+		}
+		if d.format == FormatJSON {
+			record, err := d.unpack(e.Record)
+			if err != nil {
+				return fmt.Errorf("unable to replay write-ahead log of %v: %w", collection, err)
+			}
+			d.indexRecord(collection, e.Resource, record)
+		}
+	}
+
+	return d.backend.Remove(path)
+}
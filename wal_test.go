@@ -0,0 +1,92 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReplayWAL leaves a write-ahead log behind as a crash would and checks
+// New applies it
+func TestReplayWAL(t *testing.T) {
+	d, dir := newTestDriver(t, &Options{WriteAheadLog: true})
+	for _, name := range []string{"bob", "cy"} {
+		if err := d.Write("users", name, testUser{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.CreateIndex("users", "Age"); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	var log []byte
+	for _, e := range []walEntry{
+		{Resource: "ada", Record: []byte(`{"Name":"Ada","Age":36}`)},
+		{Resource: "bob", Deleted: true},
+		{Resource: "cy", Record: []byte(`{"Name":"Cy","Age":30}`)},
+	} {
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log = append(append(log, line...), '\n')
+	}
+	// a torn last line: the mutation was never applied
+	log = append(log, `{"resource":"dan","rec`...)
+	walPath := filepath.Join(dir, "users", walFile)
+	if err := os.WriteFile(walPath, log, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New(dir, &Options{WriteAheadLog: true, Slog: quietSlog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	var ada, cy testUser
+	if err := d.Read("users", "ada", &ada); err != nil || ada != (testUser{"Ada", 36}) {
+		t.Errorf("replayed write of ada = %+v, %v", ada, err)
+	}
+	if err := d.Read("users", "cy", &cy); err != nil || cy != (testUser{"Cy", 30}) {
+		t.Errorf("replayed overwrite of cy = %+v, %v", cy, err)
+	}
+	if err := d.Read("users", "bob", &testUser{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() of replayed delete = %v, want ErrNotFound", err)
+	}
+	if err := d.Read("users", "dan", &testUser{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() of torn entry = %v, want ErrNotFound", err)
+	}
+	if _, err := os.Stat(walPath); !os.IsNotExist(err) {
+		t.Errorf("write-ahead log left after replay: %v", err)
+	}
+
+	// replayed records are indexed, Find looks Age up in the index
+	records, err := d.Find("users", Query{Conditions: []Condition{{Field: "Age", Op: Eq, Value: 36}}})
+	if err != nil || len(records) != 1 {
+		t.Errorf("Find() after replay = %s, %v, want ada", records, err)
+	}
+}
+
+func TestWALCleared(t *testing.T) {
+	for _, sync := range []WALSync{WALSyncAlways, WALSyncNever} {
+		for _, backend := range []Storage{nil, Memory()} {
+			d, _ := newTestDriver(t, &Options{WriteAheadLog: true, WALSync: sync, Backend: backend})
+			if err := d.Write("users/admins", "ada", testUser{"Ada", 36}); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.RenameResource("users/admins", "ada", "augusta"); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Delete("users/admins", "augusta"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.backend.Stat(d.walPath("users/admins")); !os.IsNotExist(err) {
+				t.Errorf("WALSync %v: write-ahead log left after the mutations: %v", sync, err)
+			}
+		}
+	}
+}
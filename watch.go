@@ -0,0 +1,144 @@
+package jsondb
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event reports a change made to a record through the driver
+type Event struct {
+	Type       ChangeType
+	Collection string
+	Resource   string // empty when the whole collection was deleted
+	Doc        []byte // the record as stored, nil for deletions
+}
+
+// watchBuffer is how many events a Watch channel holds before further events
+// are dropped
+const watchBuffer = 64
+
+// watchers are the channels returned by Watch, by collection. Events are sent
+// under the collection mutex, so they arrive in the order the changes were
+// made; they are never sent on a closed channel because sending and closing
+// both happen under mutex.
+type watchers struct {
+	mutex       sync.Mutex
+	collections map[string][]chan Event
+	closed      bool // set by Close, which closes every channel
+}
+
+// Watch returns a channel receiving an Event for every record of a
+// collection created, modified or deleted through this driver (or one made
+// from it by Observe) from now on. Events are sent without waiting for the
+// receiver: once the channel buffers 64 of them, further events are dropped
+// and logged, so a slow receiver never delays writers. Changes made by other
+// processes aren't seen; see Listen for those. Call the returned func to stop
+// watching; it closes the channel, as Close does.
+func (d *Driver) Watch(collection string) (_ <-chan Event, _ func(), err error) {
+	defer d.done(OpWatch, collection, "", time.Now(), &err)
+
+	if collection == "" {
+		return nil, nil, fmt.Errorf("%w - unable to watch", ErrEmptyCollection)
+	}
+	if err := d.validateCollection(collection); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan Event, watchBuffer)
+	w := d.watchers
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil, nil, fmt.Errorf("%w - unable to watch %v", ErrClosed, collection)
+	}
+	w.collections[collection] = append(w.collections[collection], ch)
+	w.mutex.Unlock()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+
+			chans := w.collections[collection]
+			for i, c := range chans {
+				if c == ch {
+					chans = append(chans[:i:i], chans[i+1:]...)
+					close(ch)
+					break
+				}
+			}
+			if len(chans) == 0 {
+				delete(w.collections, collection)
+			} else {
+				w.collections[collection] = chans
+			}
+		})
+	}
+	return ch, stop, nil
+}
+
+// closeAll closes every Watch channel for Close
+func (w *watchers) closeAll() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, chans := range w.collections {
+		for _, ch := range chans {
+			close(ch)
+		}
+	}
+	w.collections = make(map[string][]chan Event)
+	w.closed = true
+}
+
+// watching reports whether a collection has watchers, so callers can skip
+// the work of telling creations from modifications
+func (w *watchers) watching(collection string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.collections[collection]) > 0
+}
+
+// changed sends an event to the watchers of its collection. The caller must
+// hold the collection mutex.
+func (d *Driver) changed(t ChangeType, collection, resource string, doc []byte) {
+	d.cache.invalidate(collection, resource)
+
+	w := d.watchers
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, ch := range w.collections[collection] {
+		select {
+		case ch <- Event{t, collection, resource, doc}:
+		default:
+			d.log.Warn("Dropping event, watcher not keeping up", "event", t.String(), "collection", collection, "resource", resource)
+		}
+	}
+}
+
+// written sends the event of a record write, created when it didn't exist
+func (d *Driver) written(collection, resource string, existed bool, doc []byte) {
+	t := Created
+	if existed {
+		t = Modified
+	}
+	d.changed(t, collection, resource, doc)
+}
+
+// recordExists reports, when the collection is watched, whether a record is
+// stored. The caller must hold the collection mutex.
+func (d *Driver) recordExists(collection, resource string) bool {
+	if !d.watchers.watching(collection) {
+		return false
+	}
+	if d.storage == StorageAppendLog {
+		_, _, err := d.findLog(collection, resource)
+		return err == nil
+	}
+	_, err := d.backend.Stat(filepath.Join(d.dir, collection, resource+d.ext))
+	return err == nil
+}